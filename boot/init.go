@@ -5,7 +5,9 @@ import (
 	model "github.com/zhouqiaokeji/server/models"
 	"github.com/zhouqiaokeji/server/pkg/cache"
 	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/crontab"
 	"github.com/zhouqiaokeji/server/pkg/id"
+	"github.com/zhouqiaokeji/server/pkg/rsa"
 )
 
 // Init App Initialize
@@ -38,12 +40,24 @@ func Init(path string) {
 				cache.Init()
 			},
 		},
+		{
+			conf.MODE_MASTER,
+			func() {
+				rsa.Init()
+			},
+		},
 		{
 			conf.MODE_MASTER,
 			func() {
 				model.Init()
 			},
 		},
+		{
+			conf.MODE_MASTER,
+			func() {
+				crontab.Init()
+			},
+		},
 		//{
 		//	"both",
 		//	func() {
@@ -69,12 +83,6 @@ func Init(path string) {
 		//	},
 		//},
 		//{
-		//	"master",
-		//	func() {
-		//		crontab.Init()
-		//	},
-		//},
-		//{
 		//	"slave",
 		//	func() {
 		//		cluster.InitController()
@@ -4,18 +4,35 @@ import (
 	"flag"
 	"github.com/zhouqiaokeji/server/boot"
 	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/rsa"
 	"github.com/zhouqiaokeji/server/pkg/util"
 	"github.com/zhouqiaokeji/server/routers"
 )
 
-var confPath string
+var (
+	confPath string
+	genKeyID string
+)
 
 func init() {
 	flag.StringVar(&confPath, "c", util.RelativePath(conf.CONF_FILE_NAME), "config file path")
-	boot.Init(confPath)
+	flag.StringVar(&genKeyID, "genkey", "", "generate a signing key pair with the given key id and exit")
+	flag.Parse()
 }
 
 func main() {
+	// Generate Signing Key
+	if genKeyID != "" {
+		conf.Init(confPath)
+		dir := conf.KeyRingConfig.Dir
+		if err := rsa.GenerateRSAKey(2048, util.RelativePath(dir), genKeyID); err != nil {
+			util.Log().Panic("Generate Key Fail, %s", err)
+		}
+		util.Log().Info("Key %s Generated In %s, Set [KeyRing] Signing = %s To Sign With It", genKeyID, dir, genKeyID)
+		return
+	}
+
+	boot.Init(confPath)
 	api := routers.InitRouter()
 
 	// Enable SSL
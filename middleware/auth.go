@@ -41,11 +41,13 @@ func CurrentUser() gin.HandlerFunc {
 		} else {
 			user, exist := cache.Get(CacheUserPerfix + strconv.Itoa(int(jwtUser.Id)))
 			if !exist {
-				user, err = model.GetUserByID(jwtUser.Id)
-				_ = cache.Set(CacheUserPerfix+strconv.Itoa(int(jwtUser.Id)), &user, expire)
+				if dbUser, err := model.GetUserByID(jwtUser.Id); err == nil {
+					user = dbUser
+					_ = cache.Set(CacheUserPerfix+strconv.Itoa(int(jwtUser.Id)), dbUser, expire)
+				}
 			}
-			if user == nil {
-				c.Set(CurrUser, &user)
+			if current, ok := user.(model.User); ok {
+				c.Set(CurrUser, &current)
 			}
 			c.Next()
 		}
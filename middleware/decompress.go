@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxDecompressedSize 解压后请求体的最大字节数，防止压缩炸弹
+const maxDecompressedSize = 32 << 20
+
+// gzipBody 解压后的请求体，关闭时同时关闭原始请求体
+type gzipBody struct {
+	io.Reader
+	gz   *gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	_ = b.gz.Close()
+	return b.body.Close()
+}
+
+// Decompress 解压 Content-Encoding 为 gzip 的请求体，未压缩的请求原样放行
+func Decompress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+		if encoding == "" || encoding == "identity" {
+			c.Next()
+			return
+		}
+		if encoding != "gzip" {
+			c.JSON(200, serializer.ParamErr("不支持的请求压缩格式", nil))
+			c.Abort()
+			return
+		}
+		gz, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			c.JSON(200, serializer.ParamErr("请求体解压失败", err))
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, &gzipBody{Reader: gz, gz: gz, body: c.Request.Body}, maxDecompressedSize)
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.ContentLength = -1
+		c.Next()
+	}
+}
@@ -0,0 +1,317 @@
+package models
+
+import (
+	"errors"
+	"github.com/zhouqiaokeji/server/models/datatypes"
+	"github.com/zhouqiaokeji/server/pkg/actcode"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	// ErrCodeInvalid 激活码不存在或格式错误
+	ErrCodeInvalid = errors.New("激活码无效")
+	// ErrCodeExpired 激活码已过期
+	ErrCodeExpired = errors.New("激活码已过期")
+	// ErrCodeRevoked 激活码已作废
+	ErrCodeRevoked = errors.New("激活码已作废")
+	// ErrCodeExhausted 激活码兑换次数已用完
+	ErrCodeExhausted = errors.New("激活码兑换次数已用完")
+	// ErrCodeRedeemed 该容器已兑换过此激活码
+	ErrCodeRedeemed = errors.New("该容器已兑换过此激活码")
+)
+
+// ActivationCode 激活码，Code 为不含分隔符的规范化激活码；
+// 每次兑换为授权追加 Days 天的期限，Days 为 0 时授权长期有效
+type ActivationCode struct {
+	Auditable
+	Code           string         `json:"code" gorm:"size:32;uniqueIndex"`
+	Batch          string         `json:"batch" gorm:"size:64;index"`
+	Plan           string         `json:"plan"`
+	Days           int            `json:"days"`
+	MaxRedemptions int            `json:"max_redemptions"`
+	Redemptions    int            `json:"redemptions"`
+	Entitlement    datatypes.JSON `json:"entitlement"`
+	CustomerID     uint64         `json:"customer_id" gorm:"index"`
+	ExpireAt       *time.Time     `json:"expire_at"`
+	Revoked        bool           `json:"revoked"`
+	RevokeReason   string         `json:"revoke_reason"`
+}
+
+// ActivationRedemption 激活码兑换记录，同一激活码对每个授权只能兑换一次
+type ActivationRedemption struct {
+	Auditable
+	CodeID      uint64 `json:"-" gorm:"uniqueIndex:idx_activation_redemption"`
+	Code        string `json:"code" gorm:"size:32;index"`
+	LicenseID   uint64 `json:"-" gorm:"uniqueIndex:idx_activation_redemption"`
+	ContainerID string `json:"containerId" gorm:"index"`
+	InstanceID  string `json:"instance_id"`
+	RequestIP   string `json:"request_ip"`
+	Expire      string `json:"expire"`
+}
+
+// ActivationFilter 激活码列表筛选条件
+type ActivationFilter struct {
+	Batch   string
+	Plan    string
+	Revoked *bool
+}
+
+// CreateActivationCodes 按模板批量生成激活码，全部生成成功或全部失败
+func CreateActivationCodes(template *ActivationCode, count int) ([]ActivationCode, error) {
+	codes := make([]ActivationCode, 0, count)
+	for i := 0; i < count; i++ {
+		value, err := actcode.Generate()
+		if err != nil {
+			return nil, err
+		}
+		code := *template
+		code.Code, _ = actcode.Normalize(value)
+		codes = append(codes, code)
+	}
+	if err := DB.Create(&codes).Error; err != nil {
+		util.Log().Warning("无法插入激活码, %s", err)
+		return nil, err
+	}
+	return codes, nil
+}
+
+// GetActivationCode 根据激活码查询，激活码格式错误时返回 ErrCodeInvalid
+func GetActivationCode(value string) (ActivationCode, error) {
+	var code ActivationCode
+	normalized, err := actcode.Normalize(value)
+	if err != nil {
+		return code, ErrCodeInvalid
+	}
+	result := DB.Where("code = ?", normalized).First(&code)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return code, ErrCodeInvalid
+	}
+	return code, result.Error
+}
+
+// GetActivationCodes 分页查询激活码
+func GetActivationCodes(page, size int, filter *ActivationFilter) ([]ActivationCode, int64) {
+	var (
+		codes []ActivationCode
+		total int64
+	)
+	dbChain := DB.Session(&gorm.Session{})
+	if filter != nil {
+		if filter.Batch != "" {
+			dbChain = dbChain.Where("batch = ?", filter.Batch)
+		}
+		if filter.Plan != "" {
+			dbChain = dbChain.Where("plan = ?", filter.Plan)
+		}
+		if filter.Revoked != nil {
+			dbChain = dbChain.Where("revoked = ?", *filter.Revoked)
+		}
+	}
+
+	// 计算总数用于分页
+	dbChain.Model(&ActivationCode{}).Count(&total)
+
+	// 查询记录
+	dbChain.Limit(size).Offset((page - 1) * size).Order("created_at desc").Find(&codes)
+
+	return codes, total
+}
+
+// RevokeActivationCodes 作废激活码，codes 为空时按批次作废，返回作废数量
+func RevokeActivationCodes(codes []string, batch, reason string) (int64, error) {
+	tx := DB.Model(&ActivationCode{}).Where("revoked = ?", false)
+	if len(codes) > 0 {
+		normalized := make([]string, 0, len(codes))
+		for _, value := range codes {
+			if code, err := actcode.Normalize(value); err == nil {
+				normalized = append(normalized, code)
+			}
+		}
+		tx = tx.Where("code IN ?", normalized)
+	} else if batch != "" {
+		tx = tx.Where("batch = ?", batch)
+	} else {
+		return 0, nil
+	}
+	result := tx.Updates(map[string]interface{}{"revoked": true, "revoke_reason": reason})
+	if result.Error != nil {
+		util.Log().Warning("无法作废激活码, %s", result.Error)
+	}
+	return result.RowsAffected, result.Error
+}
+
+// Usable 检查激活码是否可兑换
+func (code *ActivationCode) Usable() error {
+	if code.Revoked {
+		return ErrCodeRevoked
+	}
+	if code.ExpireAt != nil && time.Now().After(*code.ExpireAt) {
+		return ErrCodeExpired
+	}
+	if code.Redemptions >= code.MaxRedemptions {
+		return ErrCodeExhausted
+	}
+	return nil
+}
+
+// Redeem 兑换激活码，授权不存在时新建并直接启用，已存在时追加期限并应用激活码的权益及客户；
+// 兑换后仍不可用的授权不允许兑换。占用兑换次数、变更授权及记录兑换在同一事务中完成
+func (code *ActivationCode) Redeem(request *License, instanceID, requestIP string) (*License, error) {
+	if err := code.Usable(); err != nil {
+		return nil, err
+	}
+	license, err := GetLicense(request.ContainerID)
+	exists := err == nil
+	if exists {
+		if code.redeemed(license.ID) {
+			return nil, ErrCodeRedeemed
+		}
+		if license.Name != request.Name || !code.activates(&license) {
+			return nil, ErrTransitionNotAllowed
+		}
+	} else {
+		license = License{
+			Name:        request.Name,
+			ContainerID: request.ContainerID,
+			IP:          request.IP,
+			Domain:      request.Domain,
+			Fingerprint: request.Fingerprint,
+			Status:      StatusPending,
+			Entitlement: code.Entitlement,
+			CustomerID:  code.CustomerID,
+		}
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&ActivationCode{}).
+			Where("id = ? AND revoked = ? AND redemptions < max_redemptions", code.ID, false).
+			Update("redemptions", gorm.Expr("redemptions + ?", 1))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCodeExhausted
+		}
+		if !exists {
+			if err := license.CreateTx(tx); err != nil {
+				return err
+			}
+		}
+		if err := code.apply(tx, &license); err != nil {
+			return err
+		}
+		return tx.Create(&ActivationRedemption{
+			CodeID:      code.ID,
+			Code:        code.Code,
+			LicenseID:   license.ID,
+			ContainerID: license.ContainerID,
+			InstanceID:  instanceID,
+			RequestIP:   requestIP,
+			Expire:      license.Expire,
+		}).Error
+	})
+	if err != nil {
+		if err == ErrCodeExhausted {
+			return nil, err
+		}
+		// 并发兑换时由唯一索引拒绝重复兑换
+		if exists && code.redeemed(license.ID) {
+			return nil, ErrCodeRedeemed
+		}
+		util.Log().Warning("无法兑换激活码, %s", err)
+		return nil, err
+	}
+	code.Redemptions++
+	return &license, nil
+}
+
+// redeemed 判断授权是否已兑换过此激活码
+func (code *ActivationCode) redeemed(licenseID uint64) bool {
+	var count int64
+	DB.Model(&ActivationRedemption{}).Where("code_id = ? AND license_id = ?", code.ID, licenseID).Count(&count)
+	return count > 0
+}
+
+// activates 判断兑换后授权是否可用：待审核及试用的授权转为正常，已过期的授权须由期限恢复
+func (code *ActivationCode) activates(license *License) bool {
+	switch license.Status {
+	case StatusActive, StatusPending, StatusTrial:
+		return true
+	case StatusExpired:
+		return code.Days > 0
+	}
+	return false
+}
+
+// apply 在兑换事务中为授权应用激活码的权益及客户并追加对应的期限，待审核或试用中的授权转为正常
+func (code *ActivationCode) apply(tx *gorm.DB, license *License) error {
+	if err := code.upgrade(tx, license); err != nil {
+		return err
+	}
+	if code.Days > 0 {
+		today := time.Now().Format(util.FORMAT_DATE_y4Md)
+		term := &LicenseTerm{Start: today, Plan: code.Plan, OrderRef: actcode.Format(code.Code)}
+		if !license.Expired() && license.Expire > today {
+			term.Start = license.Expire
+		}
+		start, _ := time.Parse(util.FORMAT_DATE_y4Md, term.Start)
+		term.End = start.AddDate(0, 0, code.Days).Format(util.FORMAT_DATE_y4Md)
+		if err := license.RenewTx(tx, term, nil); err != nil {
+			return err
+		}
+	}
+	if license.Status == StatusPending || license.Status == StatusTrial {
+		return license.TransitionTx(tx, StatusActive, "激活码兑换 "+actcode.Format(code.Code), nil)
+	}
+	return nil
+}
+
+// upgrade 激活码设置了权益或客户时覆盖授权原有的值，权益变化时递增载荷版本以通知客户端刷新
+func (code *ActivationCode) upgrade(tx *gorm.DB, license *License) error {
+	updates := make(map[string]interface{})
+	entitlement := len(code.Entitlement) > 0 && string(code.Entitlement) != string(license.Entitlement)
+	if entitlement {
+		updates["entitlement"] = code.Entitlement
+		updates["revision"] = gorm.Expr("revision + ?", 1)
+	}
+	if code.CustomerID != 0 && code.CustomerID != license.CustomerID {
+		updates["customer_id"] = code.CustomerID
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := tx.Model(&License{}).Where("id = ?", license.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	if entitlement {
+		license.Entitlement = code.Entitlement
+		license.Revision++
+	}
+	if code.CustomerID != 0 {
+		license.CustomerID = code.CustomerID
+	}
+	return nil
+}
+
+// GetActivationRedemptions 分页查询激活码兑换记录，code 为空时查询全部
+func GetActivationRedemptions(code string, page, size int) ([]ActivationRedemption, int64) {
+	var (
+		redemptions []ActivationRedemption
+		total       int64
+	)
+	dbChain := DB.Session(&gorm.Session{})
+	if code != "" {
+		normalized, _ := actcode.Normalize(code)
+		dbChain = dbChain.Where("code = ?", normalized)
+	}
+
+	// 计算总数用于分页
+	dbChain.Model(&ActivationRedemption{}).Count(&total)
+
+	// 查询记录
+	dbChain.Limit(size).Offset((page - 1) * size).Order("created_at desc").Find(&redemptions)
+
+	return redemptions, total
+}
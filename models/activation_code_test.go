@@ -0,0 +1,151 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/models/datatypes"
+	"github.com/zhouqiaokeji/server/pkg/actcode"
+)
+
+// newTestCode 生成一个激活码
+func newTestCode(t *testing.T, template *ActivationCode) *ActivationCode {
+	codes, err := CreateActivationCodes(template, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &codes[0]
+}
+
+// redemptionsOf 查询激活码的已兑换次数及兑换记录数
+func redemptionsOf(code *ActivationCode) (int, int64) {
+	var (
+		current ActivationCode
+		count   int64
+	)
+	DB.First(&current, code.ID)
+	DB.Model(&ActivationRedemption{}).Where("code_id = ?", code.ID).Count(&count)
+	return current.Redemptions, count
+}
+
+func TestCreateActivationCodes(t *testing.T) {
+	asserts := assert.New(t)
+	template := &ActivationCode{Batch: "TestCreateActivationCodes", Plan: "pro", MaxRedemptions: 1}
+	template.Creator = 7
+	codes, err := CreateActivationCodes(template, 3)
+	asserts.NoError(err)
+	asserts.Len(codes, 3)
+	for _, code := range codes {
+		stored, err := GetActivationCode(actcode.Format(code.Code))
+		asserts.NoError(err)
+		asserts.EqualValues(7, stored.Creator)
+		asserts.Equal("TestCreateActivationCodes", stored.Batch)
+	}
+}
+
+func TestActivationCode_Redeem(t *testing.T) {
+	asserts := assert.New(t)
+	code := newTestCode(t, &ActivationCode{Plan: "pro", Days: 30, MaxRedemptions: 2})
+	request := &License{Name: "redeem", ContainerID: "TestActivationCode_Redeem", Seats: 10, UsageCap: 1}
+
+	// 授权不存在时新建并启用，客户端提交的席位等字段不生效
+	license, err := code.Redeem(request, "instance", "127.0.0.1")
+	asserts.NoError(err)
+	asserts.Equal(StatusActive, license.Status)
+	asserts.Equal(day(30), license.Expire)
+	asserts.Zero(license.Seats)
+	asserts.Zero(license.UsageCap)
+	redemptions, count := redemptionsOf(code)
+	asserts.Equal(1, redemptions)
+	asserts.EqualValues(1, count)
+
+	// 同一授权不能重复兑换
+	_, err = code.Redeem(request, "instance", "127.0.0.1")
+	asserts.Equal(ErrCodeRedeemed, err)
+	asserts.Error(DB.Create(&ActivationRedemption{CodeID: code.ID, LicenseID: license.ID}).Error)
+
+	// 兑换次数用完
+	_, err = code.Redeem(&License{Name: "redeem", ContainerID: "TestActivationCode_Redeem_2"}, "instance", "")
+	asserts.NoError(err)
+	_, err = code.Redeem(&License{Name: "redeem", ContainerID: "TestActivationCode_Redeem_3"}, "instance", "")
+	asserts.Equal(ErrCodeExhausted, err)
+	redemptions, count = redemptionsOf(code)
+	asserts.Equal(2, redemptions)
+	asserts.EqualValues(2, count)
+}
+
+func TestActivationCode_RedeemExisting(t *testing.T) {
+	asserts := assert.New(t)
+	code := newTestCode(t, &ActivationCode{
+		Plan:           "pro",
+		Days:           30,
+		MaxRedemptions: 1,
+		Entitlement:    datatypes.JSON(`{"features":["pro"],"limits":{"users":50},"extras":null}`),
+		CustomerID:     77,
+	})
+	lic := newTestLicense(t, "TestActivationCode_RedeemExisting", StatusTrial)
+	asserts.NoError(lic.UpdateEntitlement(Entitlement{Features: []string{"basic"}}))
+
+	// 已存在的授权应用激活码的权益及客户，并递增载荷版本
+	license, err := code.Redeem(&License{Name: lic.Name, ContainerID: lic.ContainerID}, "instance", "")
+	asserts.NoError(err)
+	asserts.Equal(StatusActive, license.Status)
+	stored, _ := GetLicense(lic.ContainerID)
+	asserts.Equal([]string{"pro"}, stored.GetEntitlement().Features)
+	asserts.EqualValues(50, stored.GetEntitlement().Limits["users"])
+	asserts.EqualValues(77, stored.CustomerID)
+	asserts.Greater(stored.Revision, lic.Revision)
+	asserts.Equal(stored.Revision, license.Revision)
+}
+
+func TestActivationCode_RedeemRejected(t *testing.T) {
+	asserts := assert.New(t)
+	code := newTestCode(t, &ActivationCode{Plan: "pro", MaxRedemptions: 5})
+
+	// 兑换后仍不可用的授权不占用兑换次数
+	suspended := newTestLicense(t, "TestActivationCode_RedeemRejected_suspended", StatusActive)
+	asserts.NoError(suspended.Transition(StatusSuspended, "测试", nil))
+	expired := newTestLicense(t, "TestActivationCode_RedeemRejected_expired", StatusExpired)
+	for _, lic := range []*License{suspended, expired} {
+		_, err := code.Redeem(&License{Name: lic.Name, ContainerID: lic.ContainerID}, "instance", "")
+		asserts.Equal(ErrTransitionNotAllowed, err)
+	}
+	_, err := code.Redeem(&License{Name: "other", ContainerID: expired.ContainerID}, "instance", "")
+	asserts.Equal(ErrTransitionNotAllowed, err)
+
+	// 写入兑换记录失败时，占用的兑换次数及授权变更一同回滚
+	pending := newTestLicense(t, "TestActivationCode_RedeemRejected_pending", StatusPending)
+	conflict := &ActivationRedemption{CodeID: code.ID, LicenseID: pending.ID}
+	asserts.NoError(DB.Create(conflict).Error)
+	DB.Delete(conflict)
+	_, err = code.Redeem(&License{Name: pending.Name, ContainerID: pending.ContainerID}, "instance", "")
+	asserts.Error(err)
+	current, _ := GetLicense(pending.ContainerID)
+	asserts.Equal(StatusPending, current.Status)
+	histories, _ := GetLicenseHistories(pending.ContainerID, 1, 10)
+	asserts.Empty(histories)
+	DB.Unscoped().Delete(conflict)
+
+	redemptions, _ := redemptionsOf(code)
+	asserts.Zero(redemptions)
+}
+
+func TestLicense_CheckVerify(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newTestLicense(t, "TestLicense_CheckVerify", StatusPending)
+	request := &License{Name: lic.Name, ContainerID: lic.ContainerID}
+	asserts.NoError(lic.CheckVerify(request, "a", ""))
+
+	// 其他实例持有租约
+	asserts.NoError(lic.AcquireLease("a", false))
+	asserts.NoError(lic.CheckVerify(request, "a", ""))
+	asserts.Equal(ErrLeaseHeld, lic.CheckVerify(request, "b", ""))
+	expire := time.Now().Add(-leaseGrace() - time.Minute)
+	lic.LeaseExpire = &expire
+	asserts.NoError(lic.CheckVerify(request, "b", ""))
+
+	// 浮动授权须持有席位
+	asserts.NoError(lic.SetSeats(1))
+	asserts.Equal(ErrSeatRequired, lic.CheckVerify(request, "a", ""))
+}
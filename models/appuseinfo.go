@@ -2,9 +2,15 @@ package models
 
 import (
 	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
+// AppUseInfoNonceTTL 批量上报记录随机数的有效期，随机数随记录保存，
+// 汇总清理不会删除有效期内的记录，超出有效期的记录不再接受补报
+const AppUseInfoNonceTTL = 7 * 24 * time.Hour
+
 type AppUseInfo struct {
 	Auditable
 	Name         string  `json:"name"`
@@ -23,19 +29,140 @@ type AppUseInfo struct {
 	OSVersion    string  `json:"os_version"`
 	DeviceSN     string  `json:"device_sn"`
 	DeviceVendor string  `json:"device_vendor"`
+	// Nonce 未携带随机数的记录为 NULL，SQL Server 上的唯一索引由 migrateUseInfoNonceIndex 改为筛选索引
+	Nonce        *string `json:"-" gorm:"size:64;uniqueIndex"`
+	Day          string  `json:"-" gorm:"size:8;index"`
 }
 
 // Create 记录服务使用信息
 func (useInfo *AppUseInfo) Create() (uint64, error) {
+	useInfo.stamp()
 	if err := DB.Create(useInfo).Error; err != nil {
 		util.Log().Warning("无法插入服务使用记录, %s", err)
 		return 0, err
 	}
+	recordServerAddrs(useInfo.ServerAddr)
 	return useInfo.ID, nil
 }
 
-// GetAppUseInfoByServerAddr 获取指定服务地址使用信息
-func GetAppUseInfoByServerAddr(page, size int, order string, serverAddr []string, time []time.Time) ([]AppUseInfo, int64) {
+// stamp 按本地时间记录上报日期，用于各数据库通用的按日统计；未设置上报时间时使用当前时间
+func (useInfo *AppUseInfo) stamp() {
+	if useInfo.CreatedAt.IsZero() {
+		useInfo.CreatedAt = time.Now()
+	}
+	useInfo.Day = useInfo.CreatedAt.In(time.Local).Format(util.FORMAT_DATE_y4Md)
+}
+
+// migrateUseInfoDays 为旧版服务使用记录补齐上报日期，每次处理最早的一天
+func migrateUseInfoDays() {
+	for {
+		var oldest AppUseInfo
+		if err := DB.Unscoped().Where("day = ? OR day IS NULL", "").Order("created_at asc").Limit(1).Find(&oldest).Error; err != nil || oldest.ID == 0 {
+			return
+		}
+		t := oldest.CreatedAt.In(time.Local)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		result := DB.Unscoped().Model(&AppUseInfo{}).
+			Where("(day = ? OR day IS NULL) AND created_at >= ? AND created_at < ?", "", day, day.AddDate(0, 0, 1)).
+			Update("day", day.Format(util.FORMAT_DATE_y4Md))
+		if result.Error != nil || result.RowsAffected == 0 {
+			util.Log().Warning("无法补齐服务使用记录日期, %s", result.Error)
+			return
+		}
+	}
+}
+
+// migrateUseInfoNonceIndex SQL Server 的唯一索引只允许一个 NULL，将随机数索引改为仅包含非空值的筛选索引。
+// 须在 AutoMigrate 之前执行：已有记录补充随机数列后均为 NULL，AutoMigrate 创建普通唯一索引会失败；
+// 其他数据库的唯一索引允许多个 NULL，无需处理
+func migrateUseInfoNonceIndex() {
+	if DB.Dialector.Name() != "sqlserver" {
+		return
+	}
+	migrator := DB.Migrator()
+	if !migrator.HasTable(&AppUseInfo{}) {
+		if err := migrator.CreateTable(&AppUseInfo{}); err != nil {
+			util.Log().Warning("无法创建服务使用记录表, %s", err)
+			return
+		}
+	}
+	if !migrator.HasColumn(&AppUseInfo{}, "Nonce") {
+		if err := migrator.AddColumn(&AppUseInfo{}, "Nonce"); err != nil {
+			util.Log().Warning("无法添加服务使用记录随机数列, %s", err)
+			return
+		}
+	}
+
+	stmt := &gorm.Statement{DB: DB}
+	if err := stmt.Parse(&AppUseInfo{}); err != nil {
+		util.Log().Warning("无法解析服务使用记录, %s", err)
+		return
+	}
+	index := stmt.Schema.LookIndex("Nonce")
+	var filtered int64
+	DB.Raw("SELECT count(*) FROM sys.indexes WHERE name = ? AND object_id = OBJECT_ID(?) AND has_filter = 1",
+		index.Name, stmt.Table).Scan(&filtered)
+	if filtered > 0 {
+		return
+	}
+	if migrator.HasIndex(&AppUseInfo{}, index.Name) {
+		if err := migrator.DropIndex(&AppUseInfo{}, index.Name); err != nil {
+			util.Log().Warning("无法删除服务使用记录随机数索引, %s", err)
+			return
+		}
+	}
+	column := clause.Column{Name: index.Fields[0].DBName}
+	if err := DB.Exec("CREATE UNIQUE INDEX ? ON ? (?) WHERE ? IS NOT NULL",
+		clause.Column{Name: index.Name}, clause.Table{Name: stmt.Table}, column, column).Error; err != nil {
+		util.Log().Warning("无法创建服务使用记录随机数索引, %s", err)
+	}
+}
+
+// CreateAppUseInfos 在同一事务中批量记录服务使用信息，全部成功或全部失败；
+// 已设置 CreatedAt 的记录保留客户端上报时间。随机数已存在的记录不重复入库，
+// 返回与 useInfos 一一对应的重复标记
+func CreateAppUseInfos(useInfos []*AppUseInfo) ([]bool, error) {
+	duplicates := make([]bool, len(useInfos))
+	if len(useInfos) == 0 {
+		return duplicates, nil
+	}
+	for _, useInfo := range useInfos {
+		useInfo.stamp()
+	}
+	created := make(map[uint64]bool, len(useInfos))
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(useInfos, 100).Error; err != nil {
+			return err
+		}
+		ids := make([]uint64, 0, len(useInfos))
+		for _, useInfo := range useInfos {
+			ids = append(ids, useInfo.ID)
+		}
+		var inserted []uint64
+		if err := tx.Model(&AppUseInfo{}).Where("id IN ?", ids).Pluck("id", &inserted).Error; err != nil {
+			return err
+		}
+		for _, id := range inserted {
+			created[id] = true
+		}
+		return nil
+	})
+	if err != nil {
+		util.Log().Warning("无法批量插入服务使用记录, %s", err)
+		return nil, err
+	}
+	addrs := make([]string, 0, len(useInfos))
+	for i, useInfo := range useInfos {
+		if duplicates[i] = !created[useInfo.ID]; !duplicates[i] {
+			addrs = append(addrs, useInfo.ServerAddr)
+		}
+	}
+	recordServerAddrs(addrs...)
+	return duplicates, nil
+}
+
+// GetAppUseInfoByServerAddr 获取指定服务地址使用信息，offset 为跳过的条数，limit 为 0 时只统计总数
+func GetAppUseInfoByServerAddr(offset, limit int, order string, serverAddr []string, time []time.Time) ([]AppUseInfo, int64) {
 	var (
 		useInfos []AppUseInfo
 		total    int64
@@ -50,7 +177,9 @@ func GetAppUseInfoByServerAddr(page, size int, order string, serverAddr []string
 	dbChain.Model(&AppUseInfo{}).Count(&total)
 
 	// 查询记录
-	dbChain.Limit(size).Offset((page - 1) * size).Order(order).Find(&useInfos)
+	if limit > 0 {
+		dbChain.Limit(limit).Offset(offset).Order(order).Find(&useInfos)
+	}
 
 	return useInfos, total
 }
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"github.com/zhouqiaokeji/server/pkg/binding"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm/clause"
+	"net"
+	"strings"
+	"sync"
+)
+
+// AppServerAddr 已上报过的服务地址，随服务使用记录登记，汇总删除原始记录后仍保留；
+// Host 为从地址中提取的主机名或 IP，按绑定规则查找服务地址时无需扫描服务使用记录
+type AppServerAddr struct {
+	Auditable
+	Addr string `json:"addr" gorm:"size:255;uniqueIndex"`
+	Host string `json:"host" gorm:"size:255;index"`
+}
+
+// knownServerAddrs 本进程已登记的服务地址
+var knownServerAddrs sync.Map
+
+// recordServerAddrs 登记服务地址，已登记的地址跳过
+func recordServerAddrs(addrs ...string) {
+	for _, addr := range addrs {
+		if addr == "" {
+			continue
+		}
+		if _, ok := knownServerAddrs.Load(addr); ok {
+			continue
+		}
+		err := DB.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&AppServerAddr{Addr: addr, Host: binding.Host(addr)}).Error
+		if err != nil {
+			util.Log().Warning("无法登记服务地址, %s", err)
+			continue
+		}
+		knownServerAddrs.Store(addr, struct{}{})
+	}
+}
+
+// GetServerAddrsMatching 查询命中任一绑定规则的已上报服务地址，
+// 数据库按主机名筛选候选地址，再逐条精确匹配
+func GetServerAddrsMatching(rules []binding.Rule) []string {
+	var (
+		addrs   []AppServerAddr
+		matched []string
+	)
+	if len(rules) == 0 {
+		return nil
+	}
+	hosts := make([]string, 0, len(rules))
+	patterns := make([]string, 0)
+	for _, rule := range rules {
+		switch rule.Kind {
+		case binding.KindDomain:
+			hosts = append(hosts, rule.Value)
+		case binding.KindWildcard:
+			patterns = append(patterns, "%"+strings.TrimPrefix(rule.Value, "*"))
+		case binding.KindCIDR:
+			if _, network, err := net.ParseCIDR(rule.Value); err == nil {
+				if ones, bits := network.Mask.Size(); ones == bits {
+					hosts = append(hosts, network.IP.String())
+					continue
+				}
+				patterns = append(patterns, subnetPattern(network))
+			}
+		}
+	}
+	candidates := DB.Where("host IN ?", hosts)
+	for _, pattern := range patterns {
+		candidates = candidates.Or("host LIKE ?", pattern)
+	}
+	DB.Select("addr").Where(candidates).Find(&addrs)
+	for i := range addrs {
+		for _, rule := range rules {
+			if rule.Match(addrs[i].Addr) {
+				matched = append(matched, addrs[i].Addr)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// migrateServerAddrs 登记已有服务使用记录及汇总中的服务地址
+func migrateServerAddrs() {
+	var addrs, rolled []string
+	DB.Model(&AppUseInfo{}).Distinct("server_addr").Pluck("server_addr", &addrs)
+	DB.Model(&AppUseInfoRollup{}).Distinct("server_addr").Pluck("server_addr", &rolled)
+	recordServerAddrs(append(addrs, rolled...)...)
+}
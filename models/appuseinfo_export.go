@@ -0,0 +1,130 @@
+package models
+
+import (
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 服务使用记录导出状态
+const (
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+// AppUseInfoExport 服务使用记录导出审计，导出开始时记录，结束后更新导出条数及状态；
+// 导出中断时状态保持为失败并记录原因
+type AppUseInfoExport struct {
+	Auditable
+	ActorName   string     `json:"actor_name"`
+	RequestIP   string     `json:"request_ip"`
+	ContainerID string     `json:"containerId" gorm:"index"`
+	CustomerID  uint64     `json:"customer_id" gorm:"index"`
+	From        *time.Time `json:"from" gorm:"column:from_time"`
+	To          *time.Time `json:"to" gorm:"column:to_time"`
+	Format      string     `json:"format"`
+	Columns     string     `json:"columns"`
+	Rows        int64      `json:"rows"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// AppUseInfoRange 按服务地址及上报时间筛选服务使用记录，ServerAddrs 为 nil 时不限服务地址
+type AppUseInfoRange struct {
+	ServerAddrs []string
+	From        *time.Time
+	To          *time.Time
+}
+
+// Create 记录导出开始
+func (export *AppUseInfoExport) Create() error {
+	export.Status = ExportRunning
+	if err := DB.Create(export).Error; err != nil {
+		util.Log().Warning("无法插入导出记录, %s", err)
+		return err
+	}
+	return nil
+}
+
+// Finish 记录导出结束，err 不为空时标记为失败
+func (export *AppUseInfoExport) Finish(rows int64, err error) {
+	now := time.Now()
+	values := map[string]interface{}{"rows": rows, "status": ExportCompleted, "finished_at": now}
+	if err != nil {
+		values["status"] = ExportFailed
+		values["error"] = err.Error()
+	}
+	if dbErr := DB.Model(&AppUseInfoExport{}).Where("id = ?", export.ID).Updates(values).Error; dbErr != nil {
+		util.Log().Warning("无法更新导出记录, %s", dbErr)
+		return
+	}
+	export.Rows = rows
+	export.Status = values["status"].(string)
+	export.FinishedAt = &now
+}
+
+// GetAppUseInfoExports 分页查询导出记录，containerId 为空时查询全部
+func GetAppUseInfoExports(containerId string, page, size int) ([]AppUseInfoExport, int64) {
+	var (
+		exports []AppUseInfoExport
+		total   int64
+	)
+	dbChain := DB.Session(&gorm.Session{})
+	if containerId != "" {
+		dbChain = dbChain.Where("container_id = ?", containerId)
+	}
+
+	// 计算总数用于分页
+	dbChain.Model(&AppUseInfoExport{}).Count(&total)
+
+	// 查询记录
+	dbChain.Limit(size).Offset((page - 1) * size).Order("created_at desc").Find(&exports)
+
+	return exports, total
+}
+
+// EachAppUseInfoBatch 按 ID 升序分批读取范围内的服务使用记录，每批最多 size 条，
+// 以上一批最后一条记录的 ID 作为下一批的起点，内存占用与总条数无关；
+// columns 为需要读取的字段，为空时读取全部字段
+func EachAppUseInfoBatch(r *AppUseInfoRange, columns []string, size int, fn func(useInfos []AppUseInfo) error) error {
+	if r.ServerAddrs != nil && len(r.ServerAddrs) == 0 {
+		return nil
+	}
+	dbChain := DB.Model(&AppUseInfo{})
+	if len(columns) > 0 {
+		dbChain = dbChain.Select(append([]string{"id"}, columns...))
+	}
+	if r.ServerAddrs != nil {
+		dbChain = dbChain.Where("server_addr IN ?", r.ServerAddrs)
+	}
+	if r.From != nil {
+		dbChain = dbChain.Where("created_at >= ?", *r.From)
+	}
+	if r.To != nil {
+		dbChain = dbChain.Where("created_at <= ?", *r.To)
+	}
+
+	// 每批查询基于同一筛选条件派生，避免条件累加
+	dbChain = dbChain.Session(&gorm.Session{})
+	var lastID uint64
+	useInfos := make([]AppUseInfo, 0, size)
+	for {
+		useInfos = useInfos[:0]
+		if err := dbChain.Where("id > ?", lastID).Order("id asc").Limit(size).Find(&useInfos).Error; err != nil {
+			util.Log().Warning("无法查询服务使用记录, %s", err)
+			return err
+		}
+		if len(useInfos) == 0 {
+			return nil
+		}
+		if err := fn(useInfos); err != nil {
+			return err
+		}
+		if len(useInfos) < size {
+			return nil
+		}
+		lastID = useInfos[len(useInfos)-1].ID
+	}
+}
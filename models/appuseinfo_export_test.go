@@ -0,0 +1,107 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEachAppUseInfoBatch(t *testing.T) {
+	asserts := assert.New(t)
+	const addr = "export.useinfo.example"
+	base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.Local)
+	useInfos := make([]*AppUseInfo, 0)
+	for i := 0; i < 5; i++ {
+		useInfo := &AppUseInfo{ServerAddr: addr, DeviceSN: "export", Name: "name"}
+		useInfo.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		useInfos = append(useInfos, useInfo)
+	}
+	_, err := CreateAppUseInfos(useInfos)
+	asserts.NoError(err)
+
+	collect := func(r *AppUseInfoRange, columns []string, size int) ([]int, []AppUseInfo) {
+		var (
+			batches []int
+			all     []AppUseInfo
+		)
+		asserts.NoError(EachAppUseInfoBatch(r, columns, size, func(batch []AppUseInfo) error {
+			batches = append(batches, len(batch))
+			all = append(all, batch...)
+			return nil
+		}))
+		return batches, all
+	}
+	r := &AppUseInfoRange{ServerAddrs: []string{addr}}
+
+	// 跨批次按 ID 升序读取全部记录，不重复也不遗漏
+	batches, all := collect(r, nil, 2)
+	asserts.Equal([]int{2, 2, 1}, batches)
+	asserts.Len(all, 5)
+	for i := range all {
+		asserts.Equal(useInfos[i].ID, all[i].ID)
+	}
+	// 最后一批恰好满批时再查询一次后结束
+	batches, _ = collect(r, nil, 5)
+	asserts.Equal([]int{5}, batches)
+
+	// 只读取指定字段及 ID
+	_, all = collect(r, []string{"device_sn"}, 10)
+	asserts.Len(all, 5)
+	asserts.Equal("export", all[0].DeviceSN)
+	asserts.Empty(all[0].Name)
+	asserts.NotZero(all[0].ID)
+
+	// 时间范围
+	from, to := base.Add(time.Hour), base.Add(3*time.Hour)
+	_, all = collect(&AppUseInfoRange{ServerAddrs: []string{addr}, From: &from, To: &to}, nil, 2)
+	asserts.Len(all, 3)
+	asserts.Equal(useInfos[1].ID, all[0].ID)
+
+	// 服务地址范围为空
+	batches, _ = collect(&AppUseInfoRange{ServerAddrs: []string{}}, nil, 2)
+	asserts.Empty(batches)
+
+	// 回调出错时中断
+	calls := 0
+	err = EachAppUseInfoBatch(r, nil, 2, func(batch []AppUseInfo) error {
+		calls++
+		return errors.New("写出失败")
+	})
+	asserts.Error(err)
+	asserts.Equal(1, calls)
+}
+
+func TestAppUseInfoExport_Finish(t *testing.T) {
+	asserts := assert.New(t)
+	reload := func(export *AppUseInfoExport) AppUseInfoExport {
+		var res AppUseInfoExport
+		asserts.NoError(DB.First(&res, export.ID).Error)
+		return res
+	}
+
+	export := &AppUseInfoExport{ContainerID: "TestAppUseInfoExport", Format: "csv", Columns: "id"}
+	asserts.NoError(export.Create())
+	asserts.Equal(ExportRunning, reload(export).Status)
+
+	export.Finish(3, nil)
+	saved := reload(export)
+	asserts.Equal(ExportCompleted, saved.Status)
+	asserts.EqualValues(3, saved.Rows)
+	asserts.NotNil(saved.FinishedAt)
+	asserts.Empty(saved.Error)
+
+	// 导出中断时标记为失败并记录原因
+	failed := &AppUseInfoExport{ContainerID: "TestAppUseInfoExport", Format: "ndjson"}
+	asserts.NoError(failed.Create())
+	failed.Finish(1, errors.New("连接已断开"))
+	saved = reload(failed)
+	asserts.Equal(ExportFailed, saved.Status)
+	asserts.EqualValues(1, saved.Rows)
+	asserts.Equal("连接已断开", saved.Error)
+
+	exports, total := GetAppUseInfoExports("TestAppUseInfoExport", 1, 10)
+	asserts.EqualValues(2, total)
+	asserts.Len(exports, 2)
+}
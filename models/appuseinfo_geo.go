@@ -0,0 +1,121 @@
+package models
+
+import (
+	"github.com/zhouqiaokeji/server/pkg/geo"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"time"
+)
+
+// GeoFilter 服务上报位置筛选条件，ServerAddrs 为 nil 时不限服务地址；
+// 指定 Center 时筛选以其为圆心、Radius 米为半径的范围，否则按 Box 筛选，均未指定时不限位置
+type GeoFilter struct {
+	ServerAddrs []string
+	From        *time.Time
+	To          *time.Time
+	Box         *geo.Box
+	Center      *geo.Point
+	Radius      float64
+}
+
+// Point 返回上报位置
+func (useInfo *AppUseInfo) Point() geo.Point {
+	return geo.Point{Lon: float64(useInfo.LON), Lat: float64(useInfo.LAT)}
+}
+
+// geoOrder 位置查询按上报时间倒序，同一时间按记录ID倒序以保证分页稳定
+const geoOrder = "created_at desc, id desc"
+
+// query 按筛选条件构建查询，未上报位置（经纬度均为 0）的记录不参与；
+// 圆形范围按外接矩形预筛选，服务地址范围为空时返回 nil
+func (filter *GeoFilter) query() *gorm.DB {
+	if filter.ServerAddrs != nil && len(filter.ServerAddrs) == 0 {
+		return nil
+	}
+	dbChain := DB.Model(&AppUseInfo{}).Where("NOT (lon = 0 AND lat = 0)")
+	if filter.ServerAddrs != nil {
+		dbChain = dbChain.Where("server_addr IN ?", filter.ServerAddrs)
+	}
+	if filter.From != nil {
+		dbChain = dbChain.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		dbChain = dbChain.Where("created_at <= ?", *filter.To)
+	}
+	box := filter.Box
+	if filter.Center != nil {
+		around := geo.BoxAround(*filter.Center, filter.Radius)
+		box = &around
+	}
+	if box != nil {
+		dbChain = dbChain.Where("lat BETWEEN ? AND ?", box.MinLat, box.MaxLat)
+		if box.CrossesAntimeridian() {
+			dbChain = dbChain.Where("(lon >= ? OR lon <= ?)", box.MinLon, box.MaxLon)
+		} else {
+			dbChain = dbChain.Where("lon BETWEEN ? AND ?", box.MinLon, box.MaxLon)
+		}
+	}
+	return dbChain
+}
+
+// GetAppUseInfosInArea 按上报时间倒序分页查询位置在筛选范围内的服务上报记录；
+// 矩形范围由数据库计数及分页，圆形范围只对外接矩形内的候选记录按球面距离过滤
+func GetAppUseInfosInArea(filter *GeoFilter, page, size int) ([]AppUseInfo, int64, error) {
+	var (
+		useInfos = make([]AppUseInfo, 0)
+		total    int64
+	)
+	if filter.Center != nil {
+		start := int64((page - 1) * size)
+		err := EachAppUseInfoInArea(filter, func(useInfo *AppUseInfo) error {
+			total++
+			if total > start && len(useInfos) < size {
+				useInfos = append(useInfos, *useInfo)
+			}
+			return nil
+		})
+		return useInfos, total, err
+	}
+
+	dbChain := filter.query()
+	if dbChain == nil {
+		return useInfos, 0, nil
+	}
+	if err := dbChain.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		util.Log().Warning("无法查询服务使用记录, %s", err)
+		return nil, 0, err
+	}
+	if err := dbChain.Order(geoOrder).Limit(size).Offset((page - 1) * size).Find(&useInfos).Error; err != nil {
+		util.Log().Warning("无法查询服务使用记录, %s", err)
+		return nil, 0, err
+	}
+	return useInfos, total, nil
+}
+
+// EachAppUseInfoInArea 按上报时间倒序逐条读取位置在筛选范围内的服务上报记录，
+// 未上报位置（经纬度均为 0）的记录不参与；数据库按矩形范围预筛选，圆形范围再按球面距离过滤
+func EachAppUseInfoInArea(filter *GeoFilter, fn func(useInfo *AppUseInfo) error) error {
+	dbChain := filter.query()
+	if dbChain == nil {
+		return nil
+	}
+	rows, err := dbChain.Order(geoOrder).Rows()
+	if err != nil {
+		util.Log().Warning("无法查询服务使用记录, %s", err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var useInfo AppUseInfo
+		if err = DB.ScanRows(rows, &useInfo); err != nil {
+			return err
+		}
+		if filter.Center != nil && geo.Distance(*filter.Center, useInfo.Point()) > filter.Radius {
+			continue
+		}
+		if err = fn(&useInfo); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
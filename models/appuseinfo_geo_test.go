@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/geo"
+)
+
+func TestGetAppUseInfosInArea(t *testing.T) {
+	asserts := assert.New(t)
+	const addr = "geo.useinfo.example"
+	base := time.Date(2026, 4, 1, 12, 0, 0, 0, time.Local)
+	useInfos := make([]*AppUseInfo, 0)
+	for i, lon := range []float32{116.40, 116.41, 116.42, 116.50, 0} {
+		useInfo := &AppUseInfo{ServerAddr: addr, DeviceSN: "geo", LON: lon}
+		if lon != 0 {
+			useInfo.LAT = 39.90
+		}
+		useInfo.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		useInfos = append(useInfos, useInfo)
+	}
+	_, err := CreateAppUseInfos(useInfos)
+	asserts.NoError(err)
+
+	// 矩形范围由数据库分页，按上报时间倒序，未上报位置的记录不参与
+	filter := &GeoFilter{ServerAddrs: []string{addr}, Box: &geo.Box{MinLon: 116, MinLat: 39, MaxLon: 117, MaxLat: 40}}
+	page, total, err := GetAppUseInfosInArea(filter, 1, 3)
+	asserts.NoError(err)
+	asserts.EqualValues(4, total)
+	asserts.Len(page, 3)
+	asserts.Equal(useInfos[3].ID, page[0].ID)
+	page, total, err = GetAppUseInfosInArea(filter, 2, 3)
+	asserts.NoError(err)
+	asserts.EqualValues(4, total)
+	asserts.Len(page, 1)
+	asserts.Equal(useInfos[0].ID, page[0].ID)
+
+	// 时间范围
+	to := base.Add(90 * time.Minute)
+	filter.To = &to
+	_, total, err = GetAppUseInfosInArea(filter, 1, 3)
+	asserts.NoError(err)
+	asserts.EqualValues(2, total)
+	filter.To = nil
+
+	// 圆形范围按球面距离过滤外接矩形内的候选记录
+	filter = &GeoFilter{ServerAddrs: []string{addr}, Center: &geo.Point{Lon: 116.40, Lat: 39.90}, Radius: 1000}
+	page, total, err = GetAppUseInfosInArea(filter, 1, 1)
+	asserts.NoError(err)
+	asserts.EqualValues(2, total)
+	asserts.Len(page, 1)
+	asserts.Equal(useInfos[1].ID, page[0].ID)
+
+	// 服务地址范围为空
+	page, total, err = GetAppUseInfosInArea(&GeoFilter{ServerAddrs: []string{}}, 1, 3)
+	asserts.NoError(err)
+	asserts.EqualValues(0, total)
+	asserts.Empty(page)
+}
@@ -0,0 +1,268 @@
+package models
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppUseInfoRollup 超出保留期的服务使用记录按日汇总，同一天内服务地址、设备、终端用户、
+// 版本、平台、系统版本及设备厂商均相同的记录汇总为一条，其余字段保留当天最后一次上报的值
+type AppUseInfoRollup struct {
+	Auditable
+	Day          string    `json:"day" gorm:"size:8;uniqueIndex:idx_use_info_rollup"`
+	Digest       string    `json:"-" gorm:"size:40;uniqueIndex:idx_use_info_rollup"`
+	ServerAddr   string    `json:"server_addr" gorm:"index"`
+	DeviceSN     string    `json:"device_sn"`
+	UserId       int64     `json:"user_id"`
+	Version      string    `json:"version"`
+	Platform     string    `json:"platform"`
+	OSVersion    string    `json:"os_version"`
+	DeviceVendor string    `json:"device_vendor"`
+	Name         string    `json:"name"`
+	Mobile       string    `json:"mobile"`
+	UserName     string    `json:"user_name"`
+	RequestIp    string    `json:"request_ip"`
+	LON          float32   `json:"lon"`
+	LAT          float32   `json:"lat"`
+	CheckIns     int64     `json:"check_ins"`
+	FirstAt      time.Time `json:"first_at"`
+	LastAt       time.Time `json:"last_at"`
+}
+
+// retentionScope 同一保留期的服务地址范围，exclude 为 true 时表示 addrs 以外的全部地址
+type retentionScope struct {
+	addrs   []string
+	exclude bool
+	cutoff  time.Time
+}
+
+// SetRetention 设置授权服务使用记录的保留天数，为 0 时使用全局配置
+func (lic *License) SetRetention(days int) error {
+	if err := DB.Model(&License{}).Where("id = ?", lic.ID).Update("retention", days).Error; err != nil {
+		util.Log().Warning("无法设置授权记录保留期, %s", err)
+		return err
+	}
+	lic.Retention = days
+	return nil
+}
+
+// RetentionOf 返回授权服务使用记录的保留天数，为 0 时不清理
+func (lic *License) RetentionOf() int {
+	if lic.Retention > 0 {
+		return lic.Retention
+	}
+	return conf.LicenseConfig.UseInfoRetention
+}
+
+// retentionCutoff 返回保留期对应的清理截止时间，随机数有效期内的记录始终保留，以便补报记录去重
+func retentionCutoff(today time.Time, days int) time.Time {
+	cutoff := today.AddDate(0, 0, -days)
+	if floor := today.Add(-AppUseInfoNonceTTL); floor.Before(cutoff) {
+		return floor
+	}
+	return cutoff
+}
+
+// RollupAppUseInfos 将超出保留期的服务使用记录按日汇总后删除。设置了保留期的授权按各自保留期处理，
+// 服务地址同时命中多个授权时取最长的保留期，其余地址按全局保留期处理；返回删除的记录数
+func RollupAppUseInfos(now time.Time) (int64, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	var licenses []License
+	DB.Where("retention > 0").Find(&licenses)
+	retention := make(map[string]int)
+	for i := range licenses {
+		for _, addr := range GetServerAddrsMatching(licenses[i].BindingRules()) {
+			if licenses[i].Retention > retention[addr] {
+				retention[addr] = licenses[i].Retention
+			}
+		}
+	}
+
+	scopes := make([]retentionScope, 0)
+	groups := make(map[int][]string)
+	addrs := make([]string, 0, len(retention))
+	for addr, days := range retention {
+		groups[days] = append(groups[days], addr)
+		addrs = append(addrs, addr)
+	}
+	for days, group := range groups {
+		scopes = append(scopes, retentionScope{addrs: group, cutoff: retentionCutoff(today, days)})
+	}
+	if days := conf.LicenseConfig.UseInfoRetention; days > 0 {
+		scopes = append(scopes, retentionScope{addrs: addrs, exclude: true, cutoff: retentionCutoff(today, days)})
+	}
+
+	var total int64
+	for _, scope := range scopes {
+		for {
+			// 每次处理最早的一天，跳过没有记录的日期
+			var oldest AppUseInfo
+			err := scope.apply(DB.Unscoped().Where("created_at < ?", scope.cutoff)).
+				Order("created_at asc").Limit(1).Find(&oldest).Error
+			if err != nil {
+				return total, err
+			}
+			if oldest.ID == 0 {
+				break
+			}
+			t := oldest.CreatedAt.In(time.Local)
+			day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+			end := day.AddDate(0, 0, 1)
+			if end.After(scope.cutoff) {
+				end = scope.cutoff
+			}
+			deleted, err := rollupDay(&scope, day, end)
+			if err != nil {
+				return total, err
+			}
+			if deleted == 0 {
+				break
+			}
+			total += deleted
+		}
+	}
+	return total, nil
+}
+
+// apply 为查询添加服务地址条件
+func (scope *retentionScope) apply(tx *gorm.DB) *gorm.DB {
+	if len(scope.addrs) == 0 {
+		return tx
+	}
+	if scope.exclude {
+		return tx.Where("server_addr NOT IN ?", scope.addrs)
+	}
+	return tx.Where("server_addr IN ?", scope.addrs)
+}
+
+// rollupDay 在同一事务中将 [day, end) 内的记录合并到当天的汇总并删除，已软删除的记录不计入汇总
+func rollupDay(scope *retentionScope, day, end time.Time) (int64, error) {
+	dayValue := day.Format(util.FORMAT_DATE_y4Md)
+	var deleted int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		rollups := make(map[string]*AppUseInfoRollup)
+		rows, err := scope.apply(tx.Model(&AppUseInfo{}).Where("created_at >= ? AND created_at < ?", day, end)).
+			Order("created_at asc").Rows()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var useInfo AppUseInfo
+			if err = tx.ScanRows(rows, &useInfo); err != nil {
+				rows.Close()
+				return err
+			}
+			digest := rollupDigest(&useInfo)
+			rollup, ok := rollups[digest]
+			if !ok {
+				rollup = &AppUseInfoRollup{
+					Day:          dayValue,
+					Digest:       digest,
+					ServerAddr:   useInfo.ServerAddr,
+					DeviceSN:     useInfo.DeviceSN,
+					UserId:       useInfo.UserId,
+					Version:      useInfo.Version,
+					Platform:     useInfo.Platform,
+					OSVersion:    useInfo.OSVersion,
+					DeviceVendor: useInfo.DeviceVendor,
+					FirstAt:      useInfo.CreatedAt,
+				}
+				rollups[digest] = rollup
+			}
+			rollup.CheckIns++
+			rollup.LastAt = useInfo.CreatedAt
+			rollup.Name = useInfo.Name
+			rollup.Mobile = useInfo.Mobile
+			rollup.UserName = useInfo.UserName
+			rollup.RequestIp = useInfo.RequestIp
+			rollup.LON = useInfo.LON
+			rollup.LAT = useInfo.LAT
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, rollup := range rollups {
+			if err = mergeRollup(tx, rollup); err != nil {
+				return err
+			}
+		}
+		result := scope.apply(tx.Unscoped().Where("created_at >= ? AND created_at < ?", day, end)).Delete(&AppUseInfo{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		util.Log().Warning("无法汇总服务使用记录, %s", err)
+	}
+	return deleted, err
+}
+
+// mergeRollup 合并到当天已有的汇总，保留期内延迟上报的记录在之后的汇总中累加
+func mergeRollup(tx *gorm.DB, rollup *AppUseInfoRollup) error {
+	var existing AppUseInfoRollup
+	err := tx.Where("day = ? AND digest = ?", rollup.Day, rollup.Digest).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(rollup).Error
+	}
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{"check_ins": existing.CheckIns + rollup.CheckIns}
+	if rollup.FirstAt.Before(existing.FirstAt) {
+		values["first_at"] = rollup.FirstAt
+	}
+	if rollup.LastAt.After(existing.LastAt) {
+		values["last_at"] = rollup.LastAt
+		values["name"] = rollup.Name
+		values["mobile"] = rollup.Mobile
+		values["user_name"] = rollup.UserName
+		values["request_ip"] = rollup.RequestIp
+		values["lon"] = rollup.LON
+		values["lat"] = rollup.LAT
+	}
+	return tx.Model(&existing).Updates(values).Error
+}
+
+// rollupDigest 汇总维度的摘要，用于唯一索引，避免多列索引超出数据库的索引长度限制
+func rollupDigest(useInfo *AppUseInfo) string {
+	sum := sha1.Sum([]byte(strings.Join([]string{
+		useInfo.ServerAddr, useInfo.DeviceSN, strconv.FormatInt(useInfo.UserId, 10),
+		useInfo.Version, useInfo.Platform, useInfo.OSVersion, useInfo.DeviceVendor,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetAppUseInfoRollups 按日期查询指定服务地址的汇总记录，asc 为 true 时正序，否则倒序；
+// offset 为跳过的条数，limit 为 0 时只统计总数
+func GetAppUseInfoRollups(offset, limit int, asc bool, serverAddr []string, time []time.Time) ([]AppUseInfoRollup, int64) {
+	var (
+		rollups []AppUseInfoRollup
+		total   int64
+	)
+	dbChain := DB.Session(&gorm.Session{}).Where("server_addr in (?)", serverAddr)
+	if len(time) == 2 {
+		dbChain = dbChain.Where("day BETWEEN ? AND ?", time[0].Format(util.FORMAT_DATE_y4Md), time[1].Format(util.FORMAT_DATE_y4Md))
+	}
+
+	// 计算总数用于分页
+	dbChain.Model(&AppUseInfoRollup{}).Count(&total)
+
+	// 查询记录
+	if limit > 0 {
+		order := "day desc, last_at desc"
+		if asc {
+			order = "day asc, last_at asc"
+		}
+		dbChain.Limit(limit).Offset(offset).Order(order).Find(&rollups)
+	}
+
+	return rollups, total
+}
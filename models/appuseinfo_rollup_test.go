@@ -0,0 +1,124 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+)
+
+func TestRollupAppUseInfos(t *testing.T) {
+	asserts := assert.New(t)
+	retention := conf.LicenseConfig.UseInfoRetention
+	defer func() { conf.LicenseConfig.UseInfoRetention = retention }()
+	conf.LicenseConfig.UseInfoRetention = 30
+
+	const (
+		global = "global.rollup.test"
+		kept   = "kept.rollup.test"
+	)
+	// 使用远早于其他测试数据的日期，避免全局保留期汇总其他测试的记录
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local)
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2020, month, day, hour, 0, 0, 0, time.Local)
+	}
+	useInfo := func(addr string, created time.Time, device string, name string) *AppUseInfo {
+		useInfo := &AppUseInfo{ServerAddr: addr, DeviceSN: device, UserId: 1, Name: name}
+		useInfo.CreatedAt = created
+		return useInfo
+	}
+	deleted := useInfo(global, at(4, 20, 12), "B", "deleted")
+	_, err := CreateAppUseInfos([]*AppUseInfo{
+		useInfo(global, at(4, 20, 10), "A", "first"),
+		useInfo(global, at(4, 20, 11), "A", "last"),
+		deleted,
+		useInfo(global, at(5, 25, 10), "A", "recent"),
+		useInfo(kept, at(4, 20, 10), "A", "kept"),
+		useInfo(kept, at(3, 20, 10), "A", "expired"),
+	})
+	asserts.NoError(err)
+	asserts.NoError(DB.Delete(deleted).Error)
+
+	// 授权单独设置更长的保留期
+	lic := newTestLicense(t, "TestRollupAppUseInfos", StatusActive)
+	asserts.NoError(lic.AddBindings(rules(t, kept)))
+	asserts.NoError(lic.SetRetention(60))
+
+	// 当天已有的汇总
+	asserts.NoError(DB.Create(&AppUseInfoRollup{
+		Day:        "20200420",
+		Digest:     rollupDigest(&AppUseInfo{ServerAddr: global, DeviceSN: "A", UserId: 1}),
+		ServerAddr: global,
+		DeviceSN:   "A",
+		UserId:     1,
+		Name:       "existing",
+		CheckIns:   3,
+		FirstAt:    at(4, 20, 9),
+		LastAt:     time.Date(2020, 4, 20, 9, 30, 0, 0, time.Local),
+	}).Error)
+
+	filter := &ActivityFilter{ServerAddrs: []string{global, kept}, From: at(3, 1, 0), To: at(5, 31, 23)}
+	before, err := GetActivityStats(filter, PeriodMonth, "")
+	asserts.NoError(err)
+
+	deletedRows, err := RollupAppUseInfos(now)
+	asserts.NoError(err)
+	asserts.EqualValues(4, deletedRows)
+
+	// 全局保留期内及授权保留期内的原始记录保留
+	var remaining []string
+	DB.Model(&AppUseInfo{}).Where("server_addr IN ?", []string{global, kept}).Order("name").Pluck("name", &remaining)
+	asserts.Equal([]string{"kept", "recent"}, remaining)
+	var softDeleted int64
+	DB.Unscoped().Model(&AppUseInfo{}).Where("id = ?", deleted.ID).Count(&softDeleted)
+	asserts.EqualValues(0, softDeleted)
+
+	// 合并到已有汇总，已软删除的记录不计入
+	rollups, total := GetAppUseInfoRollups(0, 10, false, []string{global}, nil)
+	asserts.EqualValues(1, total)
+	asserts.EqualValues(5, rollups[0].CheckIns)
+	asserts.Equal(at(4, 20, 9), rollups[0].FirstAt.In(time.Local))
+	asserts.Equal(at(4, 20, 11), rollups[0].LastAt.In(time.Local))
+	asserts.Equal("last", rollups[0].Name)
+	rollups, total = GetAppUseInfoRollups(0, 10, false, []string{kept}, nil)
+	asserts.EqualValues(1, total)
+	asserts.Equal("20200320", rollups[0].Day)
+	asserts.EqualValues(1, rollups[0].CheckIns)
+
+	// 汇总前后的统计一致，原始记录与汇总不重复计数
+	after, err := GetActivityStats(filter, PeriodMonth, "")
+	asserts.NoError(err)
+	asserts.Equal(before, after)
+
+	// 重复执行不再处理
+	deletedRows, err = RollupAppUseInfos(now)
+	asserts.NoError(err)
+	asserts.EqualValues(0, deletedRows)
+}
+
+func TestGetAppUseInfoRollups(t *testing.T) {
+	asserts := assert.New(t)
+	const addr = "order.rollup.test"
+	for _, day := range []string{"20200102", "20200101", "20200103"} {
+		asserts.NoError(DB.Create(&AppUseInfoRollup{Day: day, Digest: "order-" + day, ServerAddr: addr, CheckIns: 1}).Error)
+	}
+
+	days := func(rollups []AppUseInfoRollup) []string {
+		res := make([]string, 0, len(rollups))
+		for _, rollup := range rollups {
+			res = append(res, rollup.Day)
+		}
+		return res
+	}
+	rollups, total := GetAppUseInfoRollups(0, 2, false, []string{addr}, nil)
+	asserts.EqualValues(3, total)
+	asserts.Equal([]string{"20200103", "20200102"}, days(rollups))
+	rollups, _ = GetAppUseInfoRollups(1, 2, true, []string{addr}, nil)
+	asserts.Equal([]string{"20200102", "20200103"}, days(rollups))
+
+	// limit 为 0 时只统计总数
+	rollups, total = GetAppUseInfoRollups(0, 0, true, []string{addr}, nil)
+	asserts.EqualValues(3, total)
+	asserts.Empty(rollups)
+}
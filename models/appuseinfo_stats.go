@@ -0,0 +1,190 @@
+package models
+
+import (
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+// 活跃统计周期
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// ErrUnknownDimension 不支持的拆分维度
+var ErrUnknownDimension = errors.New("不支持的统计维度")
+
+// ActivityDimensions 活跃统计支持的拆分维度及对应字段
+var ActivityDimensions = map[string]string{
+	"platform":      "platform",
+	"version":       "version",
+	"os_version":    "os_version",
+	"device_vendor": "device_vendor",
+}
+
+// ActivityFilter 活跃统计筛选条件，ServerAddrs 为 nil 时统计全部服务地址
+type ActivityFilter struct {
+	ServerAddrs []string
+	From        time.Time
+	To          time.Time
+}
+
+// ActivityStat 统计周期内的活跃设备数、活跃终端用户数及上报次数，
+// Period 为周期起始日期，周以周一为起始；Value 为拆分维度的取值，不拆分时为空
+type ActivityStat struct {
+	Period   string `json:"period"`
+	Value    string `json:"value"`
+	Devices  int64  `json:"devices"`
+	Users    int64  `json:"users"`
+	CheckIns int64  `json:"check_ins"`
+}
+
+// activity 单日内同一设备、终端用户及维度取值的活跃记录，CheckIns 为当天的上报次数
+type activity struct {
+	Day      string
+	DeviceSN string
+	UserId   int64
+	Value    string
+	CheckIns int64
+}
+
+// activityBucket 统计周期内按维度取值汇总的活跃数据
+type activityBucket struct {
+	stat    ActivityStat
+	devices map[string]struct{}
+	users   map[int64]struct{}
+}
+
+// activityAggregator 按统计周期及维度取值汇总活跃记录，去重集合只保留在各周期内
+type activityAggregator struct {
+	period  string
+	buckets map[[2]string]*activityBucket
+}
+
+// GetActivityStats 按统计周期汇总活跃设备及终端用户，dimension 为空时不拆分，
+// 同时读取原始记录及超出保留期后的按日汇总。
+// 各数据库的日期函数及时区处理不一致，数据库按记录中的本地日期分组，
+// 每天每个设备、终端用户及维度取值只返回一行，跨天的周期在逐行读取时合并去重
+func GetActivityStats(filter *ActivityFilter, period, dimension string) ([]ActivityStat, error) {
+	column := ""
+	if dimension != "" {
+		var ok bool
+		if column, ok = ActivityDimensions[dimension]; !ok {
+			return nil, ErrUnknownDimension
+		}
+	}
+	aggregator := newActivityAggregator(period)
+	if filter.ServerAddrs != nil && len(filter.ServerAddrs) == 0 {
+		return aggregator.stats(), nil
+	}
+
+	// 超出保留期的记录已汇总并删除，从按日汇总中读取
+	for _, source := range []struct {
+		model    interface{}
+		checkIns string
+	}{
+		{&AppUseInfo{}, "COUNT(*)"},
+		{&AppUseInfoRollup{}, "SUM(check_ins)"},
+	} {
+		if err := aggregateDays(aggregator, DB.Model(source.model), filter, column, source.checkIns); err != nil {
+			util.Log().Warning("无法查询服务使用记录, %s", err)
+			return nil, err
+		}
+	}
+	return aggregator.stats(), nil
+}
+
+// aggregateDays 按日、设备、终端用户及维度取值分组查询日期范围内的记录并计入活跃统计
+func aggregateDays(aggregator *activityAggregator, dbChain *gorm.DB, filter *ActivityFilter, column, checkIns string) error {
+	group := "day, device_sn, user_id"
+	if column != "" {
+		group += ", " + column
+	}
+	dbChain = dbChain.Select(group+", "+checkIns).
+		Where("day BETWEEN ? AND ?", filter.From.Format(util.FORMAT_DATE_y4Md), filter.To.Format(util.FORMAT_DATE_y4Md)).
+		Group(group)
+	if filter.ServerAddrs != nil {
+		dbChain = dbChain.Where("server_addr IN ?", filter.ServerAddrs)
+	}
+	rows, err := dbChain.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item activity
+		dest := []interface{}{&item.Day, &item.DeviceSN, &item.UserId}
+		if column != "" {
+			dest = append(dest, &item.Value)
+		}
+		if err = rows.Scan(append(dest, &item.CheckIns)...); err != nil {
+			return err
+		}
+		aggregator.add(&item)
+	}
+	return rows.Err()
+}
+
+func newActivityAggregator(period string) *activityAggregator {
+	return &activityAggregator{period: period, buckets: make(map[[2]string]*activityBucket)}
+}
+
+// add 将活跃记录计入对应周期及维度取值
+func (a *activityAggregator) add(item *activity) {
+	at, err := time.ParseInLocation(util.FORMAT_DATE_y4Md, item.Day, time.Local)
+	if err != nil {
+		return
+	}
+	key := [2]string{PeriodStart(at, a.period), item.Value}
+	bucket, ok := a.buckets[key]
+	if !ok {
+		bucket = &activityBucket{
+			stat:    ActivityStat{Period: key[0], Value: key[1]},
+			devices: make(map[string]struct{}),
+			users:   make(map[int64]struct{}),
+		}
+		a.buckets[key] = bucket
+	}
+	bucket.stat.CheckIns += item.CheckIns
+	if item.DeviceSN != "" {
+		bucket.devices[item.DeviceSN] = struct{}{}
+	}
+	if item.UserId != 0 {
+		bucket.users[item.UserId] = struct{}{}
+	}
+}
+
+// stats 返回按周期及维度取值排序的统计结果
+func (a *activityAggregator) stats() []ActivityStat {
+	res := make([]ActivityStat, 0, len(a.buckets))
+	for _, bucket := range a.buckets {
+		bucket.stat.Devices = int64(len(bucket.devices))
+		bucket.stat.Users = int64(len(bucket.users))
+		res = append(res, bucket.stat)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Period != res[j].Period {
+			return res[i].Period < res[j].Period
+		}
+		return res[i].Value < res[j].Value
+	})
+	return res
+}
+
+// PeriodStart 返回时间所在统计周期的起始日期（本地时间）
+func PeriodStart(t time.Time, period string) string {
+	t = t.In(time.Local)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	switch period {
+	case PeriodWeek:
+		// 周一为一周的第一天
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case PeriodMonth:
+		day = day.AddDate(0, 0, 1-day.Day())
+	}
+	return day.Format(util.FORMAT_DATE_y4Md)
+}
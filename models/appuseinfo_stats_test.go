@@ -0,0 +1,126 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodStart(t *testing.T) {
+	asserts := assert.New(t)
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.Local)
+	}
+
+	asserts.Equal("20260308", PeriodStart(at(2026, 3, 8, 23), PeriodDay))
+
+	// 周一为一周的第一天，周日归入前一周
+	asserts.Equal("20260302", PeriodStart(at(2026, 3, 2, 0), PeriodWeek))
+	asserts.Equal("20260302", PeriodStart(at(2026, 3, 8, 23), PeriodWeek))
+	asserts.Equal("20260309", PeriodStart(at(2026, 3, 9, 0), PeriodWeek))
+	// 跨年的周
+	asserts.Equal("20261228", PeriodStart(at(2027, 1, 1, 12), PeriodWeek))
+	asserts.Equal("20261228", PeriodStart(at(2027, 1, 3, 12), PeriodWeek))
+
+	asserts.Equal("20260301", PeriodStart(at(2026, 3, 31, 23), PeriodMonth))
+	asserts.Equal("20270101", PeriodStart(at(2027, 1, 1, 0), PeriodMonth))
+}
+
+func TestActivityAggregator(t *testing.T) {
+	asserts := assert.New(t)
+	aggregator := newActivityAggregator(PeriodWeek)
+	for _, item := range []activity{
+		{Day: "20260302", DeviceSN: "A", UserId: 1, CheckIns: 2},
+		{Day: "20260304", DeviceSN: "A", UserId: 1, CheckIns: 3},
+		{Day: "20260308", DeviceSN: "B", CheckIns: 1},
+		{Day: "20260308", UserId: 2, CheckIns: 1},
+		{Day: "20260309", DeviceSN: "A", UserId: 1, CheckIns: 1},
+		// 日期格式错误的记录忽略
+		{Day: "", DeviceSN: "C", CheckIns: 1},
+	} {
+		item := item
+		aggregator.add(&item)
+	}
+
+	// 同一周内跨天的设备及终端用户只计一次，未上报设备或用户的记录只计入上报次数
+	asserts.Equal([]ActivityStat{
+		{Period: "20260302", Devices: 2, Users: 2, CheckIns: 7},
+		{Period: "20260309", Devices: 1, Users: 1, CheckIns: 1},
+	}, aggregator.stats())
+	asserts.Empty(newActivityAggregator(PeriodDay).stats())
+}
+
+func TestGetActivityStats(t *testing.T) {
+	asserts := assert.New(t)
+	const addr = "stats.useinfo.example"
+	raw := func(day, hour int, device string, user int64, platform string) *AppUseInfo {
+		useInfo := &AppUseInfo{ServerAddr: addr, DeviceSN: device, UserId: user, Platform: platform}
+		useInfo.CreatedAt = time.Date(2026, 3, day, hour, 0, 0, 0, time.Local)
+		return useInfo
+	}
+	_, err := CreateAppUseInfos([]*AppUseInfo{
+		raw(2, 10, "A", 1, "android"),
+		raw(2, 11, "A", 1, "android"),
+		raw(3, 9, "B", 2, "ios"),
+		raw(9, 9, "A", 0, "android"),
+	})
+	asserts.NoError(err)
+	// 已汇总的记录按汇总中的上报次数计入
+	asserts.NoError(DB.Create(&[]AppUseInfoRollup{
+		{Day: "20260304", Digest: "stats-a", ServerAddr: addr, DeviceSN: "A", UserId: 1, Platform: "android", CheckIns: 5},
+		{Day: "20260304", Digest: "stats-c", ServerAddr: addr, DeviceSN: "C", UserId: 3, Platform: "ios", CheckIns: 2},
+	}).Error)
+	// 已软删除的记录不计入
+	deleted := raw(3, 12, "D", 4, "ios")
+	_, err = deleted.Create()
+	asserts.NoError(err)
+	asserts.NoError(DB.Delete(deleted).Error)
+
+	filter := &ActivityFilter{
+		ServerAddrs: []string{addr},
+		From:        time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local),
+		To:          time.Date(2026, 3, 31, 23, 59, 59, 0, time.Local),
+	}
+
+	stats, err := GetActivityStats(filter, PeriodDay, "")
+	asserts.NoError(err)
+	asserts.Equal([]ActivityStat{
+		{Period: "20260302", Devices: 1, Users: 1, CheckIns: 2},
+		{Period: "20260303", Devices: 1, Users: 1, CheckIns: 1},
+		{Period: "20260304", Devices: 2, Users: 2, CheckIns: 7},
+		{Period: "20260309", Devices: 1, Users: 0, CheckIns: 1},
+	}, stats)
+
+	// 原始记录与汇总跨天合并去重
+	stats, err = GetActivityStats(filter, PeriodWeek, "")
+	asserts.NoError(err)
+	asserts.Equal([]ActivityStat{
+		{Period: "20260302", Devices: 3, Users: 3, CheckIns: 10},
+		{Period: "20260309", Devices: 1, Users: 0, CheckIns: 1},
+	}, stats)
+
+	stats, err = GetActivityStats(filter, PeriodMonth, "")
+	asserts.NoError(err)
+	asserts.Equal([]ActivityStat{{Period: "20260301", Devices: 3, Users: 3, CheckIns: 11}}, stats)
+
+	stats, err = GetActivityStats(filter, PeriodWeek, "platform")
+	asserts.NoError(err)
+	asserts.Equal([]ActivityStat{
+		{Period: "20260302", Value: "android", Devices: 1, Users: 1, CheckIns: 7},
+		{Period: "20260302", Value: "ios", Devices: 2, Users: 2, CheckIns: 3},
+		{Period: "20260309", Value: "android", Devices: 1, Users: 0, CheckIns: 1},
+	}, stats)
+
+	// 日期范围外的记录不计入
+	filter.To = time.Date(2026, 3, 3, 23, 59, 59, 0, time.Local)
+	stats, err = GetActivityStats(filter, PeriodMonth, "")
+	asserts.NoError(err)
+	asserts.Equal([]ActivityStat{{Period: "20260301", Devices: 2, Users: 2, CheckIns: 3}}, stats)
+
+	_, err = GetActivityStats(filter, PeriodDay, "unknown")
+	asserts.Equal(ErrUnknownDimension, err)
+	stats, err = GetActivityStats(&ActivityFilter{ServerAddrs: []string{}, From: filter.From, To: filter.To}, PeriodDay, "")
+	asserts.NoError(err)
+	asserts.Empty(stats)
+}
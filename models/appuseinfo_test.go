@@ -0,0 +1,70 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestUseInfo(addr, nonce string) *AppUseInfo {
+	useInfo := &AppUseInfo{ServerAddr: addr, DeviceSN: "SN-" + nonce}
+	if nonce != "" {
+		useInfo.Nonce = &nonce
+	}
+	return useInfo
+}
+
+func TestCreateAppUseInfos(t *testing.T) {
+	asserts := assert.New(t)
+	const addr = "batch.useinfo.example"
+	count := func() int64 {
+		var total int64
+		DB.Model(&AppUseInfo{}).Where("server_addr = ?", addr).Count(&total)
+		return total
+	}
+
+	duplicates, err := CreateAppUseInfos([]*AppUseInfo{
+		newTestUseInfo(addr, "batch-nonce-1"), newTestUseInfo(addr, "batch-nonce-2"), newTestUseInfo(addr, ""),
+	})
+	asserts.NoError(err)
+	asserts.Equal([]bool{false, false, false}, duplicates)
+	asserts.EqualValues(3, count())
+
+	// 客户端重试时随机数已入库的记录不重复入库，未携带随机数的记录照常入库
+	duplicates, err = CreateAppUseInfos([]*AppUseInfo{
+		newTestUseInfo(addr, "batch-nonce-1"), newTestUseInfo(addr, "batch-nonce-3"), newTestUseInfo(addr, ""),
+	})
+	asserts.NoError(err)
+	asserts.Equal([]bool{true, false, false}, duplicates)
+	asserts.EqualValues(5, count())
+
+	duplicates, err = CreateAppUseInfos(nil)
+	asserts.NoError(err)
+	asserts.Empty(duplicates)
+}
+
+func TestRetentionCutoff(t *testing.T) {
+	asserts := assert.New(t)
+	today := time.Date(2026, 3, 20, 0, 0, 0, 0, time.Local)
+
+	asserts.Equal(today.AddDate(0, 0, -30), retentionCutoff(today, 30))
+	// 保留期短于随机数有效期时，有效期内的记录仍保留
+	asserts.Equal(today.Add(-AppUseInfoNonceTTL), retentionCutoff(today, 1))
+}
+
+func TestMigrateUseInfoDays(t *testing.T) {
+	asserts := assert.New(t)
+	useInfo := newTestUseInfo("days.useinfo.example", "")
+	useInfo.CreatedAt = time.Date(2026, 2, 14, 23, 30, 0, 0, time.Local)
+	_, err := useInfo.Create()
+	asserts.NoError(err)
+	asserts.Equal("20260214", useInfo.Day)
+
+	// 旧版记录未记录上报日期
+	asserts.NoError(DB.Model(useInfo).Update("day", "").Error)
+	migrateUseInfoDays()
+	var migrated AppUseInfo
+	asserts.NoError(DB.First(&migrated, useInfo.ID).Error)
+	asserts.Equal("20260214", migrated.Day)
+}
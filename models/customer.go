@@ -0,0 +1,212 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/zhouqiaokeji/server/models/datatypes"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCustomerExists 客户名称已存在
+	ErrCustomerExists = errors.New("客户名称已存在")
+	// ErrCustomerHasLicenses 客户名下仍有授权
+	ErrCustomerHasLicenses = errors.New("客户名下仍有授权，请先转移或删除授权")
+)
+
+// Customer 客户，一个客户可持有多个授权
+type Customer struct {
+	Auditable
+	Name     string         `json:"name" gorm:"size:191;index"`
+	Contacts datatypes.JSON `json:"contacts"`
+	Notes    string         `json:"notes"`
+	CRMID    string         `json:"crm_id" gorm:"column:crm_id;index"`
+}
+
+// Contact 客户联系人
+type Contact struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Phone string `json:"phone"`
+	Email string `json:"email"`
+}
+
+// CustomerLicenseCount 客户持有的授权数量
+type CustomerLicenseCount struct {
+	CustomerID uint64
+	Total      int64
+}
+
+// Create 创建客户
+func (customer *Customer) Create() (uint64, error) {
+	if _, err := GetCustomerByName(customer.Name); err == nil {
+		return 0, ErrCustomerExists
+	}
+	if err := DB.Create(customer).Error; err != nil {
+		util.Log().Warning("无法插入客户记录, %s", err)
+		return 0, err
+	}
+	return customer.ID, nil
+}
+
+// Update 更新客户信息
+func (customer *Customer) Update(values map[string]interface{}) error {
+	if name, ok := values["name"].(string); ok && name != customer.Name {
+		if existing, err := GetCustomerByName(name); err == nil && existing.ID != customer.ID {
+			return ErrCustomerExists
+		}
+	}
+	if err := DB.Model(customer).Updates(values).Error; err != nil {
+		util.Log().Warning("无法更新客户记录, %s", err)
+		return err
+	}
+	return nil
+}
+
+// GetContacts 解析客户联系人
+func (customer *Customer) GetContacts() []Contact {
+	contacts := make([]Contact, 0)
+	if len(customer.Contacts) > 0 {
+		if err := json.Unmarshal(customer.Contacts, &contacts); err != nil {
+			util.Log().Warning("无法解析客户联系人, %s", err)
+		}
+	}
+	return contacts
+}
+
+// GetCustomer 获取指定客户
+func GetCustomer(id uint64) (Customer, error) {
+	var customer Customer
+	result := DB.First(&customer, id)
+	return customer, result.Error
+}
+
+// GetCustomerByName 按名称获取客户
+func GetCustomerByName(name string) (Customer, error) {
+	var customer Customer
+	result := DB.Where("name = ?", name).First(&customer)
+	return customer, result.Error
+}
+
+// GetCustomersByIDs 批量获取客户，以客户ID为键返回
+func GetCustomersByIDs(ids []uint64) map[uint64]Customer {
+	var customers []Customer
+	res := make(map[uint64]Customer, len(ids))
+	if len(ids) == 0 {
+		return res
+	}
+	DB.Where("id IN ?", ids).Find(&customers)
+	for _, customer := range customers {
+		res[customer.ID] = customer
+	}
+	return res
+}
+
+// GetCustomers 分页查询客户，keyword 匹配名称或 CRM ID
+func GetCustomers(page, size int, keyword string) ([]Customer, int64) {
+	var (
+		customers []Customer
+		total     int64
+	)
+	dbChain := DB.Model(&Customer{})
+	if keyword != "" {
+		dbChain = dbChain.Where("name like ? OR crm_id = ?", "%"+keyword+"%", keyword)
+	}
+	dbChain = dbChain.Session(&gorm.Session{})
+
+	// 计算总数用于分页
+	dbChain.Count(&total)
+
+	// 查询记录
+	dbChain.Limit(size).Offset((page - 1) * size).Order("name asc").Find(&customers)
+
+	return customers, total
+}
+
+// CountCustomerLicenses 统计各客户持有的授权数量
+func CountCustomerLicenses(ids []uint64) map[uint64]int64 {
+	var counts []CustomerLicenseCount
+	res := make(map[uint64]int64, len(ids))
+	if len(ids) == 0 {
+		return res
+	}
+	DB.Model(&License{}).Select("customer_id, count(*) as total").
+		Where("customer_id IN ?", ids).Group("customer_id").Scan(&counts)
+	for _, count := range counts {
+		res[count.CustomerID] = count.Total
+	}
+	return res
+}
+
+// GetCustomerLicenses 查询客户名下的全部授权
+func GetCustomerLicenses(id uint64) []License {
+	var licenses []License
+	DB.Where("customer_id = ?", id).Find(&licenses)
+	return licenses
+}
+
+// RemoveCustomer 删除客户，客户名下仍有授权时不允许删除
+func RemoveCustomer(id uint64) error {
+	var count int64
+	DB.Model(&License{}).Where("customer_id = ?", id).Count(&count)
+	if count > 0 {
+		return ErrCustomerHasLicenses
+	}
+	return DB.Delete(&Customer{}, id).Error
+}
+
+// AssignLicenses 将授权归属到客户，customerId 为 0 时取消归属
+func AssignLicenses(customerId uint64, containerIds []string) (int64, error) {
+	result := DB.Model(&License{}).Where("container_id IN ?", containerIds).Update("customer_id", customerId)
+	if result.Error != nil {
+		util.Log().Warning("无法更新授权客户, %s", result.Error)
+	}
+	return result.RowsAffected, result.Error
+}
+
+// GetLicenseCustomerGroups 按客户分组统计符合条件的授权数量，未归属客户的授权分组ID为 0
+func GetLicenseCustomerGroups(page, size int, filter *LicenseFilter) ([]CustomerLicenseCount, int64) {
+	var (
+		groups []CustomerLicenseCount
+		total  int64
+	)
+	dbChain := filter.apply(DB.Model(&License{})).Session(&gorm.Session{})
+
+	// 计算分组总数用于分页
+	dbChain.Distinct("customer_id").Count(&total)
+
+	// 查询分组
+	dbChain.Select("customer_id, count(*) as total").Group("customer_id").
+		Order("customer_id asc").Limit(size).Offset((page - 1) * size).Scan(&groups)
+
+	return groups, total
+}
+
+// migrationLicenseCustomers 授权客户迁移完成标记
+const migrationLicenseCustomers = "migration_license_customers"
+
+// migrateLicenseCustomers 为未归属客户的授权按名称创建客户，每个不同的名称对应一个客户；
+// 仅在首次升级时执行，之后新建的授权由管理员指定客户
+func migrateLicenseCustomers() {
+	var (
+		names []string
+		count int64
+	)
+	DB.Model(&Setting{}).Where("name = ?", migrationLicenseCustomers).Count(&count)
+	if count > 0 {
+		return
+	}
+	DB.Model(&License{}).Where("customer_id = 0 AND name <> ''").Distinct("name").Pluck("name", &names)
+	for _, name := range names {
+		customer, err := GetCustomerByName(name)
+		if err != nil {
+			customer = Customer{Name: name}
+			if _, err = customer.Create(); err != nil {
+				continue
+			}
+		}
+		DB.Model(&License{}).Where("customer_id = 0 AND name = ?", name).Update("customer_id", customer.ID)
+	}
+	DB.Create(&Setting{Name: migrationLicenseCustomers, Value: "installed", Type: "migration"})
+}
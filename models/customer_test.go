@@ -0,0 +1,30 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateLicenseCustomers(t *testing.T) {
+	asserts := assert.New(t)
+	DB.Unscoped().Where("name = ?", migrationLicenseCustomers).Delete(&Setting{})
+
+	legacy := newTestLicense(t, "TestMigrateLicenseCustomers", StatusActive)
+	migrateLicenseCustomers()
+	customer, err := GetCustomerByName(legacy.Name)
+	asserts.NoError(err)
+	migrated, err := GetLicense(legacy.ContainerID)
+	asserts.NoError(err)
+	asserts.Equal(customer.ID, migrated.CustomerID)
+
+	// 新建的授权不按名称自动关联客户，迁移不再重复执行
+	lic := &License{Name: legacy.Name, ContainerID: "TestMigrateLicenseCustomers_new"}
+	_, err = lic.Create()
+	asserts.NoError(err)
+	asserts.Zero(lic.CustomerID)
+	migrateLicenseCustomers()
+	created, err := GetLicense(lic.ContainerID)
+	asserts.NoError(err)
+	asserts.Zero(created.CustomerID)
+}
@@ -1,56 +1,186 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"github.com/zhouqiaokeji/server/models/datatypes"
+	"github.com/zhouqiaokeji/server/pkg/binding"
 	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/licproto"
 	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
+// Status 授权状态，取值与历史数据保持兼容，并与客户端共用 licproto 中的定义
 type Status int
 
 const (
-	VALID Status = iota // 开始生成枚举值, 默认为0
-	INVALID
-	EXPIRE
+	// StatusActive 正常
+	StatusActive Status = licproto.StatusActive
+	// StatusPending 待审核，客户端申请的授权默认处于该状态
+	StatusPending Status = licproto.StatusPending
+	// StatusExpired 已过期
+	StatusExpired Status = licproto.StatusExpired
+	// StatusTrial 试用
+	StatusTrial Status = licproto.StatusTrial
+	// StatusSuspended 已暂停
+	StatusSuspended Status = licproto.StatusSuspended
+	// StatusRevoked 已吊销，不可再变更
+	StatusRevoked Status = licproto.StatusRevoked
 )
 
 type License struct {
 	Auditable
-	Name           string `json:"name"`
-	ContainerID    string `json:"containerId" gorm:"index"`
-	Status         Status `json:"status"`
-	IP             string `json:"ip" gorm:"index"`
-	Domain         string `json:"domain" gorm:"index"`
-	Expire         string `json:"expire"`
-	LastOnlineTime string `json:"last_online_time"`
+	Name           string         `json:"name"`
+	ContainerID    string         `json:"containerId" gorm:"index"`
+	Status         Status         `json:"status"`
+	IP             string         `json:"ip" gorm:"index"`
+	Domain         string         `json:"domain" gorm:"index"`
+	Expire         string         `json:"expire"`
+	LastOnlineTime string         `json:"last_online_time"`
+	Entitlement    datatypes.JSON `json:"entitlement"`
+	Revision       int            `json:"revision"`
+	LeaseID        string         `json:"-" gorm:"index"`
+	LeaseInstance  string         `json:"-"`
+	LeaseExpire    *time.Time     `json:"-"`
+	Fingerprint    datatypes.JSON `json:"fingerprint"`
+	CustomerID     uint64         `json:"customer_id" gorm:"index"`
+	Seats          int            `json:"seats"`
+	UsageCap       int64          `json:"usage_cap"`
+	UsagePolicy    string         `json:"usage_policy"`
+	Retention      int            `json:"retention"`
 }
 
-// Create 记录服务使用信息
+// Entitlement 授权权益，包括功能开关、数量限制及自定义键值
+type Entitlement struct {
+	Features []string          `json:"features"`
+	Limits   map[string]int64  `json:"limits"`
+	Extras   map[string]string `json:"extras"`
+}
+
+// Create 记录授权信息，客户端上报的 IP、Domain 同时登记为绑定
 func (lic *License) Create() (uint64, error) {
-	if err := DB.Create(lic).Error; err != nil {
-		util.Log().Warning("无法插入授权记录, %s", err)
+	if err := lic.CreateTx(DB); err != nil {
 		return 0, err
 	}
 	return lic.ID, nil
 }
 
-// GetLicenses 分页查询授权信息
-func GetLicenses(page, size int, order string, name string) ([]License, int64) {
+// CreateTx 在指定事务中记录授权信息
+func (lic *License) CreateTx(tx *gorm.DB) error {
+	if err := tx.Create(lic).Error; err != nil {
+		util.Log().Warning("无法插入授权记录, %s", err)
+		return err
+	}
+	if lic.IP != "" || lic.Domain != "" {
+		_ = lic.addBindings(tx, lic.BindingRules())
+	}
+	return nil
+}
+
+// licenseOrderColumns 允许排序的字段
+var licenseOrderColumns = map[string]string{
+	"name":             "name",
+	"container_id":     "container_id",
+	"status":           "status",
+	"expire":           "expire",
+	"last_online_time": "last_online_time",
+	"customer_id":      "customer_id",
+	"created_at":       "created_at",
+	"updated_at":       "updated_at",
+}
+
+// LicenseFilter 授权列表筛选条件，各条件为空时不筛选，多个条件同时生效；
+// 日期与 License.Expire 格式一致，时间与 LastOnlineTime 格式一致
+type LicenseFilter struct {
+	Name           string
+	CustomerID     *uint64
+	Status         []Status
+	ExpireFrom     string
+	ExpireTo       string
+	ExpiringWithin int
+	Addr           string
+	OnlineFrom     string
+	OnlineTo       string
+	CreatedFrom    *time.Time
+	CreatedTo      *time.Time
+}
+
+// apply 将筛选条件应用到查询
+func (f *LicenseFilter) apply(db *gorm.DB) *gorm.DB {
+	if f == nil {
+		return db
+	}
+	if f.Name != "" {
+		db = db.Where("name like ?", "%"+f.Name+"%")
+	}
+	if f.CustomerID != nil {
+		db = db.Where("customer_id = ?", *f.CustomerID)
+	}
+	if len(f.Status) > 0 {
+		db = db.Where("status IN ?", f.Status)
+	}
+	if f.ExpireFrom != "" {
+		db = db.Where("expire <> '' AND expire >= ?", f.ExpireFrom)
+	}
+	if f.ExpireTo != "" {
+		db = db.Where("expire <> '' AND expire <= ?", f.ExpireTo)
+	}
+	if f.ExpiringWithin > 0 {
+		now := time.Now()
+		db = db.Where("expire > ? AND expire <= ?",
+			now.Format(util.FORMAT_DATE_y4Md), now.AddDate(0, 0, f.ExpiringWithin).Format(util.FORMAT_DATE_y4Md))
+	}
+	if f.Addr != "" {
+		db = db.Where("container_id IN ?", findContainersByAddr(f.Addr))
+	}
+	if f.OnlineFrom != "" {
+		db = db.Where("last_online_time <> '' AND last_online_time >= ?", f.OnlineFrom)
+	}
+	if f.OnlineTo != "" {
+		db = db.Where("last_online_time <> '' AND last_online_time <= ?", f.OnlineTo)
+	}
+	if f.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		db = db.Where("created_at <= ?", *f.CreatedTo)
+	}
+	return db
+}
+
+// licenseOrder 将排序参数转换为排序语句，仅允许白名单中的字段，格式为 "字段 [asc|desc]"
+func licenseOrder(order string) string {
+	fields := strings.Fields(strings.ToLower(order))
+	if len(fields) == 0 || len(fields) > 2 {
+		return "created_at desc"
+	}
+	column, ok := licenseOrderColumns[fields[0]]
+	if !ok {
+		return "created_at desc"
+	}
+	direction := "asc"
+	if len(fields) == 2 && fields[1] == "desc" {
+		direction = "desc"
+	}
+	return column + " " + direction
+}
+
+// GetLicenses 按条件分页查询授权信息
+func GetLicenses(page, size int, order string, filter *LicenseFilter) ([]License, int64) {
 	var (
 		licenses []License
 		total    int64
 	)
-	dbChain := DB
-	if name != "" {
-		dbChain = dbChain.Where("name like ?", "%"+name+"%")
-	}
+	dbChain := filter.apply(DB.Model(&License{})).Session(&gorm.Session{})
 
 	// 计算总数用于分页
-	dbChain.Model(&License{}).Count(&total)
+	dbChain.Count(&total)
 
 	// 查询记录
-	dbChain.Limit(size).Offset((page - 1) * size).Order(order).Find(&licenses)
+	dbChain.Limit(size).Offset((page - 1) * size).Order(licenseOrder(order)).Find(&licenses)
 
 	return licenses, total
 }
@@ -76,24 +206,15 @@ func CheckExistByContainer(id *uint64, containerId string) bool {
 	return res
 }
 
-// CheckExistIpOrDomain 判断IP或Domain 是否存在
+// CheckExistIpOrDomain 判断IP或Domain 是否与其他授权的绑定存在交集
 func CheckExistIpOrDomain(ip, domain, containerId string) bool {
-	var (
-		license License
-	)
-	if ip != "" {
-		result := DB.Set("gorm:auto_preload", true).Where("ip = ? AND container_id <> ?", ip, containerId).First(&license)
-		if result.Error == nil && &license.ID != nil {
-			return true
+	rules := make([]binding.Rule, 0, 2)
+	for _, value := range []string{ip, domain} {
+		if rule, err := binding.Parse(value); err == nil {
+			rules = append(rules, rule)
 		}
 	}
-	if domain != "" {
-		result := DB.Set("gorm:auto_preload", true).Where("domain = ? AND container_id <> ?", domain, containerId).First(&license)
-		if result.Error == nil && &license.ID != nil {
-			return true
-		}
-	}
-	return false
+	return len(FindBindingConflicts(rules, containerId)) > 0
 }
 
 // GetLicense 获取容器授权信息
@@ -103,58 +224,106 @@ func GetLicense(key string) (License, error) {
 	return license, result.Error
 }
 
-// Verify 校验授权信息
-func (lic *License) Verify(license *License) (*License, error) {
-	online := false
-	if lic.LastOnlineTime != "" && !util.ContainsString(conf.SystemConfig.AdminContainer, license.ContainerID) {
-		loc, _ := time.LoadLocation("Local")
-		lastTime, _ := time.ParseInLocation(util.FORMAT_DATETIME_Y4MDHMS, license.LastOnlineTime, loc)
-		duration := time.Now().Sub(lastTime)
-		online = duration <= time.Minute*5
-	}
-	if lic.Expire != "" {
-		loc, _ := time.LoadLocation("Local")
-		expire, _ := time.ParseInLocation(util.FORMAT_DATE_y4Md, lic.Expire, loc)
-		duration := time.Now().After(expire)
-		if duration {
-			lic.Status = EXPIRE
-		}
+// Verify 校验授权信息，校验通过后为客户端实例分配授权租约；浮动授权须持有 seatID 对应的有效席位
+func (lic *License) Verify(license *License, instanceID, seatID string) (*License, error) {
+	if lic.Expired() {
+		lic.Status = StatusExpired
 	}
-	if lic.Status == Active && lic.Name == license.Name && !online {
-		lic.updateOnline(lic.ID)
+	if !lic.Status.Usable() || lic.Name != license.Name {
+		return nil, errors.New("授权信息异常 ")
+	}
+	// 浮动授权不绑定主机，由客户端签出席位控制并发
+	if lic.Floating() {
+		if err := lic.checkSeat(seatID, instanceID); err != nil {
+			return nil, err
+		}
 		return lic, nil
 	}
-	return nil, errors.New("授权信息异常 ")
-}
-
-// UpdateStatus 修改授权状态
-func (lic *License) UpdateStatus(status Status) {
-	DB.Model(&lic).Update("status", status)
+	current := license.GetFingerprint()
+	if err := lic.checkFingerprint(&current, instanceID); err != nil {
+		return nil, err
+	}
+	// 管理容器允许多实例同时在线
+	force := util.ContainsString(conf.SystemConfig.AdminContainer, license.ContainerID)
+	if err := lic.AcquireLease(instanceID, force); err != nil {
+		return nil, err
+	}
+	return lic, nil
 }
 
-// Update 更新授权信息
-func (lic *License) Update(license License) {
-	DB.First(lic)
-
-	if license.IP != "" {
-		lic.IP = license.IP
+// CheckVerify 预先校验客户端的席位、硬件指纹及租约，不校验授权状态，也不分配租约或记录指纹差异；
+// 用于兑换激活码前确认兑换后可以通过校验
+func (lic *License) CheckVerify(license *License, instanceID, seatID string) error {
+	if lic.Floating() {
+		return lic.checkSeat(seatID, instanceID)
+	}
+	if len(lic.Fingerprint) > 0 {
+		current := license.GetFingerprint()
+		if _, _, _, accepted := lic.matchFingerprint(&current); !accepted {
+			return ErrFingerprintMismatch
+		}
 	}
-	if license.Domain != "" {
-		lic.Domain = license.Domain
+	if util.ContainsString(conf.SystemConfig.AdminContainer, license.ContainerID) {
+		return nil
 	}
-	if license.Expire != "" {
-		lic.Expire = license.Expire
+	if lic.LeaseInstance != "" && lic.LeaseInstance != instanceID &&
+		lic.LeaseExpire != nil && !lic.LeaseExpire.Add(leaseGrace()).Before(time.Now()) {
+		return ErrLeaseHeld
+	}
+	return nil
+}
+
+// Expired 判断授权是否已过期
+func (lic *License) Expired() bool {
+	if lic.Expire == "" {
+		return false
 	}
+	loc, _ := time.LoadLocation("Local")
+	expire, _ := time.ParseInLocation(util.FORMAT_DATE_y4Md, lic.Expire, loc)
+	return time.Now().After(expire)
+}
 
-	DB.Save(lic)
+// GetEntitlement 解析授权权益
+func (lic *License) GetEntitlement() Entitlement {
+	var entitlement Entitlement
+	if len(lic.Entitlement) > 0 {
+		if err := json.Unmarshal(lic.Entitlement, &entitlement); err != nil {
+			util.Log().Warning("无法解析授权权益, %s", err)
+		}
+	}
+	return entitlement
 }
 
-func (lic *License) updateOnline(id uint64) {
-	lic.ID = id
-	DB.Model(lic).Update("last_online_time", time.Now().Format(util.FORMAT_DATETIME_Y4MDHMS))
+// UpdateEntitlement 更新授权权益，并递增载荷版本以通知客户端刷新
+func (lic *License) UpdateEntitlement(entitlement Entitlement) error {
+	raw, err := json.Marshal(entitlement)
+	if err != nil {
+		return err
+	}
+	if err = DB.Model(lic).Updates(map[string]interface{}{
+		"entitlement": datatypes.JSON(raw),
+		"revision":    gorm.Expr("revision + ?", 1),
+	}).Error; err != nil {
+		util.Log().Warning("无法更新授权权益, %s", err)
+		return err
+	}
+	lic.Entitlement = raw
+	lic.Revision++
+	return nil
 }
 
-// Remove 删除指定授权信息
-func Remove(key string) {
-	DB.Where("container_id = ?", key).Delete(&License{})
+// Remove 删除指定授权信息，同时删除其绑定以释放绑定的 IP 及域名
+func Remove(key string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("container_id = ?", key).Delete(&License{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("container_id = ?", key).Delete(&LicenseBinding{}).Error
+	})
+	if err != nil {
+		util.Log().Warning("无法删除授权, %s", err)
+		return err
+	}
+	expireLicenseAddrs()
+	return nil
 }
@@ -0,0 +1,302 @@
+package models
+
+import (
+	"github.com/zhouqiaokeji/server/pkg/binding"
+	"github.com/zhouqiaokeji/server/pkg/cache"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// licenseAddrPrefix 服务地址对应授权ID的缓存前缀
+	licenseAddrPrefix = "license_addr:"
+	// licenseAddrVersionKey 绑定版本缓存键，绑定变更时更换
+	licenseAddrVersionKey = "license_addr_version"
+	// licenseAddrTTL 服务地址对应授权ID的缓存时间（秒）
+	licenseAddrTTL = 300
+)
+
+// LicenseBinding 授权绑定的 IP、IP 段或域名
+type LicenseBinding struct {
+	Auditable
+	LicenseID   uint64 `json:"-" gorm:"index"`
+	ContainerID string `json:"containerId" gorm:"index"`
+	Kind        string `json:"kind"`
+	Value       string `json:"value" gorm:"index"`
+}
+
+// Rule 转换为绑定规则
+func (b *LicenseBinding) Rule() binding.Rule {
+	return binding.Rule{Kind: b.Kind, Value: b.Value}
+}
+
+// GetLicenseBindings 查询授权的全部绑定
+func GetLicenseBindings(containerId string) []LicenseBinding {
+	var bindings []LicenseBinding
+	DB.Where("container_id = ?", containerId).Order("created_at asc").Find(&bindings)
+	return bindings
+}
+
+// BindingRules 返回授权的全部绑定规则，包含旧版 IP、Domain 字段
+func (lic *License) BindingRules() []binding.Rule {
+	bindings := GetLicenseBindings(lic.ContainerID)
+	values := make([]string, 0, len(bindings)+2)
+	for i := range bindings {
+		values = append(values, bindings[i].Value)
+	}
+	for _, value := range []string{lic.IP, lic.Domain} {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	rules := make([]binding.Rule, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		rule, err := binding.Parse(value)
+		if err != nil || seen[rule.Value] {
+			continue
+		}
+		seen[rule.Value] = true
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// MatchAddr 判断服务地址是否命中授权的任一绑定
+func (lic *License) MatchAddr(addr string) bool {
+	for _, rule := range lic.BindingRules() {
+		if rule.Match(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindBindingConflicts 查找与其他授权绑定存在交集的规则，返回冲突的已有绑定，已删除授权的绑定不参与。
+// 数据库按规则筛选可能存在交集的绑定，再逐条精确判断
+func FindBindingConflicts(rules []binding.Rule, containerId string) []LicenseBinding {
+	var (
+		bindings  []LicenseBinding
+		conflicts []LicenseBinding
+	)
+	if len(rules) == 0 {
+		return nil
+	}
+	values, patterns := overlapCandidates(rules)
+	candidates := DB.Where("value IN ?", values)
+	for _, pattern := range patterns {
+		candidates = candidates.Or("value LIKE ?", pattern)
+	}
+	DB.Where("container_id <> ?", containerId).
+		Where("license_id IN (?)", DB.Model(&License{}).Select("id")).
+		Where(candidates).Find(&bindings)
+	for i := range bindings {
+		existing := bindings[i].Rule()
+		for _, rule := range rules {
+			if rule.Overlaps(existing) {
+				conflicts = append(conflicts, bindings[i])
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
+// overlapCandidates 返回可能与规则存在交集的绑定值及 LIKE 匹配模式：
+// 域名及通配域名的上级通配域名按值精确匹配，下级域名按后缀匹配；
+// IP 段的上级网段按值精确匹配，下级网段按整段前缀匹配
+func overlapCandidates(rules []binding.Rule) ([]string, []string) {
+	values := make([]string, 0)
+	patterns := make([]string, 0)
+	for _, rule := range rules {
+		switch rule.Kind {
+		case binding.KindDomain, binding.KindWildcard:
+			domain := strings.TrimPrefix(rule.Value, "*.")
+			values = append(values, rule.Value)
+			labels := strings.Split(domain, ".")
+			for i := 1; i < len(labels); i++ {
+				values = append(values, "*."+strings.Join(labels[i:], "."))
+			}
+			if rule.Kind == binding.KindWildcard {
+				patterns = append(patterns, "%."+domain)
+			}
+		case binding.KindCIDR:
+			_, network, err := net.ParseCIDR(rule.Value)
+			if err != nil {
+				continue
+			}
+			ones, bits := network.Mask.Size()
+			for i := 0; i <= ones; i++ {
+				supernet := &net.IPNet{IP: network.IP.Mask(net.CIDRMask(i, bits)), Mask: net.CIDRMask(i, bits)}
+				values = append(values, supernet.String())
+			}
+			patterns = append(patterns, subnetPattern(network))
+		}
+	}
+	return values, patterns
+}
+
+// subnetPattern 返回网段内地址或下级网段的 LIKE 匹配模式，IPv4 按完整的段前缀匹配
+func subnetPattern(network *net.IPNet) string {
+	ip := network.IP.To4()
+	if ip == nil {
+		return "%:%"
+	}
+	ones, _ := network.Mask.Size()
+	octets := make([]string, 0, 4)
+	for i := 0; i < ones/8; i++ {
+		octets = append(octets, strconv.Itoa(int(ip[i])))
+	}
+	if len(octets) == 4 {
+		return strings.Join(octets, ".") + "%"
+	}
+	if len(octets) == 0 {
+		return "%.%"
+	}
+	return strings.Join(octets, ".") + ".%"
+}
+
+// addrRule 将地址解析为绑定规则，地址可以是 IP、CIDR、域名、host:port 或 URL
+func addrRule(addr string) (binding.Rule, bool) {
+	rule, err := binding.Parse(addr)
+	if err != nil {
+		if rule, err = binding.Parse(binding.Host(addr)); err != nil {
+			return rule, false
+		}
+	}
+	return rule, true
+}
+
+// findContainersByAddr 查找绑定与地址存在交集的授权容器ID，地址可以是 IP、CIDR 或域名
+func findContainersByAddr(addr string) []string {
+	rule, ok := addrRule(addr)
+	if !ok {
+		return []string{}
+	}
+	containers := make([]string, 0)
+	for _, b := range FindBindingConflicts([]binding.Rule{rule}, "") {
+		if !util.ContainsString(containers, b.ContainerID) {
+			containers = append(containers, b.ContainerID)
+		}
+	}
+	return containers
+}
+
+// FindLicenseByAddr 查找绑定命中服务地址的授权，多个授权命中时取最早创建的授权；
+// 地址对应的授权ID按绑定版本缓存，绑定变更后整体失效
+func FindLicenseByAddr(addr string) (License, error) {
+	var license License
+	rule, ok := addrRule(addr)
+	if !ok {
+		return license, gorm.ErrRecordNotFound
+	}
+	key := licenseAddrPrefix + licenseAddrVersion() + ":" + rule.Value
+	licenseID, cached := cache.Get(key)
+	if !cached {
+		var ids []uint64
+		if containers := findContainersByAddr(rule.Value); len(containers) > 0 {
+			DB.Model(&License{}).Where("container_id IN ?", containers).Order("created_at").Limit(1).Pluck("id", &ids)
+		}
+		licenseID = uint64(0)
+		if len(ids) > 0 {
+			licenseID = ids[0]
+		}
+		_ = cache.Set(key, licenseID, licenseAddrTTL)
+	}
+	if id, _ := licenseID.(uint64); id != 0 {
+		return license, DB.First(&license, id).Error
+	}
+	return license, gorm.ErrRecordNotFound
+}
+
+// licenseAddrVersion 返回当前绑定版本
+func licenseAddrVersion() string {
+	if version, ok := cache.Get(licenseAddrVersionKey); ok {
+		return version.(string)
+	}
+	return ""
+}
+
+// expireLicenseAddrs 更换绑定版本，使服务地址对应授权的缓存失效
+func expireLicenseAddrs() {
+	_ = cache.Set(licenseAddrVersionKey, util.RandStringRunes(16), -1)
+}
+
+// SetBindings 以给定规则替换授权的全部绑定，同时清空旧版 IP、Domain 字段
+func (lic *License) SetBindings(rules []binding.Rule) error {
+	return lic.SetBindingsTx(DB, rules)
+}
+
+// SetBindingsTx 在指定事务中替换授权的全部绑定
+func (lic *License) SetBindingsTx(db *gorm.DB, rules []binding.Rule) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("license_id = ?", lic.ID).Delete(&LicenseBinding{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&License{}).Where("id = ?", lic.ID).Updates(map[string]interface{}{"ip": "", "domain": ""}).Error; err != nil {
+			return err
+		}
+		return createBindings(tx, lic, rules)
+	})
+	if err != nil {
+		util.Log().Warning("无法更新授权绑定, %s", err)
+		return err
+	}
+	expireLicenseAddrs()
+	lic.IP, lic.Domain = "", ""
+	return nil
+}
+
+// AddBindings 为授权追加绑定，已存在的规则忽略
+func (lic *License) AddBindings(rules []binding.Rule) error {
+	return lic.addBindings(DB, rules)
+}
+
+func (lic *License) addBindings(tx *gorm.DB, rules []binding.Rule) error {
+	var bindings []LicenseBinding
+	tx.Where("license_id = ?", lic.ID).Find(&bindings)
+	existing := make(map[string]bool)
+	for _, b := range bindings {
+		existing[b.Value] = true
+	}
+	added := make([]binding.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if !existing[rule.Value] {
+			added = append(added, rule)
+		}
+	}
+	if err := createBindings(tx, lic, added); err != nil {
+		util.Log().Warning("无法插入授权绑定, %s", err)
+		return err
+	}
+	if len(added) > 0 {
+		expireLicenseAddrs()
+	}
+	return nil
+}
+
+func createBindings(tx *gorm.DB, lic *License, rules []binding.Rule) error {
+	for _, rule := range rules {
+		if err := tx.Create(&LicenseBinding{
+			LicenseID:   lic.ID,
+			ContainerID: lic.ContainerID,
+			Kind:        rule.Kind,
+			Value:       rule.Value,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLicenseBindings 将旧版 IP、Domain 字段迁移到绑定表
+func migrateLicenseBindings() {
+	var licenses []License
+	DB.Where("ip <> '' OR domain <> ''").Find(&licenses)
+	for i := range licenses {
+		_ = licenses[i].AddBindings(licenses[i].BindingRules())
+	}
+}
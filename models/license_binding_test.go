@@ -0,0 +1,107 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/binding"
+)
+
+// rules 解析测试用绑定规则
+func rules(t *testing.T, values ...string) []binding.Rule {
+	parsed, err := binding.ParseAll(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestFindBindingConflicts(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newTestLicense(t, "TestFindBindingConflicts", StatusActive)
+	asserts.NoError(lic.AddBindings(rules(t, "10.20.0.0/16", "*.conflict.example", "api.other.example")))
+
+	conflicts := func(values ...string) []string {
+		found := make([]string, 0)
+		for _, b := range FindBindingConflicts(rules(t, values...), "another") {
+			found = append(found, b.Value)
+		}
+		return found
+	}
+
+	// 网段内的地址、下级网段及上级网段
+	asserts.Equal([]string{"10.20.0.0/16"}, conflicts("10.20.3.4"))
+	asserts.Equal([]string{"10.20.0.0/16"}, conflicts("10.20.8.0/24"))
+	asserts.Equal([]string{"10.20.0.0/16"}, conflicts("10.0.0.0/8"))
+	asserts.Empty(conflicts("10.21.0.1", "10.2.0.0/16"))
+
+	// 通配域名的子域名、下级及上级通配域名
+	asserts.Equal([]string{"*.conflict.example"}, conflicts("a.b.conflict.example"))
+	asserts.Equal([]string{"*.conflict.example"}, conflicts("*.b.conflict.example"))
+	asserts.ElementsMatch([]string{"*.conflict.example", "api.other.example"}, conflicts("*.example"))
+	asserts.Empty(conflicts("conflict.example", "other.example"))
+
+	// 不与自身的绑定冲突
+	asserts.Empty(FindBindingConflicts(rules(t, "10.20.3.4"), lic.ContainerID))
+}
+
+func TestGetServerAddrsMatching(t *testing.T) {
+	asserts := assert.New(t)
+	addrs := []string{
+		"http://172.30.1.5:8080/app",
+		"172.30.2.6",
+		"172.31.0.1:443",
+		"https://svc.match.example",
+		"match.example:80",
+		"nomatch.example",
+		"[fd00::1]:8080",
+	}
+	for _, addr := range addrs {
+		_, err := (&AppUseInfo{ServerAddr: addr}).Create()
+		asserts.NoError(err)
+	}
+	// 重复上报只登记一次
+	_, err := (&AppUseInfo{ServerAddr: addrs[0]}).Create()
+	asserts.NoError(err)
+	var count int64
+	DB.Model(&AppServerAddr{}).Where("addr = ?", addrs[0]).Count(&count)
+	asserts.EqualValues(1, count)
+
+	asserts.ElementsMatch(addrs[:2], GetServerAddrsMatching(rules(t, "172.30.0.0/16")))
+	asserts.ElementsMatch(addrs[2:3], GetServerAddrsMatching(rules(t, "172.31.0.1")))
+	asserts.ElementsMatch(addrs[3:4], GetServerAddrsMatching(rules(t, "*.match.example")))
+	asserts.ElementsMatch(addrs[4:5], GetServerAddrsMatching(rules(t, "match.example")))
+	asserts.ElementsMatch(addrs[6:], GetServerAddrsMatching(rules(t, "fd00::/64")))
+	asserts.Empty(GetServerAddrsMatching(rules(t, "192.168.0.0/16", "*.other.example")))
+	asserts.Empty(GetServerAddrsMatching(nil))
+}
+
+func TestRemove_ReleasesBindings(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newTestLicense(t, "TestRemove_ReleasesBindings", StatusActive)
+	asserts.NoError(lic.AddBindings(rules(t, "10.77.0.0/16", "removed.binding.test")))
+	asserts.NotEmpty(FindBindingConflicts(rules(t, "removed.binding.test"), "another"))
+	_, err := FindLicenseByAddr("10.77.1.1")
+	asserts.NoError(err)
+
+	// 删除授权后绑定一并删除，地址可重新绑定到其他授权
+	asserts.NoError(Remove(lic.ContainerID))
+	var count int64
+	DB.Unscoped().Model(&LicenseBinding{}).Where("container_id = ?", lic.ContainerID).Count(&count)
+	asserts.EqualValues(0, count)
+	asserts.Empty(FindBindingConflicts(rules(t, "removed.binding.test", "10.77.1.1"), "another"))
+	_, err = FindLicenseByAddr("10.77.1.1")
+	asserts.Error(err)
+
+	other := newTestLicense(t, "TestRemove_ReleasesBindings_other", StatusActive)
+	asserts.NoError(other.AddBindings(rules(t, "10.77.0.0/16", "removed.binding.test")))
+	found, err := FindLicenseByAddr("10.77.1.1")
+	asserts.NoError(err)
+	asserts.Equal(other.ID, found.ID)
+
+	// 旧版删除遗留的绑定不再参与冲突检查
+	orphan := newTestLicense(t, "TestRemove_ReleasesBindings_orphan", StatusActive)
+	asserts.NoError(orphan.AddBindings(rules(t, "orphan.binding.test")))
+	asserts.NoError(DB.Delete(&orphan).Error)
+	asserts.Empty(FindBindingConflicts(rules(t, "orphan.binding.test"), "another"))
+}
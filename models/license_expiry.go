@@ -0,0 +1,112 @@
+package models
+
+import (
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+// LicenseExpiryEvent 授权到期事件，Threshold 为触发的提前预警天数，0 表示已到期
+type LicenseExpiryEvent struct {
+	Auditable
+	LicenseID   uint64 `json:"license_id" gorm:"uniqueIndex:idx_license_expiry_event"`
+	ContainerID string `json:"containerId" gorm:"index"`
+	Name        string `json:"name"`
+	Expire      string `json:"expire" gorm:"uniqueIndex:idx_license_expiry_event"`
+	Threshold   int    `json:"threshold" gorm:"uniqueIndex:idx_license_expiry_event"`
+	DaysLeft    int    `json:"days_left"`
+}
+
+// ExpireLicenses 将已超过到期日的可用授权标记为已过期，返回变更数量
+func ExpireLicenses() int {
+	var (
+		licenses []License
+		count    int
+	)
+	today := time.Now().Format(util.FORMAT_DATE_y4Md)
+	DB.Where("status IN ? AND expire <> '' AND expire <= ?", []Status{StatusActive, StatusTrial}, today).Find(&licenses)
+	for i := range licenses {
+		if err := licenses[i].Transition(StatusExpired, "授权已到期", nil); err != nil {
+			continue
+		}
+		count++
+		newExpiryEvent(&licenses[i], 0, 0)
+	}
+	return count
+}
+
+// WarnExpiringLicenses 为即将到期的可用授权生成预警事件，同一到期日的同一预警只生成一次，
+// 返回新生成的事件数量
+func WarnExpiringLicenses(thresholds []int) int {
+	if len(thresholds) == 0 {
+		return 0
+	}
+	sorted := append([]int(nil), thresholds...)
+	sort.Ints(sorted)
+
+	var (
+		licenses []License
+		count    int
+	)
+	loc, _ := time.LoadLocation("Local")
+	now := time.Now()
+	today, _ := time.ParseInLocation(util.FORMAT_DATE_y4Md, now.Format(util.FORMAT_DATE_y4Md), loc)
+	until := today.AddDate(0, 0, sorted[len(sorted)-1]).Format(util.FORMAT_DATE_y4Md)
+	DB.Where("status IN ? AND expire > ? AND expire <= ?", []Status{StatusActive, StatusTrial}, today.Format(util.FORMAT_DATE_y4Md), until).Find(&licenses)
+	for i := range licenses {
+		expire, err := time.ParseInLocation(util.FORMAT_DATE_y4Md, licenses[i].Expire, loc)
+		if err != nil {
+			continue
+		}
+		daysLeft := int(expire.Sub(today).Hours() / 24)
+		// 只生成已跨过的最小预警，避免新授权一次性生成多个预警
+		for _, threshold := range sorted {
+			if daysLeft <= threshold {
+				if newExpiryEvent(&licenses[i], threshold, daysLeft) {
+					count++
+				}
+				break
+			}
+		}
+	}
+	return count
+}
+
+// newExpiryEvent 插入到期事件，事件已存在时忽略
+func newExpiryEvent(lic *License, threshold, daysLeft int) bool {
+	event := &LicenseExpiryEvent{
+		LicenseID:   lic.ID,
+		ContainerID: lic.ContainerID,
+		Name:        lic.Name,
+		Expire:      lic.Expire,
+		Threshold:   threshold,
+		DaysLeft:    daysLeft,
+	}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		util.Log().Warning("无法插入授权到期事件, %s", result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+// GetLicenseExpiryEvents 分页查询授权到期事件，containerId 为空时查询全部
+func GetLicenseExpiryEvents(containerId string, page, size int) ([]LicenseExpiryEvent, int64) {
+	var (
+		events []LicenseExpiryEvent
+		total  int64
+	)
+	dbChain := DB
+	if containerId != "" {
+		dbChain = dbChain.Where("container_id = ?", containerId)
+	}
+
+	// 计算总数用于分页
+	dbChain.Model(&LicenseExpiryEvent{}).Count(&total)
+
+	// 查询记录
+	dbChain.Limit(size).Offset((page - 1) * size).Order("created_at desc").Find(&events)
+
+	return events, total
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"time"
+)
+
+// LicenseFile 离线授权文件签发记录，Creator 为签发人
+type LicenseFile struct {
+	Auditable
+	LicenseID   uint64    `json:"license_id" gorm:"index"`
+	ContainerID string    `json:"containerId" gorm:"index"`
+	IssuerName  string    `json:"issuer_name"`
+	IssuedAt    time.Time `json:"issued_at"`
+	Expire      string    `json:"expire"`
+	Version     int       `json:"version"`
+}
+
+// Create 记录离线授权文件签发信息
+func (file *LicenseFile) Create() (uint64, error) {
+	if err := DB.Create(file).Error; err != nil {
+		util.Log().Warning("无法插入离线授权签发记录, %s", err)
+		return 0, err
+	}
+	return file.ID, nil
+}
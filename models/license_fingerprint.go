@@ -0,0 +1,196 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/zhouqiaokeji/server/models/datatypes"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"strings"
+)
+
+// ErrFingerprintMismatch 硬件指纹不匹配
+var ErrFingerprintMismatch = errors.New("硬件指纹与授权绑定信息不一致")
+
+// Fingerprint 硬件指纹，由多个组件组成
+type Fingerprint struct {
+	MachineID  string   `json:"machineId"`
+	MACs       []string `json:"macs"`
+	DiskSerial string   `json:"diskSerial"`
+	CPUModel   string   `json:"cpuModel"`
+	Hostname   string   `json:"hostname"`
+}
+
+// FingerprintChange 指纹组件变更
+type FingerprintChange struct {
+	Component string `json:"component"`
+	Enrolled  string `json:"enrolled"`
+	Current   string `json:"current"`
+}
+
+// FingerprintMismatch 硬件指纹不匹配记录
+type FingerprintMismatch struct {
+	Auditable
+	LicenseID   uint64         `json:"license_id" gorm:"index"`
+	ContainerID string         `json:"containerId" gorm:"index"`
+	InstanceID  string         `json:"instance_id"`
+	Matched     int            `json:"matched"`
+	Total       int            `json:"total"`
+	Accepted    bool           `json:"accepted"`
+	Changes     datatypes.JSON `json:"changes"`
+}
+
+// IsEmpty 判断指纹是否未上报任何组件
+func (f *Fingerprint) IsEmpty() bool {
+	return len(f.components()) == 0
+}
+
+// components 返回规范化后的非空指纹组件
+func (f *Fingerprint) components() map[string]string {
+	res := make(map[string]string, 5)
+	macs := make([]string, 0, len(f.MACs))
+	for _, mac := range f.MACs {
+		mac = strings.ToLower(strings.TrimSpace(mac))
+		if mac != "" && !util.ContainsString(macs, mac) {
+			macs = append(macs, mac)
+		}
+	}
+	values := map[string]string{
+		"machineId":  f.MachineID,
+		"macs":       strings.Join(macs, ","),
+		"diskSerial": f.DiskSerial,
+		"cpuModel":   f.CPUModel,
+		"hostname":   f.Hostname,
+	}
+	for name, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			res[name] = value
+		}
+	}
+	return res
+}
+
+// Compare 以已登记指纹为基准比较当前指纹，返回匹配组件数、参与比较的组件数及变更明细。
+// 网卡地址只要存在交集即视为匹配
+func (f *Fingerprint) Compare(current *Fingerprint) (matched, total int, changes []FingerprintChange) {
+	enrolled := f.components()
+	reported := current.components()
+	changes = make([]FingerprintChange, 0)
+	for _, name := range []string{"machineId", "macs", "diskSerial", "cpuModel", "hostname"} {
+		value, ok := enrolled[name]
+		if !ok {
+			continue
+		}
+		total++
+		if value == reported[name] ||
+			(name == "macs" && len(util.SliceIntersect(strings.Split(value, ","), strings.Split(reported[name], ","))) > 0) {
+			matched++
+			continue
+		}
+		changes = append(changes, FingerprintChange{
+			Component: name,
+			Enrolled:  value,
+			Current:   reported[name],
+		})
+	}
+	return
+}
+
+// GetFingerprint 解析已登记的硬件指纹
+func (lic *License) GetFingerprint() Fingerprint {
+	var fingerprint Fingerprint
+	if len(lic.Fingerprint) > 0 {
+		if err := json.Unmarshal(lic.Fingerprint, &fingerprint); err != nil {
+			util.Log().Warning("无法解析硬件指纹, %s", err)
+		}
+	}
+	return fingerprint
+}
+
+// EnrollFingerprint 登记硬件指纹，传入空指纹时清除登记，下次激活时重新登记
+func (lic *License) EnrollFingerprint(fingerprint *Fingerprint) error {
+	var raw datatypes.JSON
+	if fingerprint != nil && !fingerprint.IsEmpty() {
+		data, err := json.Marshal(fingerprint)
+		if err != nil {
+			return err
+		}
+		raw = data
+	}
+	if err := DB.Model(lic).Update("fingerprint", raw).Error; err != nil {
+		util.Log().Warning("无法登记硬件指纹, %s", err)
+		return err
+	}
+	lic.Fingerprint = raw
+	return nil
+}
+
+// checkFingerprint 校验硬件指纹，尚未登记时登记当前指纹；
+// 匹配组件数达到阈值即通过，存在变更的组件均会记录
+func (lic *License) checkFingerprint(current *Fingerprint, instanceID string) error {
+	if len(lic.Fingerprint) == 0 {
+		if current.IsEmpty() {
+			return nil
+		}
+		return lic.EnrollFingerprint(current)
+	}
+
+	matched, total, changes, accepted := lic.matchFingerprint(current)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	raw, _ := json.Marshal(changes)
+	record := &FingerprintMismatch{
+		LicenseID:   lic.ID,
+		ContainerID: lic.ContainerID,
+		InstanceID:  instanceID,
+		Matched:     matched,
+		Total:       total,
+		Accepted:    accepted,
+		Changes:     raw,
+	}
+	_, _ = record.Create()
+
+	if !accepted {
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
+
+// matchFingerprint 与已登记的硬件指纹比对，返回差异及匹配数量是否达到阈值
+func (lic *License) matchFingerprint(current *Fingerprint) (matched, total int, changes []FingerprintChange, accepted bool) {
+	enrolled := lic.GetFingerprint()
+	matched, total, changes = enrolled.Compare(current)
+	threshold := conf.LicenseConfig.FingerprintThreshold
+	if threshold > total {
+		threshold = total
+	}
+	return matched, total, changes, matched >= threshold
+}
+
+// Create 记录硬件指纹不匹配信息
+func (mismatch *FingerprintMismatch) Create() (uint64, error) {
+	if err := DB.Create(mismatch).Error; err != nil {
+		util.Log().Warning("无法插入硬件指纹不匹配记录, %s", err)
+		return 0, err
+	}
+	return mismatch.ID, nil
+}
+
+// GetFingerprintMismatches 分页查询指定容器的硬件指纹不匹配记录
+func GetFingerprintMismatches(containerId string, page, size int) ([]FingerprintMismatch, int64) {
+	var (
+		mismatches []FingerprintMismatch
+		total      int64
+	)
+	dbChain := DB.Where("container_id = ?", containerId)
+
+	// 计算总数用于分页
+	dbChain.Model(&FingerprintMismatch{}).Count(&total)
+
+	// 查询记录
+	dbChain.Limit(size).Offset((page - 1) * size).Order("created_at desc").Find(&mismatches)
+
+	return mismatches, total
+}
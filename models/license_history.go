@@ -0,0 +1,175 @@
+package models
+
+import (
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrTransitionNotAllowed 不允许的状态变更
+	ErrTransitionNotAllowed = errors.New("当前授权状态不允许此操作")
+	// ErrReasonRequired 状态变更缺少原因
+	ErrReasonRequired = errors.New("状态变更原因不能为空")
+)
+
+// statusNames 状态名称
+var statusNames = map[Status]string{
+	StatusActive:    "active",
+	StatusPending:   "pending",
+	StatusExpired:   "expired",
+	StatusTrial:     "trial",
+	StatusSuspended: "suspended",
+	StatusRevoked:   "revoked",
+}
+
+// statusActions 变更到目标状态对应的操作名称
+var statusActions = map[Status]string{
+	StatusActive:    "activate",
+	StatusTrial:     "trial",
+	StatusSuspended: "suspend",
+	StatusExpired:   "expire",
+	StatusRevoked:   "revoke",
+}
+
+// transitions 授权生命周期中允许的状态变更
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusTrial, StatusActive, StatusRevoked},
+	StatusTrial:     {StatusActive, StatusSuspended, StatusExpired, StatusRevoked},
+	StatusActive:    {StatusSuspended, StatusExpired, StatusRevoked},
+	StatusSuspended: {StatusActive, StatusTrial, StatusExpired, StatusRevoked},
+	StatusExpired:   {StatusActive, StatusTrial, StatusRevoked},
+	StatusRevoked:   {},
+}
+
+// LicenseHistory 授权状态变更历史，Creator 为操作人，系统操作时为 0
+type LicenseHistory struct {
+	Auditable
+	LicenseID   uint64 `json:"license_id" gorm:"index"`
+	ContainerID string `json:"containerId" gorm:"index"`
+	ActorName   string `json:"actor_name"`
+	From        Status `json:"from" gorm:"column:from_status"`
+	To          Status `json:"to" gorm:"column:to_status"`
+	Reason      string `json:"reason"`
+}
+
+// String 返回状态名称
+func (status Status) String() string {
+	if name, ok := statusNames[status]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseStatus 解析状态名称或状态值
+func ParseStatus(value string) (Status, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for status, name := range statusNames {
+		if name == value || strconv.Itoa(int(status)) == value {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// Usable 判断该状态下授权是否可用
+func (status Status) Usable() bool {
+	return status == StatusActive || status == StatusTrial
+}
+
+// CanTransit 判断是否允许变更到目标状态
+func (status Status) CanTransit(to Status) bool {
+	for _, next := range transitions[status] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Actions 返回当前状态下允许的操作及其目标状态
+func (status Status) Actions() map[string]Status {
+	res := make(map[string]Status, len(transitions[status]))
+	for _, next := range transitions[status] {
+		res[statusActions[next]] = next
+	}
+	return res
+}
+
+// Transition 按生命周期变更授权状态并记录变更历史，actor 为空时视为系统操作
+func (lic *License) Transition(to Status, reason string, actor *User) error {
+	return lic.TransitionTx(DB, to, reason, actor)
+}
+
+// TransitionTx 在指定事务中变更授权状态
+func (lic *License) TransitionTx(db *gorm.DB, to Status, reason string, actor *User) error {
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	from := lic.Status
+	if !from.CanTransit(to) {
+		return ErrTransitionNotAllowed
+	}
+
+	history := &LicenseHistory{
+		LicenseID:   lic.ID,
+		ContainerID: lic.ContainerID,
+		ActorName:   "system",
+		From:        from,
+		To:          to,
+		Reason:      reason,
+	}
+	if actor != nil {
+		history.Creator = actor.ID
+		history.ActorName = actor.UserName
+	}
+
+	var err error
+	// 吊销列表序号并发冲突时事务整体回滚，重试若干次
+	for i := 0; i < 3; i++ {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// 以原状态为条件更新，避免并发变更覆盖
+			result := tx.Model(&License{}).Where("id = ? AND status = ?", lic.ID, from).Update("status", to)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrTransitionNotAllowed
+			}
+			if err := tx.Create(history).Error; err != nil {
+				return err
+			}
+			return appendRevocation(tx, lic, from, to, reason)
+		})
+		if err == nil || err == ErrTransitionNotAllowed {
+			break
+		}
+	}
+	if err != nil {
+		if err != ErrTransitionNotAllowed {
+			util.Log().Warning("无法变更授权状态, %s", err)
+		}
+		return err
+	}
+	lic.Status = to
+	return nil
+}
+
+// GetLicenseHistories 分页查询授权状态变更历史
+func GetLicenseHistories(containerId string, page, size int) ([]LicenseHistory, int64) {
+	var (
+		histories []LicenseHistory
+		total     int64
+	)
+	dbChain := DB.Where("container_id = ?", containerId)
+
+	// 计算总数用于分页
+	dbChain.Model(&LicenseHistory{}).Count(&total)
+
+	// 查询记录
+	dbChain.Limit(size).Offset((page - 1) * size).Order("created_at desc").Find(&histories)
+
+	return histories, total
+}
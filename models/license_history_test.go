@@ -0,0 +1,93 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus_CanTransit(t *testing.T) {
+	asserts := assert.New(t)
+	all := []Status{StatusActive, StatusPending, StatusExpired, StatusTrial, StatusSuspended, StatusRevoked}
+	allowed := map[Status][]Status{
+		StatusPending:   {StatusTrial, StatusActive, StatusRevoked},
+		StatusTrial:     {StatusActive, StatusSuspended, StatusExpired, StatusRevoked},
+		StatusActive:    {StatusSuspended, StatusExpired, StatusRevoked},
+		StatusSuspended: {StatusActive, StatusTrial, StatusExpired, StatusRevoked},
+		StatusExpired:   {StatusActive, StatusTrial, StatusRevoked},
+	}
+	for _, from := range all {
+		for _, to := range all {
+			expected := false
+			for _, next := range allowed[from] {
+				expected = expected || next == to
+			}
+			asserts.Equal(expected, from.CanTransit(to), "%s -> %s", from, to)
+		}
+	}
+
+	// 已吊销为终态
+	asserts.Empty(StatusRevoked.Actions())
+	asserts.Equal(map[string]Status{"suspend": StatusSuspended, "expire": StatusExpired, "revoke": StatusRevoked}, StatusActive.Actions())
+}
+
+func TestLicense_Transition(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newTestLicense(t, "TestLicense_Transition", StatusPending)
+	actor := &User{UserName: "admin"}
+	actor.ID = 42
+
+	// 缺少原因
+	asserts.Equal(ErrReasonRequired, lic.Transition(StatusActive, "", actor))
+
+	// 不允许的变更不写入历史
+	asserts.Equal(ErrTransitionNotAllowed, lic.Transition(StatusSuspended, "suspend", actor))
+	histories, total := GetLicenseHistories(lic.ContainerID, 1, 10)
+	asserts.EqualValues(0, total)
+	asserts.Empty(histories)
+
+	// 管理员操作记录操作人
+	asserts.NoError(lic.Transition(StatusActive, "approve", actor))
+	asserts.Equal(StatusActive, lic.Status)
+	stored, err := GetLicense(lic.ContainerID)
+	asserts.NoError(err)
+	asserts.Equal(StatusActive, stored.Status)
+
+	// 系统操作
+	asserts.NoError(lic.Transition(StatusRevoked, "abuse", nil))
+
+	histories, total = GetLicenseHistories(lic.ContainerID, 1, 10)
+	asserts.EqualValues(2, total)
+	byReason := make(map[string]LicenseHistory)
+	for _, history := range histories {
+		byReason[history.Reason] = history
+	}
+	asserts.Equal(StatusPending, byReason["approve"].From)
+	asserts.Equal(StatusActive, byReason["approve"].To)
+	asserts.EqualValues(42, byReason["approve"].Creator)
+	asserts.Equal("admin", byReason["approve"].ActorName)
+	asserts.Equal(StatusRevoked, byReason["abuse"].To)
+	asserts.EqualValues(0, byReason["abuse"].Creator)
+	asserts.Equal("system", byReason["abuse"].ActorName)
+
+	// 吊销写入吊销列表
+	revoked := false
+	for _, revocation := range GetRevocationsSince(0, 1000) {
+		revoked = revoked || revocation.ContainerID == lic.ContainerID && revocation.Status == StatusRevoked
+	}
+	asserts.True(revoked)
+
+	// 终态不可再变更
+	asserts.Equal(ErrTransitionNotAllowed, lic.Transition(StatusActive, "restore", actor))
+}
+
+// TestLicense_TransitionStale 以原状态为条件更新，基于过期状态的并发变更失败
+func TestLicense_TransitionStale(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newTestLicense(t, "TestLicense_TransitionStale", StatusActive)
+	stale := *lic
+	asserts.NoError(lic.Transition(StatusSuspended, "suspend", nil))
+	asserts.Equal(ErrTransitionNotAllowed, stale.Transition(StatusExpired, "expire", nil))
+	_, total := GetLicenseHistories(lic.ContainerID, 1, 10)
+	asserts.EqualValues(1, total)
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"time"
+)
+
+var (
+	// ErrLeaseHeld 授权租约被其他实例占用
+	ErrLeaseHeld = errors.New("授权已被其他实例占用，请在原实例释放租约或租约过期后重试")
+	// ErrLeaseInvalid 授权租约无效或已过期
+	ErrLeaseInvalid = errors.New("授权租约无效或已过期，请重新校验授权")
+)
+
+// AcquireLease 为实例申请授权租约，原租约过期且超过宽限期后才允许其他实例接管，
+// force 为 true 时忽略其他实例持有的租约
+func (lic *License) AcquireLease(instanceID string, force bool) error {
+	now := time.Now()
+	expire := now.Add(time.Duration(conf.LicenseConfig.LeaseTTL) * time.Second)
+	leaseID := util.RandStringRunes(32)
+
+	tx := DB.Model(&License{}).Where("id = ?", lic.ID)
+	if !force {
+		tx = tx.Where("(lease_instance IN ? OR lease_expire IS NULL OR lease_expire < ?)",
+			[]string{"", instanceID}, now.Add(-leaseGrace()))
+	}
+	result := tx.Updates(map[string]interface{}{
+		"lease_id":         leaseID,
+		"lease_instance":   instanceID,
+		"lease_expire":     expire,
+		"last_online_time": now.Format(util.FORMAT_DATETIME_Y4MDHMS),
+	})
+	if result.Error != nil {
+		util.Log().Warning("无法分配授权租约, %s", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseHeld
+	}
+
+	lic.LeaseID = leaseID
+	lic.LeaseInstance = instanceID
+	lic.LeaseExpire = &expire
+	return nil
+}
+
+// RenewLease 续期授权租约，租约过期超过宽限期后不再允许续期
+func (lic *License) RenewLease(leaseID, instanceID string) error {
+	now := time.Now()
+	expire := now.Add(time.Duration(conf.LicenseConfig.LeaseTTL) * time.Second)
+
+	result := DB.Model(&License{}).
+		Where("id = ? AND lease_id = ? AND lease_instance = ? AND lease_expire >= ?",
+			lic.ID, leaseID, instanceID, now.Add(-leaseGrace())).
+		Updates(map[string]interface{}{
+			"lease_expire":     expire,
+			"last_online_time": now.Format(util.FORMAT_DATETIME_Y4MDHMS),
+		})
+	if result.Error != nil {
+		util.Log().Warning("无法续期授权租约, %s", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseInvalid
+	}
+
+	lic.LeaseID = leaseID
+	lic.LeaseInstance = instanceID
+	lic.LeaseExpire = &expire
+	return nil
+}
+
+// ReleaseLease 释放授权租约
+func (lic *License) ReleaseLease(leaseID, instanceID string) error {
+	result := DB.Model(&License{}).
+		Where("id = ? AND lease_id = ? AND lease_instance = ?", lic.ID, leaseID, instanceID).
+		Updates(map[string]interface{}{
+			"lease_id":       "",
+			"lease_instance": "",
+			"lease_expire":   nil,
+		})
+	if result.Error != nil {
+		util.Log().Warning("无法释放授权租约, %s", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseInvalid
+	}
+
+	lic.LeaseID = ""
+	lic.LeaseInstance = ""
+	lic.LeaseExpire = nil
+	return nil
+}
+
+func leaseGrace() time.Duration {
+	return time.Duration(conf.LicenseConfig.LeaseGrace) * time.Second
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	// RevocationRevoke 授权被吊销或暂停
+	RevocationRevoke = "revoke"
+	// RevocationReinstate 授权恢复可用
+	RevocationReinstate = "reinstate"
+)
+
+// LicenseRevocation 授权吊销列表条目，Seq 单调递增，客户端按序号增量拉取
+type LicenseRevocation struct {
+	Auditable
+	Seq         uint64    `json:"seq" gorm:"uniqueIndex"`
+	LicenseID   uint64    `json:"-" gorm:"index"`
+	ContainerID string    `json:"containerId" gorm:"index"`
+	Action      string    `json:"action"`
+	Status      Status    `json:"status"`
+	Reason      string    `json:"reason"`
+	RevokedAt   time.Time `json:"revoked_at"`
+}
+
+// revocationAction 根据状态变更判断吊销列表操作，无需记录时返回空
+func revocationAction(from, to Status) string {
+	switch {
+	case from.Usable() && (to == StatusSuspended || to == StatusRevoked):
+		return RevocationRevoke
+	case from == StatusSuspended && to == StatusRevoked:
+		return RevocationRevoke
+	case !from.Usable() && to.Usable() && from != StatusPending:
+		return RevocationReinstate
+	}
+	return ""
+}
+
+// appendRevocation 在状态变更事务中追加吊销列表条目
+func appendRevocation(tx *gorm.DB, lic *License, from, to Status, reason string) error {
+	action := revocationAction(from, to)
+	if action == "" {
+		return nil
+	}
+	return createRevocation(tx, lic.ID, lic.ContainerID, action, to, reason)
+}
+
+// createRevocation 以当前最大序号加一插入吊销列表条目
+func createRevocation(tx *gorm.DB, licenseID uint64, containerId, action string, status Status, reason string) error {
+	var last LicenseRevocation
+	if err := tx.Unscoped().Select("seq").Order("seq desc").Limit(1).Find(&last).Error; err != nil {
+		return err
+	}
+	return tx.Create(&LicenseRevocation{
+		Seq:         last.Seq + 1,
+		LicenseID:   licenseID,
+		ContainerID: containerId,
+		Action:      action,
+		Status:      status,
+		Reason:      reason,
+		RevokedAt:   time.Now(),
+	}).Error
+}
+
+// GetRevocationsSince 查询序号大于 since 的吊销列表条目，按序号升序返回
+func GetRevocationsSince(since uint64, limit int) []LicenseRevocation {
+	var revocations []LicenseRevocation
+	DB.Where("seq > ?", since).Order("seq asc").Limit(limit).Find(&revocations)
+	return revocations
+}
+
+// GetRevocationSeq 返回吊销列表当前最大序号
+func GetRevocationSeq() uint64 {
+	var last LicenseRevocation
+	DB.Unscoped().Select("seq").Order("seq desc").Limit(1).Find(&last)
+	return last.Seq
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFloating 授权不是浮动授权
+	ErrNotFloating = errors.New("该授权不是浮动授权")
+	// ErrSeatInvalid 席位无效或已过期
+	ErrSeatInvalid = errors.New("授权席位无效或已过期，请重新签出")
+	// ErrSeatRequired 浮动授权未签出席位
+	ErrSeatRequired = errors.New("浮动授权须先通过 /license/seat/checkout 签出席位")
+)
+
+// LicenseSeat 浮动授权席位，每个授权按席位数预置 Slot 为 0 ~ Seats-1 的记录，
+// 签出、续期及签入均以条件更新抢占记录，多个主节点之间由数据库保证一致
+type LicenseSeat struct {
+	Auditable
+	LicenseID  uint64     `json:"-" gorm:"uniqueIndex:idx_license_seat"`
+	Slot       int        `json:"slot" gorm:"uniqueIndex:idx_license_seat"`
+	SeatID     string     `json:"-" gorm:"index"`
+	InstanceID string     `json:"instanceId"`
+	CheckoutAt *time.Time `json:"checkout_at"`
+	Expire     *time.Time `json:"expire"`
+}
+
+// SeatsInUseError 席位已全部被占用，Holders 为当前持有席位的实例
+type SeatsInUseError struct {
+	Seats   int
+	Holders []LicenseSeat
+}
+
+func (e *SeatsInUseError) Error() string {
+	instances := make([]string, 0, len(e.Holders))
+	for _, seat := range e.Holders {
+		instances = append(instances, seat.InstanceID)
+	}
+	return fmt.Sprintf("授权席位已全部占用（%d/%d），当前持有实例：%s",
+		len(e.Holders), e.Seats, strings.Join(instances, ", "))
+}
+
+// Floating 判断是否为浮动授权
+func (lic *License) Floating() bool {
+	return lic.Seats > 0
+}
+
+// SetSeats 设置浮动授权席位数，0 表示取消浮动授权；
+// 减少席位时直接移除多出的席位，持有实例在下次续期时失效
+func (lic *License) SetSeats(seats int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&License{}).Where("id = ?", lic.ID).Updates(map[string]interface{}{
+			"seats":    seats,
+			"revision": gorm.Expr("revision + ?", 1),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("license_id = ? AND slot >= ?", lic.ID, seats).Delete(&LicenseSeat{}).Error
+	})
+	if err != nil {
+		util.Log().Warning("无法设置授权席位, %s", err)
+		return err
+	}
+	lic.Seats = seats
+	lic.Revision++
+	return nil
+}
+
+// CheckoutSeat 为实例签出席位，实例已持有有效席位时重新签发该席位
+func (lic *License) CheckoutSeat(instanceID string) (*LicenseSeat, error) {
+	if !lic.Floating() {
+		return nil, ErrNotFloating
+	}
+	if err := lic.ensureSeats(); err != nil {
+		util.Log().Warning("无法初始化授权席位, %s", err)
+		return nil, err
+	}
+	now := time.Now()
+	stale := now.Add(-leaseGrace())
+	values := seatValues(now, instanceID)
+	values["checkout_at"] = now
+
+	// 优先复用实例自身持有的席位，避免重复签出占用多个席位
+	result := DB.Model(&LicenseSeat{}).
+		Where("license_id = ? AND slot < ? AND instance_id = ? AND expire >= ?", lic.ID, lic.Seats, instanceID, stale).
+		Updates(values)
+	if result.Error != nil {
+		util.Log().Warning("无法签出授权席位, %s", result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var slots []int
+		DB.Model(&LicenseSeat{}).
+			Where("license_id = ? AND slot < ? AND (instance_id = '' OR expire IS NULL OR expire < ?)", lic.ID, lic.Seats, stale).
+			Order("slot").Pluck("slot", &slots)
+		// 以空闲条件更新抢占席位，被其他节点抢先时尝试下一个
+		for _, slot := range slots {
+			result = DB.Model(&LicenseSeat{}).
+				Where("license_id = ? AND slot = ? AND (instance_id = '' OR expire IS NULL OR expire < ?)", lic.ID, slot, stale).
+				Updates(values)
+			if result.Error != nil {
+				util.Log().Warning("无法签出授权席位, %s", result.Error)
+				return nil, result.Error
+			}
+			if result.RowsAffected > 0 {
+				break
+			}
+		}
+	}
+	if result.RowsAffected == 0 {
+		return nil, &SeatsInUseError{Seats: lic.Seats, Holders: lic.GetSeatHolders()}
+	}
+	lic.touch(now)
+	return lic.getSeat(values["seat_id"].(string), instanceID)
+}
+
+// RenewSeat 续期席位，席位过期超过宽限期或已被移除后不再允许续期
+func (lic *License) RenewSeat(seatID, instanceID string) (*LicenseSeat, error) {
+	now := time.Now()
+	values := seatValues(now, instanceID)
+	values["seat_id"] = seatID
+	result := DB.Model(&LicenseSeat{}).
+		Where("license_id = ? AND slot < ? AND seat_id = ? AND instance_id = ? AND expire >= ?",
+			lic.ID, lic.Seats, seatID, instanceID, now.Add(-leaseGrace())).
+		Updates(values)
+	if result.Error != nil {
+		util.Log().Warning("无法续期授权席位, %s", result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrSeatInvalid
+	}
+	lic.touch(now)
+	return lic.getSeat(seatID, instanceID)
+}
+
+// CheckinSeat 签入席位
+func (lic *License) CheckinSeat(seatID, instanceID string) error {
+	result := DB.Model(&LicenseSeat{}).
+		Where("license_id = ? AND seat_id = ? AND instance_id = ?", lic.ID, seatID, instanceID).
+		Updates(emptySeat())
+	if result.Error != nil {
+		util.Log().Warning("无法签入授权席位, %s", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSeatInvalid
+	}
+	return nil
+}
+
+// checkSeat 校验实例是否持有有效席位
+func (lic *License) checkSeat(seatID, instanceID string) error {
+	if seatID == "" {
+		return ErrSeatRequired
+	}
+	var count int64
+	DB.Model(&LicenseSeat{}).
+		Where("license_id = ? AND slot < ? AND seat_id = ? AND instance_id = ? AND expire >= ?",
+			lic.ID, lic.Seats, seatID, instanceID, time.Now().Add(-leaseGrace())).
+		Count(&count)
+	if count == 0 {
+		return ErrSeatInvalid
+	}
+	return nil
+}
+
+// GetSeatHolders 查询当前持有有效席位的实例
+func (lic *License) GetSeatHolders() []LicenseSeat {
+	var seats []LicenseSeat
+	DB.Where("license_id = ? AND slot < ? AND instance_id <> '' AND expire >= ?",
+		lic.ID, lic.Seats, time.Now().Add(-leaseGrace())).
+		Order("slot").Find(&seats)
+	return seats
+}
+
+// ReleaseSeats 释放授权的全部席位
+func (lic *License) ReleaseSeats() error {
+	return releaseSeats(DB, lic.ID)
+}
+
+func releaseSeats(tx *gorm.DB, licenseID uint64) error {
+	return tx.Model(&LicenseSeat{}).Where("license_id = ? AND instance_id <> ''", licenseID).Updates(emptySeat()).Error
+}
+
+// ensureSeats 补齐席位记录，已存在的席位不受影响
+func (lic *License) ensureSeats() error {
+	var count int64
+	DB.Model(&LicenseSeat{}).Where("license_id = ? AND slot < ?", lic.ID, lic.Seats).Count(&count)
+	if int(count) >= lic.Seats {
+		return nil
+	}
+	seats := make([]LicenseSeat, 0, lic.Seats)
+	for slot := 0; slot < lic.Seats; slot++ {
+		seats = append(seats, LicenseSeat{LicenseID: lic.ID, Slot: slot})
+	}
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&seats).Error
+}
+
+func (lic *License) getSeat(seatID, instanceID string) (*LicenseSeat, error) {
+	var seat LicenseSeat
+	if err := DB.Where("license_id = ? AND seat_id = ? AND instance_id = ?", lic.ID, seatID, instanceID).First(&seat).Error; err != nil {
+		return nil, err
+	}
+	return &seat, nil
+}
+
+// seatValues 签出或续期席位时更新的字段，席位有效期与授权租约一致
+func seatValues(now time.Time, instanceID string) map[string]interface{} {
+	return map[string]interface{}{
+		"seat_id":     util.RandStringRunes(32),
+		"instance_id": instanceID,
+		"expire":      now.Add(time.Duration(conf.LicenseConfig.LeaseTTL) * time.Second),
+	}
+}
+
+// touch 同步授权最近在线时间
+func (lic *License) touch(now time.Time) {
+	DB.Model(&License{}).Where("id = ?", lic.ID).Update("last_online_time", now.Format(util.FORMAT_DATETIME_Y4MDHMS))
+}
+
+func emptySeat() map[string]interface{} {
+	return map[string]interface{}{
+		"seat_id":     "",
+		"instance_id": "",
+		"checkout_at": nil,
+		"expire":      nil,
+	}
+}
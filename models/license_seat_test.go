@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFloatingLicense 创建指定席位数的可用浮动授权
+func newFloatingLicense(t *testing.T, containerId string, seats int) *License {
+	lic := newTestLicense(t, containerId, StatusActive)
+	if err := lic.SetSeats(seats); err != nil {
+		t.Fatal(err)
+	}
+	return lic
+}
+
+// expireSeat 将席位有效期调整为超出宽限期
+func expireSeat(seat *LicenseSeat) {
+	DB.Model(&LicenseSeat{}).Where("id = ?", seat.ID).Update("expire", time.Now().Add(-leaseGrace()-time.Minute))
+}
+
+func TestLicense_CheckoutSeat(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 非浮动授权
+	_, err := newTestLicense(t, "TestLicense_CheckoutSeat_fixed", StatusActive).CheckoutSeat("a")
+	asserts.Equal(ErrNotFloating, err)
+
+	lic := newFloatingLicense(t, "TestLicense_CheckoutSeat", 2)
+	a, err := lic.CheckoutSeat("a")
+	asserts.NoError(err)
+	asserts.NotEmpty(a.SeatID)
+	asserts.Equal("a", a.InstanceID)
+	asserts.NotNil(a.Expire)
+
+	// 重复签出复用原席位并重新签发席位ID
+	again, err := lic.CheckoutSeat("a")
+	asserts.NoError(err)
+	asserts.Equal(a.Slot, again.Slot)
+	asserts.NotEqual(a.SeatID, again.SeatID)
+
+	b, err := lic.CheckoutSeat("b")
+	asserts.NoError(err)
+	asserts.NotEqual(a.Slot, b.Slot)
+
+	// 席位已全部占用时返回当前持有实例
+	_, err = lic.CheckoutSeat("c")
+	var inUse *SeatsInUseError
+	if asserts.True(errors.As(err, &inUse)) {
+		asserts.Equal(2, inUse.Seats)
+		asserts.Len(inUse.Holders, 2)
+	}
+	asserts.Len(lic.GetSeatHolders(), 2)
+
+	// 过期超过宽限期的席位可被其他实例签出
+	expireSeat(b)
+	c, err := lic.CheckoutSeat("c")
+	asserts.NoError(err)
+	asserts.Equal(b.Slot, c.Slot)
+}
+
+func TestLicense_RenewSeat(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newFloatingLicense(t, "TestLicense_RenewSeat", 1)
+	seat, err := lic.CheckoutSeat("a")
+	asserts.NoError(err)
+
+	renewed, err := lic.RenewSeat(seat.SeatID, "a")
+	asserts.NoError(err)
+	asserts.Equal(seat.Slot, renewed.Slot)
+	asserts.False(renewed.Expire.Before(*seat.Expire))
+
+	// 席位ID或实例不匹配
+	_, err = lic.RenewSeat(seat.SeatID, "b")
+	asserts.Equal(ErrSeatInvalid, err)
+	_, err = lic.RenewSeat("unknown", "a")
+	asserts.Equal(ErrSeatInvalid, err)
+
+	// 过期超过宽限期后不再允许续期
+	expireSeat(renewed)
+	_, err = lic.RenewSeat(renewed.SeatID, "a")
+	asserts.Equal(ErrSeatInvalid, err)
+
+	// 减少席位后被移除的席位不再允许续期
+	lic = newFloatingLicense(t, "TestLicense_RenewSeat_shrink", 2)
+	_, err = lic.CheckoutSeat("a")
+	asserts.NoError(err)
+	seat, err = lic.CheckoutSeat("b")
+	asserts.NoError(err)
+	asserts.NoError(lic.SetSeats(1))
+	_, err = lic.RenewSeat(seat.SeatID, "b")
+	asserts.Equal(ErrSeatInvalid, err)
+}
+
+func TestLicense_CheckinSeat(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newFloatingLicense(t, "TestLicense_CheckinSeat", 1)
+	seat, err := lic.CheckoutSeat("a")
+	asserts.NoError(err)
+
+	asserts.Equal(ErrSeatInvalid, lic.CheckinSeat(seat.SeatID, "b"))
+	asserts.NoError(lic.CheckinSeat(seat.SeatID, "a"))
+	asserts.Equal(ErrSeatInvalid, lic.CheckinSeat(seat.SeatID, "a"))
+	asserts.Empty(lic.GetSeatHolders())
+
+	// 签入后席位可被其他实例签出
+	_, err = lic.CheckoutSeat("b")
+	asserts.NoError(err)
+}
+
+func TestLicense_VerifyFloating(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newFloatingLicense(t, "TestLicense_VerifyFloating", 1)
+	req := &License{Name: lic.Name, ContainerID: lic.ContainerID}
+
+	// 未签出席位
+	_, err := lic.Verify(req, "a", "")
+	asserts.Equal(ErrSeatRequired, err)
+
+	seat, err := lic.CheckoutSeat("a")
+	asserts.NoError(err)
+	res, err := lic.Verify(req, "a", seat.SeatID)
+	asserts.NoError(err)
+	asserts.Equal(lic.ID, res.ID)
+
+	// 席位属于其他实例或已签入
+	_, err = lic.Verify(req, "b", seat.SeatID)
+	asserts.Equal(ErrSeatInvalid, err)
+	asserts.NoError(lic.CheckinSeat(seat.SeatID, "a"))
+	_, err = lic.Verify(req, "a", seat.SeatID)
+	asserts.Equal(ErrSeatInvalid, err)
+
+	// 席位过期超过宽限期
+	seat, err = lic.CheckoutSeat("a")
+	asserts.NoError(err)
+	expireSeat(seat)
+	_, err = lic.Verify(req, "a", seat.SeatID)
+	asserts.Equal(ErrSeatInvalid, err)
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+// ErrInvalidTerm 授权期限不合法
+var ErrInvalidTerm = errors.New("授权期限不合法，结束日期须晚于开始日期")
+
+// LicenseTerm 授权期限，Start 起生效，End 当日起失效，日期格式与 License.Expire 一致；
+// 授权的有效期由全部期限合并计算，Creator 为办理续期的操作人；
+// Adjust 为调整记录，不增加期限，仅将在其之前办理的期限截止到 End
+type LicenseTerm struct {
+	Auditable
+	LicenseID   uint64 `json:"license_id" gorm:"index"`
+	ContainerID string `json:"containerId" gorm:"index"`
+	Start       string `json:"start" gorm:"column:start_date;index"`
+	End         string `json:"end" gorm:"column:end_date;index"`
+	Plan        string `json:"plan"`
+	OrderRef    string `json:"order_ref" gorm:"index"`
+	Adjust      bool   `json:"adjust"`
+}
+
+// Valid 校验期限日期
+func (term *LicenseTerm) Valid() bool {
+	if _, err := time.Parse(util.FORMAT_DATE_y4Md, term.Start); err != nil {
+		return false
+	}
+	if _, err := time.Parse(util.FORMAT_DATE_y4Md, term.End); err != nil {
+		return false
+	}
+	return term.Start < term.End
+}
+
+// EffectiveExpire 合并相互重叠或首尾相接的期限，计算 day 当天的有效期：
+// day 处于某段连续期限内时返回该段的结束日期；否则返回 day 之前最近一段的结束日期；
+// 仅有未来期限时返回 day，即当前不可用。调整记录先按办理顺序截断之前的期限
+func EffectiveExpire(terms []LicenseTerm, day string) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	sorted := adjustTerms(terms)
+	if len(sorted) == 0 {
+		return day
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	expire := day
+	start, end := sorted[0].Start, sorted[0].End
+	for _, term := range sorted[1:] {
+		if term.Start <= end {
+			if term.End > end {
+				end = term.End
+			}
+			continue
+		}
+		if end > day && start <= day {
+			return end
+		}
+		if end <= day {
+			expire = end
+		}
+		start, end = term.Start, term.End
+	}
+	if start <= day {
+		return end
+	}
+	return expire
+}
+
+// adjustTerms 按办理顺序应用调整记录，返回截断后的期限副本，不修改原期限；
+// ID 按生成时间递增，调整之后办理的期限不受影响
+func adjustTerms(terms []LicenseTerm) []LicenseTerm {
+	ordered := append([]LicenseTerm(nil), terms...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].ID < ordered[j].ID
+	})
+	res := make([]LicenseTerm, 0, len(ordered))
+	for _, term := range ordered {
+		if !term.Adjust {
+			res = append(res, term)
+			continue
+		}
+		kept := res[:0]
+		for _, prev := range res {
+			if prev.Start >= term.End {
+				continue
+			}
+			if prev.End > term.End {
+				prev.End = term.End
+			}
+			kept = append(kept, prev)
+		}
+		res = kept
+	}
+	return res
+}
+
+// GetLicenseTerms 查询授权的全部期限，按开始日期排序
+func GetLicenseTerms(containerId string) []LicenseTerm {
+	var terms []LicenseTerm
+	DB.Where("container_id = ?", containerId).Order("start_date asc, created_at asc").Find(&terms)
+	return terms
+}
+
+// Renew 为授权追加期限并重新计算有效期；
+// 首次续期时将原有效期记录为初始期限，续期后授权重新覆盖当天时自动恢复已过期的授权
+func (lic *License) Renew(term *LicenseTerm, actor *User) error {
+	return lic.RenewTx(DB, term, actor)
+}
+
+// RenewTx 在指定事务中为授权追加期限
+func (lic *License) RenewTx(db *gorm.DB, term *LicenseTerm, actor *User) error {
+	if !term.Valid() {
+		return ErrInvalidTerm
+	}
+	term.LicenseID = lic.ID
+	term.ContainerID = lic.ContainerID
+	if actor != nil {
+		term.Creator = actor.ID
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lic.initialTerm(tx); err != nil {
+			return err
+		}
+		if err := tx.Create(term).Error; err != nil {
+			return err
+		}
+		return lic.applyTerms(tx)
+	})
+	if err != nil {
+		util.Log().Warning("无法插入授权期限, %s", err)
+		return err
+	}
+	return lic.reinstate(db, "授权续期", actor)
+}
+
+// SetExpire 直接指定授权有效期，end 须晚于当天。晚于当前有效期时按手动续期追加期限；
+// 原为永久授权时追加自当天起的期限；早于当前有效期时追加调整记录，原有期限保持不变
+func (lic *License) SetExpire(end string, actor *User) error {
+	today := time.Now().Format(util.FORMAT_DATE_y4Md)
+	if _, err := time.Parse(util.FORMAT_DATE_y4Md, end); err != nil || end <= today {
+		return ErrInvalidTerm
+	}
+	if lic.Expire != "" && end > lic.Expire {
+		start := lic.Expire
+		if lic.Expired() {
+			start = today
+		}
+		return lic.Renew(&LicenseTerm{Start: start, End: end, Plan: "manual"}, actor)
+	}
+
+	term := &LicenseTerm{
+		LicenseID:   lic.ID,
+		ContainerID: lic.ContainerID,
+		Start:       today,
+		End:         end,
+		Plan:        "manual",
+		Adjust:      lic.Expire != "",
+	}
+	if actor != nil {
+		term.Creator = actor.ID
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lic.initialTerm(tx); err != nil {
+			return err
+		}
+		if err := tx.Create(term).Error; err != nil {
+			return err
+		}
+		return lic.applyTerms(tx)
+	})
+	if err != nil {
+		util.Log().Warning("无法更新授权有效期, %s", err)
+	}
+	return err
+}
+
+// initialTerm 授权尚无期限时，将原有效期记录为初始期限
+func (lic *License) initialTerm(tx *gorm.DB) error {
+	var count int64
+	if err := tx.Model(&LicenseTerm{}).Where("license_id = ?", lic.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 || lic.Expire == "" {
+		return nil
+	}
+	initial := &LicenseTerm{
+		LicenseID:   lic.ID,
+		ContainerID: lic.ContainerID,
+		Start:       lic.CreatedAt.Format(util.FORMAT_DATE_y4Md),
+		End:         lic.Expire,
+		Plan:        "initial",
+	}
+	if initial.Start >= initial.End {
+		initial.Start = time.Now().Format(util.FORMAT_DATE_y4Md)
+	}
+	if !initial.Valid() {
+		return nil
+	}
+	return tx.Create(initial).Error
+}
+
+// applyTerms 根据期限重新计算有效期，有效期变化时递增载荷版本以通知客户端刷新
+func (lic *License) applyTerms(tx *gorm.DB) error {
+	var terms []LicenseTerm
+	if err := tx.Where("license_id = ?", lic.ID).Find(&terms).Error; err != nil {
+		return err
+	}
+	expire := EffectiveExpire(terms, time.Now().Format(util.FORMAT_DATE_y4Md))
+	if expire == lic.Expire {
+		return nil
+	}
+	if err := tx.Model(&License{}).Where("id = ?", lic.ID).Updates(map[string]interface{}{
+		"expire":   expire,
+		"revision": gorm.Expr("revision + ?", 1),
+	}).Error; err != nil {
+		return err
+	}
+	lic.Expire = expire
+	lic.Revision++
+	return nil
+}
+
+// reinstate 已过期授权重新处于有效期内时恢复为可用
+func (lic *License) reinstate(db *gorm.DB, reason string, actor *User) error {
+	if lic.Status != StatusExpired || lic.Expired() {
+		return nil
+	}
+	return lic.TransitionTx(db, StatusActive, reason, actor)
+}
+
+// ApplyDueTerms 为当天开始生效、但有效期尚未更新的授权重新计算有效期，返回更新数量
+func ApplyDueTerms() int {
+	var (
+		licenses []License
+		count    int
+	)
+	today := time.Now().Format(util.FORMAT_DATE_y4Md)
+	due := DB.Model(&LicenseTerm{}).Select("license_id").Where("start_date <= ? AND end_date > ? AND adjust = ?", today, today, false)
+	DB.Where("id IN (?) AND expire <= ?", due, today).Find(&licenses)
+	for i := range licenses {
+		if err := licenses[i].applyTerms(DB); err != nil {
+			util.Log().Warning("无法更新授权有效期, %s", err)
+			continue
+		}
+		if err := licenses[i].reinstate(DB, "续期生效", nil); err != nil {
+			continue
+		}
+		count++
+	}
+	return count
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/util"
+)
+
+// day 返回相对当天偏移 offset 天的日期
+func day(offset int) string {
+	return time.Now().AddDate(0, 0, offset).Format(util.FORMAT_DATE_y4Md)
+}
+
+func TestEffectiveExpire(t *testing.T) {
+	asserts := assert.New(t)
+	term := func(start, end string) LicenseTerm {
+		return LicenseTerm{Start: start, End: end}
+	}
+
+	// 没有期限时为永久授权
+	asserts.Equal("", EffectiveExpire(nil, "20240115"))
+
+	// 处于期限内
+	asserts.Equal("20240201", EffectiveExpire([]LicenseTerm{term("20240101", "20240201")}, "20240115"))
+
+	// 首尾相接及相互重叠的期限合并，与顺序无关
+	terms := []LicenseTerm{term("20240301", "20240401"), term("20240101", "20240201"), term("20240201", "20240310")}
+	asserts.Equal("20240401", EffectiveExpire(terms, "20240115"))
+
+	// 期限之间存在间隔时只计算当天所在的一段
+	terms = []LicenseTerm{term("20240101", "20240201"), term("20240301", "20240401")}
+	asserts.Equal("20240201", EffectiveExpire(terms, "20240115"))
+	asserts.Equal("20240401", EffectiveExpire(terms, "20240315"))
+
+	// 处于间隔内时返回之前最近一段的结束日期
+	asserts.Equal("20240201", EffectiveExpire(terms, "20240215"))
+
+	// 结束日期当天起失效
+	asserts.Equal("20240201", EffectiveExpire([]LicenseTerm{term("20240101", "20240201")}, "20240201"))
+
+	// 仅有未来期限时当前不可用
+	asserts.Equal("20240115", EffectiveExpire([]LicenseTerm{term("20240201", "20240301")}, "20240115"))
+
+	// 调整记录截断之前办理的期限，之后办理的期限不受影响
+	adjust := term("20240115", "20240120")
+	adjust.ID, adjust.Adjust = 2, true
+	terms = []LicenseTerm{term("20240101", "20240201"), adjust, term("20240301", "20240401")}
+	terms[0].ID, terms[2].ID = 1, 3
+	asserts.Equal("20240120", EffectiveExpire(terms, "20240115"))
+	asserts.Equal("20240401", EffectiveExpire(terms, "20240315"))
+	asserts.Equal("20240201", terms[0].End)
+}
+
+func TestLicense_Renew(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newTestLicense(t, "TestLicense_Renew", StatusActive)
+	lic.Expire = day(10)
+	DB.Model(lic).Update("expire", lic.Expire)
+
+	// 结束日期不晚于开始日期
+	asserts.Equal(ErrInvalidTerm, lic.Renew(&LicenseTerm{Start: day(10), End: day(10)}, nil))
+
+	// 首次续期时记录初始期限
+	asserts.NoError(lic.Renew(&LicenseTerm{Start: day(10), End: day(40), Plan: "yearly"}, nil))
+	asserts.Equal(day(40), lic.Expire)
+	terms := GetLicenseTerms(lic.ContainerID)
+	asserts.Len(terms, 2)
+	asserts.Equal("initial", terms[0].Plan)
+	asserts.Equal(day(10), terms[0].End)
+}
+
+func TestLicense_SetExpire(t *testing.T) {
+	asserts := assert.New(t)
+	actor := &User{UserName: "admin"}
+	actor.ID = 7
+
+	// 不晚于当天或格式错误
+	lic := newTestLicense(t, "TestLicense_SetExpire", StatusActive)
+	asserts.Equal(ErrInvalidTerm, lic.SetExpire(day(0), actor))
+	asserts.Equal(ErrInvalidTerm, lic.SetExpire("2024-01-01", actor))
+
+	// 永久授权设置有效期
+	asserts.NoError(lic.SetExpire(day(30), actor))
+	asserts.Equal(day(30), lic.Expire)
+	terms := GetLicenseTerms(lic.ContainerID)
+	asserts.Len(terms, 1)
+	asserts.Equal("manual", terms[0].Plan)
+	asserts.EqualValues(7, terms[0].Creator)
+
+	// 延长有效期
+	asserts.NoError(lic.SetExpire(day(60), actor))
+	asserts.Equal(day(60), lic.Expire)
+
+	// 缩短有效期，追加调整记录，原有期限保持不变
+	before := GetLicenseTerms(lic.ContainerID)
+	asserts.NoError(lic.SetExpire(day(20), actor))
+	asserts.Equal(day(20), lic.Expire)
+	stored, _ := GetLicense(lic.ContainerID)
+	asserts.Equal(day(20), stored.Expire)
+	after := make(map[uint64]LicenseTerm)
+	for _, term := range GetLicenseTerms(lic.ContainerID) {
+		after[term.ID] = term
+	}
+	asserts.Len(after, len(before)+1)
+	for _, term := range before {
+		asserts.Equal(term.End, after[term.ID].End)
+		delete(after, term.ID)
+	}
+	for _, term := range after {
+		asserts.True(term.Adjust)
+		asserts.Equal(day(20), term.End)
+	}
+
+	// 缩短到已续期但尚未开始的期限之前，该期限保留但不再计入
+	asserts.NoError(lic.Renew(&LicenseTerm{Start: day(25), End: day(50), Plan: "prepaid"}, nil))
+	asserts.Equal(day(20), lic.Expire)
+	asserts.NoError(lic.SetExpire(day(15), actor))
+	asserts.Equal(day(15), lic.Expire)
+	prepaid := 0
+	for _, term := range GetLicenseTerms(lic.ContainerID) {
+		if term.Plan == "prepaid" {
+			prepaid++
+			asserts.Equal(day(50), term.End)
+		}
+	}
+	asserts.Equal(1, prepaid)
+
+	// 调整之后续期的期限正常计入
+	asserts.NoError(lic.SetExpire(day(40), actor))
+	asserts.Equal(day(40), lic.Expire)
+}
+
+func TestApplyDueTerms(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 已过期授权在预付期限开始当天恢复可用
+	lic := newTestLicense(t, "TestApplyDueTerms", StatusExpired)
+	lic.Expire = day(0)
+	DB.Model(lic).Update("expire", lic.Expire)
+	asserts.NoError(DB.Create(&LicenseTerm{LicenseID: lic.ID, ContainerID: lic.ContainerID, Start: day(-30), End: day(0)}).Error)
+	asserts.NoError(DB.Create(&LicenseTerm{LicenseID: lic.ID, ContainerID: lic.ContainerID, Start: day(0), End: day(30)}).Error)
+
+	// 期限尚未开始的授权不受影响
+	future := newTestLicense(t, "TestApplyDueTerms_future", StatusActive)
+	future.Expire = day(5)
+	DB.Model(future).Update("expire", future.Expire)
+	asserts.NoError(DB.Create(&LicenseTerm{LicenseID: future.ID, ContainerID: future.ContainerID, Start: day(5), End: day(30)}).Error)
+
+	asserts.GreaterOrEqual(ApplyDueTerms(), 1)
+	stored, _ := GetLicense(lic.ContainerID)
+	asserts.Equal(day(30), stored.Expire)
+	asserts.Equal(StatusActive, stored.Status)
+	stored, _ = GetLicense(future.ContainerID)
+	asserts.Equal(day(5), stored.Expire)
+
+	// 再次执行时没有需要更新的授权
+	asserts.Equal(0, ApplyDueTerms())
+}
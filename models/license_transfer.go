@@ -0,0 +1,163 @@
+package models
+
+import (
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	// ErrTransferTargetExists 目标容器已存在授权
+	ErrTransferTargetExists = errors.New("目标容器已存在授权")
+	// ErrTransferQuotaExceeded 自助迁移次数已用完
+	ErrTransferQuotaExceeded = errors.New("自助迁移次数已用完，请稍后重试或联系管理员")
+	// ErrTransferDisabled 自助迁移未开启
+	ErrTransferDisabled = errors.New("未开启自助迁移，请联系管理员")
+	// ErrTransferInUse 原容器仍在使用授权
+	ErrTransferInUse = errors.New("原容器仍持有授权租约，请停止原容器或等待租约过期后重试")
+	// ErrTransferStale 授权在迁移过程中已被删除或迁移
+	ErrTransferStale = errors.New("授权已被删除或迁移，请刷新后重试")
+	// ErrTransferFloating 浮动授权不绑定容器
+	ErrTransferFloating = errors.New("浮动授权不绑定容器，无需迁移，请直接签出席位")
+)
+
+// licenseOwnedTables 迁移时随授权一同变更容器ID的关联记录
+var licenseOwnedTables = []interface{}{
+	&LicenseBinding{}, &LicenseTerm{}, &LicenseHistory{}, &LicenseExpiryEvent{},
+	&FingerprintMismatch{}, &LicenseFile{},
+}
+
+// LicenseTransfer 授权迁移记录，Creator 为操作人，自助迁移时为 0
+type LicenseTransfer struct {
+	Auditable
+	LicenseID     uint64 `json:"license_id" gorm:"index"`
+	FromContainer string `json:"from_container" gorm:"index"`
+	ToContainer   string `json:"to_container" gorm:"index"`
+	ActorName     string `json:"actor_name"`
+	Reason        string `json:"reason"`
+	SelfService   bool   `json:"self_service"`
+}
+
+// TransferQuota 返回自助迁移周期开始时间及周期内已迁移次数
+func (lic *License) TransferQuota() (time.Time, int64) {
+	var count int64
+	since := time.Now().AddDate(0, 0, -conf.LicenseConfig.TransferPeriod)
+	DB.Model(&LicenseTransfer{}).
+		Where("license_id = ? AND self_service = ? AND created_at >= ?", lic.ID, true, since).
+		Count(&count)
+	return since, count
+}
+
+// CheckSelfTransfer 校验客户端自助迁移：浮动授权不允许迁移，原容器不得仍持有租约，硬件指纹须匹配，且未超出迁移次数
+func (lic *License) CheckSelfTransfer(current *Fingerprint, instanceID string) error {
+	if conf.LicenseConfig.TransferLimit <= 0 {
+		return ErrTransferDisabled
+	}
+	if lic.Floating() {
+		return ErrTransferFloating
+	}
+	if lic.LeaseExpire != nil && lic.LeaseExpire.Add(leaseGrace()).After(time.Now()) {
+		return ErrTransferInUse
+	}
+	if len(lic.Fingerprint) > 0 {
+		if err := lic.checkFingerprint(current, instanceID); err != nil {
+			return err
+		}
+	}
+	if _, count := lic.TransferQuota(); count >= int64(conf.LicenseConfig.TransferLimit) {
+		return ErrTransferQuotaExceeded
+	}
+	return nil
+}
+
+// Transfer 将授权连同有效期、权益、绑定及历史迁移到新的容器ID，原容器ID加入吊销列表。
+// 目标容器仅存在同名的待审核授权时视为新容器自动申请的记录，迁移时删除
+func (lic *License) Transfer(to, reason string, actor *User, selfService bool) error {
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	from := lic.ContainerID
+	record := &LicenseTransfer{
+		LicenseID:     lic.ID,
+		FromContainer: from,
+		ToContainer:   to,
+		ActorName:     "self-service",
+		Reason:        reason,
+		SelfService:   selfService,
+	}
+	if actor != nil {
+		record.Creator = actor.ID
+		record.ActorName = actor.UserName
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var target License
+		if result := tx.Where("container_id = ?", to).Limit(1).Find(&target); result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected > 0 {
+			if target.ID == lic.ID || target.Status != StatusPending || target.Name != lic.Name {
+				return ErrTransferTargetExists
+			}
+			if err := tx.Unscoped().Delete(&target).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&License{}).Where("id = ? AND container_id = ?", lic.ID, from).Updates(map[string]interface{}{
+			"container_id":   to,
+			"lease_id":       "",
+			"lease_instance": "",
+			"lease_expire":   nil,
+			"revision":       gorm.Expr("revision + ?", 1),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTransferStale
+		}
+		if err := releaseSeats(tx, lic.ID); err != nil {
+			return err
+		}
+		for _, table := range licenseOwnedTables {
+			if err := tx.Model(table).Where("container_id = ?", from).Update("container_id", to).Error; err != nil {
+				return err
+			}
+		}
+		if err := createRevocation(tx, lic.ID, from, RevocationRevoke, lic.Status, "授权已迁移至 "+to); err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		if err != ErrTransferTargetExists && err != ErrTransferStale {
+			util.Log().Warning("无法迁移授权, %s", err)
+		}
+		return err
+	}
+
+	lic.ContainerID = to
+	lic.LeaseID, lic.LeaseInstance, lic.LeaseExpire = "", "", nil
+	lic.Revision++
+	return nil
+}
+
+// GetLicenseTransfers 分页查询授权迁移记录，containerId 为迁出或迁入的容器ID
+func GetLicenseTransfers(containerId string, page, size int) ([]LicenseTransfer, int64) {
+	var (
+		transfers []LicenseTransfer
+		total     int64
+	)
+	dbChain := DB.Where("license_id IN (?)",
+		DB.Model(&LicenseTransfer{}).Select("license_id").Where("from_container = ? OR to_container = ?", containerId, containerId))
+
+	// 计算总数用于分页
+	dbChain.Model(&LicenseTransfer{}).Count(&total)
+
+	// 查询记录
+	dbChain.Limit(size).Offset((page - 1) * size).Order("created_at desc").Find(&transfers)
+
+	return transfers, total
+}
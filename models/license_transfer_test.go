@@ -0,0 +1,118 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+)
+
+// countOwned 统计容器ID下的关联记录数量
+func countOwned(table interface{}, containerId string) int64 {
+	var count int64
+	DB.Model(table).Where("container_id = ?", containerId).Count(&count)
+	return count
+}
+
+func TestLicense_Transfer(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newTestLicense(t, "TestLicense_Transfer", StatusPending)
+	asserts.NoError(lic.AddBindings(rules(t, "transfer.example")))
+	asserts.NoError(lic.Renew(&LicenseTerm{Start: day(0), End: day(30), Plan: "test"}, nil))
+	asserts.NoError(lic.Transition(StatusActive, "测试", nil))
+	asserts.NoError(DB.Create(&LicenseExpiryEvent{LicenseID: lic.ID, ContainerID: lic.ContainerID, Expire: lic.Expire, Threshold: 7}).Error)
+	asserts.NoError(DB.Create(&FingerprintMismatch{LicenseID: lic.ID, ContainerID: lic.ContainerID, Matched: 2, Total: 3}).Error)
+	asserts.NoError(DB.Create(&LicenseFile{LicenseID: lic.ID, ContainerID: lic.ContainerID, Expire: lic.Expire, Version: 1}).Error)
+	seq := GetRevocationSeq()
+
+	// 原因不能为空
+	asserts.Equal(ErrReasonRequired, lic.Transfer("TestLicense_Transfer_to", "", nil, false))
+
+	// 目标容器已存在其他授权
+	other := newTestLicense(t, "TestLicense_Transfer_other", StatusActive)
+	asserts.Equal(ErrTransferTargetExists, lic.Transfer(other.ContainerID, "测试", nil, false))
+	asserts.Equal(seq, GetRevocationSeq())
+
+	// 授权已被并发迁移时不再迁移，也不吊销原容器ID
+	stale := *lic
+	stale.ContainerID = "TestLicense_Transfer_stale"
+	asserts.Equal(ErrTransferStale, stale.Transfer("TestLicense_Transfer_stale_to", "测试", nil, false))
+	asserts.Equal(seq, GetRevocationSeq())
+	_, err := GetLicense("TestLicense_Transfer_stale_to")
+	asserts.Error(err)
+
+	// 目标容器仅存在同名的待审核授权时删除该授权
+	pending := &License{Name: lic.Name, ContainerID: "TestLicense_Transfer_to", Status: StatusPending}
+	_, err = pending.Create()
+	asserts.NoError(err)
+
+	from, to := lic.ContainerID, pending.ContainerID
+	actor := &User{UserName: "transfer"}
+	actor.ID = 42
+	asserts.NoError(lic.Transfer(to, "更换服务器", actor, false))
+	asserts.Equal(to, lic.ContainerID)
+
+	moved, err := GetLicense(to)
+	asserts.NoError(err)
+	asserts.Equal(lic.ID, moved.ID)
+	asserts.Equal(lic.Revision, moved.Revision)
+	asserts.Equal(lic.Expire, moved.Expire)
+	_, err = GetLicense(from)
+	asserts.Error(err)
+
+	// 关联记录随授权迁移
+	for _, table := range licenseOwnedTables {
+		asserts.Zero(countOwned(table, from))
+		asserts.NotZero(countOwned(table, to))
+	}
+	asserts.True(moved.MatchAddr("transfer.example"))
+
+	// 原容器ID加入吊销列表
+	revocations := GetRevocationsSince(seq, 10)
+	if asserts.Len(revocations, 1) {
+		asserts.Equal(from, revocations[0].ContainerID)
+		asserts.Equal(RevocationRevoke, revocations[0].Action)
+		asserts.Equal(StatusActive, revocations[0].Status)
+	}
+
+	// 迁移记录
+	transfers, total := GetLicenseTransfers(from, 1, 10)
+	asserts.EqualValues(1, total)
+	asserts.Equal(actor.ID, transfers[0].Creator)
+	asserts.Equal("transfer", transfers[0].ActorName)
+	asserts.False(transfers[0].SelfService)
+}
+
+func TestLicense_CheckSelfTransfer(t *testing.T) {
+	asserts := assert.New(t)
+	limit, period := conf.LicenseConfig.TransferLimit, conf.LicenseConfig.TransferPeriod
+	defer func() {
+		conf.LicenseConfig.TransferLimit, conf.LicenseConfig.TransferPeriod = limit, period
+	}()
+	lic := newTestLicense(t, "TestLicense_CheckSelfTransfer", StatusActive)
+
+	// 未开启自助迁移
+	conf.LicenseConfig.TransferLimit, conf.LicenseConfig.TransferPeriod = 0, 30
+	asserts.Equal(ErrTransferDisabled, lic.CheckSelfTransfer(&Fingerprint{}, "instance"))
+
+	// 原容器仍持有租约
+	conf.LicenseConfig.TransferLimit = 1
+	lease := time.Now().Add(time.Minute)
+	lic.LeaseExpire = &lease
+	asserts.Equal(ErrTransferInUse, lic.CheckSelfTransfer(&Fingerprint{}, "instance"))
+	lic.LeaseExpire = nil
+
+	// 周期内迁移次数用完，管理员迁移不计入
+	asserts.NoError(lic.CheckSelfTransfer(&Fingerprint{}, "instance"))
+	asserts.NoError(lic.Transfer("TestLicense_CheckSelfTransfer_admin", "管理员迁移", nil, false))
+	asserts.NoError(lic.CheckSelfTransfer(&Fingerprint{}, "instance"))
+	asserts.NoError(lic.Transfer("TestLicense_CheckSelfTransfer_self", "自助迁移", nil, true))
+	_, count := lic.TransferQuota()
+	asserts.EqualValues(1, count)
+	asserts.Equal(ErrTransferQuotaExceeded, lic.CheckSelfTransfer(&Fingerprint{}, "instance"))
+
+	// 超出统计周期的迁移不计入
+	DB.Model(&LicenseTransfer{}).Where("license_id = ?", lic.ID).Update("created_at", time.Now().AddDate(0, 0, -31))
+	asserts.NoError(lic.CheckSelfTransfer(&Fingerprint{}, "instance"))
+}
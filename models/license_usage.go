@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const (
+	// UsagePolicyFlag 超出用量上限时仅在返回中标记
+	UsagePolicyFlag = "flag"
+	// UsagePolicyRefuse 超出用量上限时拒绝校验
+	UsagePolicyRefuse = "refuse"
+)
+
+const (
+	usageMemberDevice = "device"
+	usageMemberUser   = "user"
+)
+
+// ErrUsageCapExceeded 授权当月用量超出上限
+var ErrUsageCapExceeded = errors.New("授权本月用量已超出上限")
+
+// LicenseUsage 授权每日用量计数，Day 与 License.Expire 格式一致
+type LicenseUsage struct {
+	Auditable
+	LicenseID uint64 `json:"-" gorm:"uniqueIndex:idx_license_usage"`
+	Day       string `json:"day" gorm:"size:8;uniqueIndex:idx_license_usage"`
+	Verifies  int64  `json:"verifies"`
+	Devices   int64  `json:"devices"`
+	Users     int64  `json:"users"`
+	CheckIns  int64  `json:"check_ins"`
+}
+
+// LicenseUsageMember 授权每日出现过的设备及终端用户，用于多节点下的去重计数
+type LicenseUsageMember struct {
+	Auditable
+	LicenseID uint64 `gorm:"uniqueIndex:idx_license_usage_member"`
+	Day       string `gorm:"size:8;uniqueIndex:idx_license_usage_member"`
+	Kind      string `gorm:"size:16;uniqueIndex:idx_license_usage_member"`
+	Value     string `gorm:"size:191;uniqueIndex:idx_license_usage_member"`
+}
+
+// UsagePolicyOf 返回授权的超限策略，未设置时使用全局配置
+func (lic *License) UsagePolicyOf() string {
+	if lic.UsagePolicy != "" {
+		return lic.UsagePolicy
+	}
+	return conf.LicenseConfig.UsagePolicy
+}
+
+// SetUsageCap 设置授权每月用量上限及超限策略，limit 为 0 时不限制，policy 为空时使用全局配置
+func (lic *License) SetUsageCap(limit int64, policy string) error {
+	if err := DB.Model(&License{}).Where("id = ?", lic.ID).Updates(map[string]interface{}{
+		"usage_cap":    limit,
+		"usage_policy": policy,
+	}).Error; err != nil {
+		util.Log().Warning("无法设置授权用量上限, %s", err)
+		return err
+	}
+	lic.UsageCap = limit
+	lic.UsagePolicy = policy
+	return nil
+}
+
+// MonthlyUsage 统计授权当月的用量，校验与上报均计为一次
+func (lic *License) MonthlyUsage(now time.Time) int64 {
+	var used int64
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	DB.Model(&LicenseUsage{}).
+		Where("license_id = ? AND day >= ? AND day <= ?", lic.ID,
+			from.Format(util.FORMAT_DATE_y4Md), from.AddDate(0, 1, -1).Format(util.FORMAT_DATE_y4Md)).
+		Select("COALESCE(SUM(verifies + check_ins), 0)").Scan(&used)
+	return used
+}
+
+// UsageExceeded 判断当月用量是否已达到上限
+func (lic *License) UsageExceeded(now time.Time) bool {
+	return lic.UsageCap > 0 && lic.MonthlyUsage(now) >= lic.UsageCap
+}
+
+// RecordVerify 记录一次授权校验，device 为客户端实例标识
+func (lic *License) RecordVerify(device string) {
+	lic.recordUsage(time.Now(), "verifies", device, "")
+}
+
+// RecordCheckIn 记录一次服务上报，计入上报发生当日的用量
+func (lic *License) RecordCheckIn(at time.Time, device, user string) {
+	lic.recordUsage(at, "check_ins", device, user)
+}
+
+// recordUsage 累加当日计数，设备及终端用户首次出现时累加去重计数
+func (lic *License) recordUsage(now time.Time, column, device, user string) {
+	day := now.Format(util.FORMAT_DATE_y4Md)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&LicenseUsage{LicenseID: lic.ID, Day: day}).Error; err != nil {
+			return err
+		}
+		values := map[string]interface{}{column: gorm.Expr(column+" + ?", 1)}
+		if device != "" && addUsageMember(tx, lic.ID, day, usageMemberDevice, device) {
+			values["devices"] = gorm.Expr("devices + ?", 1)
+		}
+		if user != "" && addUsageMember(tx, lic.ID, day, usageMemberUser, user) {
+			values["users"] = gorm.Expr("users + ?", 1)
+		}
+		return tx.Model(&LicenseUsage{}).Where("license_id = ? AND day = ?", lic.ID, day).Updates(values).Error
+	})
+	if err != nil {
+		util.Log().Warning("无法记录授权用量, %s", err)
+	}
+}
+
+// addUsageMember 登记当日出现的设备或终端用户，返回是否首次出现
+func addUsageMember(tx *gorm.DB, licenseID uint64, day, kind, value string) bool {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&LicenseUsageMember{
+		LicenseID: licenseID,
+		Day:       day,
+		Kind:      kind,
+		Value:     value,
+	})
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// GetLicenseUsages 查询授权在日期区间内的每日用量，日期格式与 License.Expire 一致
+func GetLicenseUsages(licenseID uint64, from, to string) []LicenseUsage {
+	var usages []LicenseUsage
+	DB.Where("license_id = ? AND day >= ? AND day <= ?", licenseID, from, to).Order("day").Find(&usages)
+	return usages
+}
+
+// PruneUsageMembers 删除超出保留期的每日设备及终端用户明细，每日用量计数不受影响，返回删除数量
+func PruneUsageMembers(now time.Time) (int64, error) {
+	days := conf.LicenseConfig.UsageMemberRetention
+	if days <= 0 {
+		return 0, nil
+	}
+	cutoff := now.AddDate(0, 0, -days).Format(util.FORMAT_DATE_y4Md)
+	result := DB.Unscoped().Where("day < ?", cutoff).Delete(&LicenseUsageMember{})
+	return result.RowsAffected, result.Error
+}
+
+// CountUsageMembers 统计日期区间内去重后的设备数及终端用户数
+func CountUsageMembers(licenseID uint64, from, to string) (devices, users int64) {
+	count := func(kind string) int64 {
+		var total int64
+		DB.Model(&LicenseUsageMember{}).
+			Where("license_id = ? AND kind = ? AND day >= ? AND day <= ?", licenseID, kind, from, to).
+			Distinct("value").Count(&total)
+		return total
+	}
+	return count(usageMemberDevice), count(usageMemberUser)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/util"
+)
+
+func TestFindLicenseByAddr(t *testing.T) {
+	asserts := assert.New(t)
+	lic := newTestLicense(t, "TestFindLicenseByAddr", StatusActive)
+	asserts.NoError(lic.AddBindings(rules(t, "*.byaddr.example")))
+
+	found, err := FindLicenseByAddr("https://svc.byaddr.example:8443/app")
+	asserts.NoError(err)
+	asserts.Equal(lic.ID, found.ID)
+	_, err = FindLicenseByAddr("svc.other.example")
+	asserts.Error(err)
+	_, err = FindLicenseByAddr("")
+	asserts.Error(err)
+
+	// 命中缓存时不再查询绑定
+	DB.Unscoped().Where("license_id = ?", lic.ID).Delete(&LicenseBinding{})
+	found, err = FindLicenseByAddr("svc.byaddr.example")
+	asserts.NoError(err)
+	asserts.Equal(lic.ID, found.ID)
+
+	// 绑定变更后缓存失效
+	asserts.NoError(lic.SetBindings(rules(t, "10.99.0.0/16")))
+	_, err = FindLicenseByAddr("svc.byaddr.example")
+	asserts.Error(err)
+	found, err = FindLicenseByAddr("10.99.1.2:80")
+	asserts.NoError(err)
+	asserts.Equal(lic.ID, found.ID)
+
+	// 未命中的结果同样缓存，新增绑定后失效
+	other := newTestLicense(t, "TestFindLicenseByAddr_other", StatusActive)
+	_, err = FindLicenseByAddr("svc.byaddr2.example")
+	asserts.Error(err)
+	asserts.NoError(other.AddBindings(rules(t, "svc.byaddr2.example")))
+	found, err = FindLicenseByAddr("svc.byaddr2.example")
+	asserts.NoError(err)
+	asserts.Equal(other.ID, found.ID)
+}
+
+func TestPruneUsageMembers(t *testing.T) {
+	asserts := assert.New(t)
+	retention := conf.LicenseConfig.UsageMemberRetention
+	defer func() { conf.LicenseConfig.UsageMemberRetention = retention }()
+	lic := newTestLicense(t, "TestPruneUsageMembers", StatusActive)
+	now := time.Now()
+	lic.RecordCheckIn(now.AddDate(0, 0, -31), "device", "user")
+	lic.RecordCheckIn(now.AddDate(0, 0, -30), "device", "user")
+	lic.RecordCheckIn(now, "device", "user")
+	count := func() int64 {
+		var total int64
+		DB.Model(&LicenseUsageMember{}).Where("license_id = ?", lic.ID).Count(&total)
+		return total
+	}
+	asserts.EqualValues(6, count())
+
+	// 保留期为 0 时不清理
+	conf.LicenseConfig.UsageMemberRetention = 0
+	_, err := PruneUsageMembers(now)
+	asserts.NoError(err)
+	asserts.EqualValues(6, count())
+
+	conf.LicenseConfig.UsageMemberRetention = 30
+	_, err = PruneUsageMembers(now)
+	asserts.NoError(err)
+	asserts.EqualValues(4, count())
+
+	// 每日用量计数保留
+	usages := GetLicenseUsages(lic.ID, now.AddDate(0, 0, -31).Format(util.FORMAT_DATE_y4Md), now.Format(util.FORMAT_DATE_y4Md))
+	asserts.Len(usages, 3)
+	asserts.EqualValues(1, usages[0].Devices)
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhouqiaokeji/server/pkg/cache"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/id"
+)
+
+// 测试使用内存数据库及内存缓存
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	id.Init()
+	conf.SystemConfig.Debug = true
+	cache.Store = cache.NewMemoStore()
+	Init()
+	os.Exit(m.Run())
+}
+
+// newTestLicense 创建指定状态的授权，containerId 为测试内唯一的容器ID
+func newTestLicense(t *testing.T, containerId string, status Status) *License {
+	lic := &License{Name: containerId, ContainerID: containerId, Status: status}
+	if _, err := lic.Create(); err != nil {
+		t.Fatal(err)
+	}
+	return lic
+}
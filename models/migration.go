@@ -35,7 +35,22 @@ func migration() {
 	//	DB = DB.Set("gorm:table_options", "ENGINE=InnoDB")
 	//}
 
-	_ = DB.AutoMigrate(&User{}, &Setting{}, &License{}, &Holidays{}, &AppUseInfo{})
+	// SQL Server 随机数唯一索引改为筛选索引，须先于自动迁移执行
+	migrateUseInfoNonceIndex()
+
+	_ = DB.AutoMigrate(&User{}, &Setting{}, &License{}, &Holidays{}, &AppUseInfo{}, &LicenseFile{}, &FingerprintMismatch{}, &LicenseHistory{}, &LicenseExpiryEvent{}, &LicenseRevocation{}, &LicenseTerm{}, &LicenseBinding{}, &LicenseTransfer{}, &Customer{}, &LicenseSeat{}, &LicenseUsage{}, &LicenseUsageMember{}, &ActivationCode{}, &ActivationRedemption{}, &AppUseInfoRollup{}, &AppUseInfoExport{}, &AppServerAddr{})
+
+	// 迁移旧版授权绑定信息
+	migrateLicenseBindings()
+
+	// 登记已上报的服务地址
+	migrateServerAddrs()
+
+	// 补齐服务使用记录的上报日期
+	migrateUseInfoDays()
+
+	// 按授权名称补齐客户信息
+	migrateLicenseCustomers()
 
 	// 创建初始管理员账户
 	initAdminUser()
@@ -0,0 +1,88 @@
+package actcode
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+)
+
+// alphabet Crockford Base32 字符集，不含易混淆的 I、L、O、U
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	// Length 激活码字符数，不含分隔符，最后一位为校验位
+	Length = 20
+	// GroupSize 每组字符数
+	GroupSize = 5
+	// poly GF(32) 的本原多项式 x^5 + x^2 + 1
+	poly = 0x25
+)
+
+// ErrInvalid 激活码格式或校验位错误
+var ErrInvalid = errors.New("激活码格式错误")
+
+// Generate 生成一个激活码，返回分组格式，如 ABCDE-FGHJK-MNPQR-STVW5
+func Generate() (string, error) {
+	buf := make([]byte, Length-1)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := make([]byte, Length-1, Length)
+	for i, b := range buf {
+		code[i] = alphabet[b&31]
+	}
+	code = append(code, alphabet[checksum(string(code))])
+	return Format(string(code)), nil
+}
+
+// Normalize 规范化用户输入的激活码并校验，返回不含分隔符的大写激活码；
+// 忽略空白及分隔符，并将易混淆的 I、L 视为 1，O 视为 0
+func Normalize(value string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(value) {
+		switch r {
+		case '-', ' ', '\t':
+			continue
+		case 'I', 'L':
+			r = '1'
+		case 'O':
+			r = '0'
+		}
+		if !strings.ContainsRune(alphabet, r) {
+			return "", ErrInvalid
+		}
+		b.WriteRune(r)
+	}
+	code := b.String()
+	if len(code) != Length || alphabet[checksum(code[:Length-1])] != code[Length-1] {
+		return "", ErrInvalid
+	}
+	return code, nil
+}
+
+// Format 将规范化的激活码按组以 - 分隔
+func Format(code string) string {
+	groups := make([]string, 0, (len(code)+GroupSize-1)/GroupSize)
+	for i := 0; i < len(code); i += GroupSize {
+		end := i + GroupSize
+		if end > len(code) {
+			end = len(code)
+		}
+		groups = append(groups, code[i:end])
+	}
+	return strings.Join(groups, "-")
+}
+
+// checksum 在 GF(32) 上计算校验值，每个字符按位置乘以本原元的不同次幂后求和，
+// 任意单个字符错误及相邻字符交换均会改变校验值
+func checksum(data string) int {
+	sum := 0
+	for i := 0; i < len(data); i++ {
+		sum <<= 1
+		if sum&32 != 0 {
+			sum ^= poly
+		}
+		sum ^= strings.IndexByte(alphabet, data[i])
+	}
+	return sum
+}
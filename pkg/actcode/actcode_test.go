@@ -0,0 +1,81 @@
+package actcode
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	asserts := assert.New(t)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := Generate()
+		asserts.NoError(err)
+		asserts.Len(code, Length+Length/GroupSize-1)
+		asserts.Len(strings.Split(code, "-"), Length/GroupSize)
+		asserts.False(seen[code])
+		seen[code] = true
+
+		normalized, err := Normalize(code)
+		asserts.NoError(err)
+		asserts.Equal(code, Format(normalized))
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	asserts := assert.New(t)
+
+	code, err := Generate()
+	asserts.NoError(err)
+	expected := strings.ReplaceAll(code, "-", "")
+
+	// 忽略大小写、空白及分隔符
+	normalized, err := Normalize(" " + strings.ToLower(strings.ReplaceAll(code, "-", " ")) + " ")
+	asserts.NoError(err)
+	asserts.Equal(expected, normalized)
+
+	// 易混淆字符
+	asserts.Equal(normalized, mustNormalize(t, strings.NewReplacer("1", "I", "0", "O").Replace(code)))
+
+	for _, value := range []string{"", "ABCDE", code + "A", strings.Replace(code, "-", "U", 1)} {
+		_, err = Normalize(value)
+		asserts.Equal(ErrInvalid, err, value)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	asserts := assert.New(t)
+
+	code, err := Generate()
+	asserts.NoError(err)
+	normalized := mustNormalize(t, code)
+
+	// 任意单个字符错误均可被发现
+	for i := 0; i < Length; i++ {
+		for _, r := range alphabet {
+			if byte(r) == normalized[i] {
+				continue
+			}
+			_, err = Normalize(normalized[:i] + string(r) + normalized[i+1:])
+			asserts.Equal(ErrInvalid, err)
+		}
+	}
+
+	// 相邻字符交换可被发现
+	for i := 0; i < Length-2; i++ {
+		if normalized[i] == normalized[i+1] {
+			continue
+		}
+		swapped := normalized[:i] + string(normalized[i+1]) + string(normalized[i]) + normalized[i+2:]
+		_, err = Normalize(swapped)
+		asserts.Equal(ErrInvalid, err)
+	}
+}
+
+func mustNormalize(t *testing.T, value string) string {
+	code, err := Normalize(value)
+	assert.NoError(t, err)
+	return code
+}
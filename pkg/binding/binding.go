@@ -0,0 +1,165 @@
+package binding
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	// KindCIDR IP 或 IP 段，单个 IP 按 /32 或 /128 处理
+	KindCIDR = "cidr"
+	// KindDomain 域名
+	KindDomain = "domain"
+	// KindWildcard 通配域名，如 *.corp.example，匹配其任意层级子域名，不含自身
+	KindWildcard = "wildcard"
+)
+
+// ErrInvalidRule 绑定规则格式不正确
+var ErrInvalidRule = errors.New("绑定规则格式不正确")
+
+// Rule 授权绑定规则
+type Rule struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+	ipNet *net.IPNet
+}
+
+// Parse 解析绑定规则，支持 IP、CIDR、域名及 *. 开头的通配域名，返回规范化后的规则
+func Parse(value string) (Rule, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return Rule{}, ErrInvalidRule
+	}
+	if strings.Contains(value, "/") {
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return Rule{}, ErrInvalidRule
+		}
+		return Rule{Kind: KindCIDR, Value: ipNet.String(), ipNet: ipNet}, nil
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		ipNet := singleHost(ip)
+		return Rule{Kind: KindCIDR, Value: ipNet.String(), ipNet: ipNet}, nil
+	}
+	value = strings.TrimSuffix(value, ".")
+	if strings.HasPrefix(value, "*.") {
+		if !validDomain(value[2:]) {
+			return Rule{}, ErrInvalidRule
+		}
+		return Rule{Kind: KindWildcard, Value: value}, nil
+	}
+	if !validDomain(value) {
+		return Rule{}, ErrInvalidRule
+	}
+	return Rule{Kind: KindDomain, Value: value}, nil
+}
+
+// ParseAll 解析多条绑定规则，并去除重复规则
+func ParseAll(values []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		rule, err := Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[rule.Value] {
+			seen[rule.Value] = true
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// Match 判断服务地址是否命中规则，地址可以是 IP、域名、host:port 或 URL
+func (r Rule) Match(addr string) bool {
+	host := Host(addr)
+	if host == "" {
+		return false
+	}
+	switch r.Kind {
+	case KindCIDR:
+		ip := net.ParseIP(host)
+		return ip != nil && r.network().Contains(ip)
+	case KindDomain:
+		return host == r.Value
+	case KindWildcard:
+		return strings.HasSuffix(host, r.Value[1:])
+	}
+	return false
+}
+
+// Overlaps 判断两条规则覆盖的地址是否存在交集
+func (r Rule) Overlaps(other Rule) bool {
+	switch {
+	case r.Kind == KindCIDR && other.Kind == KindCIDR:
+		a, b := r.network(), other.network()
+		return a.Contains(b.IP) || b.Contains(a.IP)
+	case r.Kind == KindCIDR || other.Kind == KindCIDR:
+		return false
+	case r.Kind == KindDomain && other.Kind == KindDomain:
+		return r.Value == other.Value
+	case r.Kind == KindWildcard && other.Kind == KindDomain:
+		return r.Match(other.Value)
+	case r.Kind == KindDomain && other.Kind == KindWildcard:
+		return other.Match(r.Value)
+	}
+	// 两个通配域名中一个是另一个的子域时存在交集
+	return strings.HasSuffix(r.Value[1:], other.Value[1:]) || strings.HasSuffix(other.Value[1:], r.Value[1:])
+}
+
+// Host 从服务地址中提取小写主机名或 IP
+func Host(addr string) string {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	if strings.Contains(addr, "://") {
+		if u, err := url.Parse(addr); err == nil {
+			return strings.TrimSuffix(u.Hostname(), ".")
+		}
+		return ""
+	}
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		addr = addr[:i]
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.Trim(addr, "[]"), ".")
+	return addr
+}
+
+// network 返回规则对应的网段，从数据库读取的规则未经 Parse 时按 Value 解析
+func (r Rule) network() *net.IPNet {
+	if r.ipNet != nil {
+		return r.ipNet
+	}
+	if _, ipNet, err := net.ParseCIDR(r.Value); err == nil {
+		return ipNet
+	}
+	return &net.IPNet{}
+}
+
+func singleHost(ip net.IP) *net.IPNet {
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func validDomain(domain string) bool {
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
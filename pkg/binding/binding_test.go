@@ -0,0 +1,97 @@
+package binding
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	asserts := assert.New(t)
+
+	rule, err := Parse("10.0.0.1")
+	asserts.NoError(err)
+	asserts.Equal(Rule{Kind: KindCIDR, Value: "10.0.0.1/32"}.Value, rule.Value)
+
+	rule, err = Parse("10.0.0.9/24")
+	asserts.NoError(err)
+	asserts.Equal(KindCIDR, rule.Kind)
+	asserts.Equal("10.0.0.0/24", rule.Value)
+
+	rule, err = Parse("*.Corp.Example.")
+	asserts.NoError(err)
+	asserts.Equal(KindWildcard, rule.Kind)
+	asserts.Equal("*.corp.example", rule.Value)
+
+	rule, err = Parse("app.corp.example")
+	asserts.NoError(err)
+	asserts.Equal(KindDomain, rule.Kind)
+
+	for _, value := range []string{"", "10.0.0.1/33", "*.", "a..b", "-a.com", "a b"} {
+		_, err = Parse(value)
+		asserts.Equal(ErrInvalidRule, err, value)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	asserts := assert.New(t)
+
+	rules, err := ParseAll([]string{"10.0.0.1", "10.0.0.1/32", "a.com"})
+	asserts.NoError(err)
+	asserts.Len(rules, 2)
+
+	_, err = ParseAll([]string{"a.com", "a..com"})
+	asserts.Error(err)
+}
+
+func TestRule_Match(t *testing.T) {
+	asserts := assert.New(t)
+
+	cidr, _ := Parse("192.168.1.0/24")
+	asserts.True(cidr.Match("192.168.1.20"))
+	asserts.True(cidr.Match("192.168.1.20:8080"))
+	asserts.True(cidr.Match("http://192.168.1.20:8080/api"))
+	asserts.False(cidr.Match("192.168.2.1"))
+	asserts.False(cidr.Match("a.com"))
+
+	v6, _ := Parse("2001:db8::/32")
+	asserts.True(v6.Match("[2001:db8::1]:443"))
+
+	wildcard, _ := Parse("*.corp.example")
+	asserts.True(wildcard.Match("https://a.corp.example"))
+	asserts.True(wildcard.Match("a.b.corp.example:80"))
+	asserts.False(wildcard.Match("corp.example"))
+	asserts.False(wildcard.Match("acorp.example"))
+
+	domain, _ := Parse("corp.example")
+	asserts.True(domain.Match("CORP.example:443"))
+	asserts.False(domain.Match("a.corp.example"))
+}
+
+func TestRule_Overlaps(t *testing.T) {
+	asserts := assert.New(t)
+	overlaps := func(a, b string) bool {
+		ra, _ := Parse(a)
+		rb, _ := Parse(b)
+		return ra.Overlaps(rb) && rb.Overlaps(ra)
+	}
+
+	asserts.True(overlaps("10.0.0.0/8", "10.1.0.0/16"))
+	asserts.True(overlaps("10.0.0.0/24", "10.0.0.5"))
+	asserts.False(overlaps("10.0.0.0/24", "10.0.1.0/24"))
+	asserts.False(overlaps("10.0.0.0/24", "a.com"))
+	asserts.True(overlaps("a.com", "A.com"))
+	asserts.False(overlaps("a.com", "b.com"))
+	asserts.True(overlaps("*.corp.example", "x.corp.example"))
+	asserts.False(overlaps("*.corp.example", "corp.example"))
+	asserts.True(overlaps("*.corp.example", "*.a.corp.example"))
+	asserts.False(overlaps("*.corp.example", "*.other.example"))
+}
+
+func TestHost(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal("a.com", Host("HTTP://A.com:80/x"))
+	asserts.Equal("a.com", Host("a.com:80"))
+	asserts.Equal("a.com", Host("a.com/path"))
+	asserts.Equal("::1", Host("[::1]:80"))
+	asserts.Equal("10.0.0.1", Host("10.0.0.1"))
+}
@@ -29,6 +29,9 @@ type Driver interface {
 	// Get 取值，并返回是否成功
 	Get(key string) (interface{}, bool)
 
+	// SetNX 仅在键不存在时设置值，返回是否设置成功，ttl为过期时间，单位为秒
+	SetNX(key string, value interface{}, ttl int) (bool, error)
+
 	// Gets 批量取值，返回成功取值的map即不存在的值
 	Gets(keys []string, prefix string) (map[string]interface{}, []string)
 
@@ -49,6 +52,11 @@ func Get(key string) (interface{}, bool) {
 	return Store.Get(key)
 }
 
+// SetNX 仅在键不存在时设置缓存值
+func SetNX(key string, value interface{}, ttl int) (bool, error) {
+	return Store.SetNX(key, value, ttl)
+}
+
 // Deletes 删除值
 func Deletes(keys []string, prefix string) error {
 	return Store.Delete(keys, prefix)
@@ -9,6 +9,7 @@ import (
 // MemoStore 内存存储驱动
 type MemoStore struct {
 	Store *sync.Map
+	mu    sync.Mutex
 }
 
 // item 存储的对象
@@ -78,6 +79,17 @@ func (store *MemoStore) Get(key string) (interface{}, bool) {
 	return getValue(store.Store.Load(key))
 }
 
+// SetNX 仅在键不存在或已过期时存储值
+func (store *MemoStore) SetNX(key string, value interface{}, ttl int) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := getValue(store.Store.Load(key)); ok {
+		return false, nil
+	}
+	store.Store.Store(key, newItem(value, ttl))
+	return true, nil
+}
+
 // Gets 批量取值
 func (store *MemoStore) Gets(keys []string, prefix string) (map[string]interface{}, []string) {
 	var res = make(map[string]interface{})
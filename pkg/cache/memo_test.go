@@ -145,3 +145,26 @@ func TestMemoStore_GarbageCollect(t *testing.T) {
 	_, ok := store.Get("test")
 	asserts.False(ok)
 }
+
+func TestMemoStore_SetNX(t *testing.T) {
+	asserts := assert.New(t)
+	store := NewMemoStore()
+
+	// 键不存在
+	ok, err := store.SetNX("nx", "val", 1)
+	asserts.NoError(err)
+	asserts.True(ok)
+
+	// 键已存在
+	ok, err = store.SetNX("nx", "other", 1)
+	asserts.NoError(err)
+	asserts.False(ok)
+	val, _ := store.Get("nx")
+	asserts.Equal("val", val)
+
+	// 键已过期
+	time.Sleep(2 * time.Second)
+	ok, err = store.SetNX("nx", "other", 1)
+	asserts.NoError(err)
+	asserts.True(ok)
+}
@@ -124,6 +124,34 @@ func (store *RedisStore) Get(key string) (interface{}, bool) {
 
 }
 
+// SetNX Save Store Value If Key Not Exist
+func (store *RedisStore) SetNX(key string, value interface{}, ttl int) (bool, error) {
+	rc := store.pool.Get()
+	defer rc.Close()
+
+	serialized, err := serializer(value)
+	if err != nil {
+		return false, err
+	}
+
+	if rc.Err() != nil {
+		return false, rc.Err()
+	}
+
+	args := redis.Args{}.Add(key, serialized)
+	if ttl > 0 {
+		args = args.Add("EX", ttl)
+	}
+	_, err = redis.String(rc.Do("SET", append(args, "NX")...))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Gets Batch Get Value
 func (store *RedisStore) Gets(keys []string, prefix string) (map[string]interface{}, []string) {
 	rc := store.pool.Get()
@@ -322,3 +322,47 @@ func TestRedisStore_Delete(t *testing.T) {
 		asserts.Error(err)
 	}
 }
+
+func TestRedisStore_SetNX(t *testing.T) {
+	asserts := assert.New(t)
+	conn := redigomock.NewConn()
+	pool := &redis.Pool{
+		Dial:    func() (redis.Conn, error) { return conn, nil },
+		MaxIdle: 10,
+	}
+	store := &RedisStore{pool: pool}
+
+	// 设置成功
+	{
+		cmd := conn.Command("SET", "test", redigomock.NewAnyData(), "EX", 10, "NX").Expect("OK")
+		ok, err := store.SetNX("test", "test val", 10)
+		asserts.NoError(err)
+		asserts.True(ok)
+		if conn.Stats(cmd) != 1 {
+			fmt.Println("Command was not used")
+			return
+		}
+	}
+
+	// 键已存在
+	{
+		conn.Clear()
+		cmd := conn.Command("SET", "test", redigomock.NewAnyData(), "EX", 10, "NX").Expect(nil)
+		ok, err := store.SetNX("test", "test val", 10)
+		asserts.NoError(err)
+		asserts.False(ok)
+		if conn.Stats(cmd) != 1 {
+			fmt.Println("Command was not used")
+			return
+		}
+	}
+
+	// 命令执行失败
+	{
+		conn.Clear()
+		conn.Command("SET", "test", redigomock.NewAnyData(), "NX").ExpectError(errors.New("error"))
+		ok, err := store.SetNX("test", "test val", -1)
+		asserts.Error(err)
+		asserts.False(ok)
+	}
+}
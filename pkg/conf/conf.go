@@ -85,6 +85,31 @@ type cors struct {
 	ExposeHeaders    []string
 }
 
+// license 授权配置
+type license struct {
+	LeaseTTL             int `validate:"gte=1"`
+	LeaseGrace           int `validate:"gte=0"`
+	FingerprintThreshold int `validate:"gte=1"`
+	ReplayWindow         int `validate:"gte=0"`
+	ReplayLegacy         bool
+	ExpirySweepInterval  int `validate:"gte=0"`
+	ExpiryWarnDays       []int
+	TransferLimit        int    `validate:"gte=0"`
+	TransferPeriod       int    `validate:"gte=1"`
+	UsagePolicy          string `validate:"oneof=flag refuse"`
+	CheckInBatchSize     int    `validate:"gte=1"`
+	UseInfoRetention     int    `validate:"gte=0"`
+	RollupInterval       int    `validate:"gte=0"`
+	UsageMemberRetention int    `validate:"gte=0"`
+}
+
+// keyRing 签名密钥环配置
+type keyRing struct {
+	Dir     string `validate:"required"`
+	Signing string
+	Retired []string
+}
+
 var cfg *ini.File
 
 const defaultConf = `[System]
@@ -135,6 +160,8 @@ func Init(path string) {
 		"Thumbnail":  ThumbConfig,
 		"CORS":       CORSConfig,
 		"Slave":      SlaveConfig,
+		"License":    LicenseConfig,
+		"KeyRing":    KeyRingConfig,
 	}
 	for sectionName, sectionStruct := range sections {
 		err = mapSection(sectionName, sectionStruct)
@@ -84,3 +84,28 @@ var SSLConfig = &ssl{
 var UnixConfig = &unix{
 	Listen: "",
 }
+
+// LicenseConfig License Config
+var LicenseConfig = &license{
+	LeaseTTL:             300,
+	LeaseGrace:           60,
+	FingerprintThreshold: 3,
+	ReplayWindow:         300,
+	ReplayLegacy:         true,
+	ExpirySweepInterval:  3600,
+	ExpiryWarnDays:       []int{30, 7, 1},
+	TransferLimit:        3,
+	TransferPeriod:       30,
+	UsagePolicy:          "flag",
+	CheckInBatchSize:     500,
+	UseInfoRetention:     0,
+	RollupInterval:       86400,
+	UsageMemberRetention: 400,
+}
+
+// KeyRingConfig Signing Key Ring Config
+var KeyRingConfig = &keyRing{
+	Dir:     "keys",
+	Signing: "",
+	Retired: nil,
+}
@@ -3,4 +3,4 @@ package conf
 // BackendVersion Current Serve Version
 var BackendVersion = "1.0.0"
 // RequiredDBVersion 与当前版本匹配的数据库版本
-var RequiredDBVersion = "1.0.0"
+var RequiredDBVersion = "1.0.21"
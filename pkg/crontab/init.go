@@ -0,0 +1,97 @@
+package crontab
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/cache"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// expirySweepLock 授权到期巡检锁
+	expirySweepLock = "crontab_lock:license_expiry"
+	// useInfoRollupLock 服务使用记录汇总锁
+	useInfoRollupLock = "crontab_lock:use_info_rollup"
+)
+
+// Init 启动定时任务
+func Init() {
+	schedule("授权到期巡检", expirySweepLock, conf.LicenseConfig.ExpirySweepInterval, sweepLicenseExpiry)
+	schedule("服务使用记录汇总", useInfoRollupLock, conf.LicenseConfig.RollupInterval, rollupUseInfos)
+}
+
+// schedule 按间隔（秒）周期执行任务，间隔为 0 时不启动
+func schedule(name, lock string, interval int, job func()) {
+	if interval <= 0 {
+		util.Log().Info("%s已关闭", name)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			runExclusive(lock, lockTTL(interval), job)
+			<-ticker.C
+		}
+	}()
+}
+
+// sweepLicenseExpiry 应用到期生效的续期，标记已过期授权并生成到期预警
+func sweepLicenseExpiry() {
+	renewed := model.ApplyDueTerms()
+	expired := model.ExpireLicenses()
+	warned := model.WarnExpiringLicenses(conf.LicenseConfig.ExpiryWarnDays)
+	util.Log().Info("授权到期巡检完成，续期生效 %d 个，过期 %d 个，新增预警 %d 条", renewed, expired, warned)
+}
+
+// rollupUseInfos 将超出保留期的服务使用记录按日汇总后删除，并清理过期的授权用量明细
+func rollupUseInfos() {
+	now := time.Now()
+	deleted, err := model.RollupAppUseInfos(now)
+	if err != nil {
+		util.Log().Warning("服务使用记录汇总中断，已汇总 %d 条, %s", deleted, err)
+		return
+	}
+	pruned, err := model.PruneUsageMembers(now)
+	if err != nil {
+		util.Log().Warning("无法清理授权用量明细, %s", err)
+	}
+	util.Log().Info("服务使用记录汇总完成，汇总并删除 %d 条，清理用量明细 %d 条", deleted, pruned)
+}
+
+// runExclusive 获取缓存锁后执行任务，锁在 ttl 秒后自动释放，
+// 多个主节点共享同一缓存时，同一周期内只有一个节点执行任务
+func runExclusive(key string, ttl int, job func()) bool {
+	ok, err := cache.SetNX(key, instanceName(), ttl)
+	if err != nil {
+		util.Log().Warning("无法获取定时任务锁 %s, %s", key, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	job()
+	return true
+}
+
+// lockTTL 任务锁的有效期（秒），略短于执行间隔，
+// 持锁节点在下一周期到来时锁已过期，可再次获取锁执行任务
+func lockTTL(interval int) int {
+	margin := interval / 10
+	if margin < 1 {
+		margin = 1
+	}
+	if interval-margin < 1 {
+		return 1
+	}
+	return interval - margin
+}
+
+// instanceName 当前节点标识
+func instanceName() string {
+	host, _ := os.Hostname()
+	return host + ":" + strconv.Itoa(os.Getpid())
+}
@@ -0,0 +1,55 @@
+package crontab
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/cache"
+	"testing"
+	"time"
+)
+
+func TestRunExclusive(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Store = cache.NewMemoStore()
+
+	count := 0
+	job := func() { count++ }
+
+	// 首次获取锁，执行任务
+	asserts.True(runExclusive("TestRunExclusive", 60, job))
+	asserts.Equal(1, count)
+
+	// 锁未释放，跳过任务
+	asserts.False(runExclusive("TestRunExclusive", 60, job))
+	asserts.Equal(1, count)
+
+	// 不同任务互不影响
+	asserts.True(runExclusive("TestRunExclusive2", 60, job))
+	asserts.Equal(2, count)
+}
+
+func TestLockTTL(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal(1, lockTTL(1))
+	asserts.Equal(1, lockTTL(2))
+	asserts.Equal(9, lockTTL(10))
+	asserts.Equal(77760, lockTTL(86400))
+}
+
+// TestRunExclusiveConsecutiveTicks 同一节点在相邻两个周期均能执行任务
+func TestRunExclusiveConsecutiveTicks(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Store = cache.NewMemoStore()
+
+	count := 0
+	job := func() { count++ }
+	interval := 2
+
+	// 第一个周期执行，周期内其他节点获取锁失败
+	asserts.True(runExclusive("TestRunExclusiveConsecutiveTicks", lockTTL(interval), job))
+	asserts.False(runExclusive("TestRunExclusiveConsecutiveTicks", lockTTL(interval), job))
+
+	// 下一个周期再次执行
+	time.Sleep(time.Duration(interval) * time.Second)
+	asserts.True(runExclusive("TestRunExclusiveConsecutiveTicks", lockTTL(interval), job))
+	asserts.Equal(2, count)
+}
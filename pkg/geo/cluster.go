@@ -0,0 +1,65 @@
+package geo
+
+import "sort"
+
+// Cluster 网格内坐标的聚合结果，Center 为网格内坐标的质心
+type Cluster struct {
+	Cell    Cell  `json:"cell"`
+	Center  Point `json:"center"`
+	Bounds  Box   `json:"bounds"`
+	Count   int64 `json:"count"`
+	Devices int64 `json:"devices"`
+
+	sumLon  float64
+	sumLat  float64
+	devices map[string]struct{}
+}
+
+// Grid 按缩放级别将坐标聚合到网格，用于地图展示
+type Grid struct {
+	zoom     int
+	clusters map[Cell]*Cluster
+}
+
+// NewGrid 新建指定缩放级别的网格
+func NewGrid(zoom int) *Grid {
+	return &Grid{zoom: clampZoom(zoom), clusters: make(map[Cell]*Cluster)}
+}
+
+// Add 将坐标计入所在网格，device 非空时按设备去重计数
+func (g *Grid) Add(p Point, device string) {
+	cell := CellOf(p, g.zoom)
+	cluster, ok := g.clusters[cell]
+	if !ok {
+		cluster = &Cluster{Cell: cell, Bounds: cell.Bounds(g.zoom), devices: make(map[string]struct{})}
+		g.clusters[cell] = cluster
+	}
+	cluster.Count++
+	cluster.sumLon += p.Lon
+	cluster.sumLat += p.Lat
+	if device != "" {
+		cluster.devices[device] = struct{}{}
+	}
+}
+
+// Clusters 返回按坐标数量降序排列的聚合结果
+func (g *Grid) Clusters() []Cluster {
+	res := make([]Cluster, 0, len(g.clusters))
+	for _, cluster := range g.clusters {
+		c := *cluster
+		c.Center = Point{Lon: c.sumLon / float64(c.Count), Lat: c.sumLat / float64(c.Count)}
+		c.Devices = int64(len(c.devices))
+		c.devices = nil
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		if res[i].Cell.Y != res[j].Cell.Y {
+			return res[i].Cell.Y < res[j].Cell.Y
+		}
+		return res[i].Cell.X < res[j].Cell.X
+	})
+	return res
+}
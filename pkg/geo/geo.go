@@ -0,0 +1,176 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EarthRadius 地球平均半径（米）
+	EarthRadius = 6371008.8
+	// MaxZoom 支持的最大地图缩放级别
+	MaxZoom = 22
+	// cellsPerTile 每个 256 像素地图瓦片在每个方向上划分的网格数
+	cellsPerTile = 4
+	// maxMercatorLat Web 墨卡托投影可表示的最大纬度
+	maxMercatorLat = 85.05112878
+)
+
+// ErrInvalidBox 经纬度范围格式错误
+var ErrInvalidBox = errors.New("经纬度范围格式错误，应为 minLon,minLat,maxLon,maxLat")
+
+// Point 经纬度坐标（度）
+type Point struct {
+	Lon float64 `json:"lon"`
+	Lat float64 `json:"lat"`
+}
+
+// Box 经纬度矩形范围，MinLon 大于 MaxLon 时表示跨越 180 度经线
+type Box struct {
+	MinLon float64 `json:"min_lon"`
+	MinLat float64 `json:"min_lat"`
+	MaxLon float64 `json:"max_lon"`
+	MaxLat float64 `json:"max_lat"`
+}
+
+// Valid 判断坐标是否在合法范围内
+func (p Point) Valid() bool {
+	return p.Lon >= -180 && p.Lon <= 180 && p.Lat >= -90 && p.Lat <= 90
+}
+
+// ParseBox 解析 minLon,minLat,maxLon,maxLat 格式的经纬度范围
+func ParseBox(value string) (Box, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return Box{}, ErrInvalidBox
+	}
+	values := make([]float64, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return Box{}, ErrInvalidBox
+		}
+		values[i] = v
+	}
+	box := Box{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if !(Point{box.MinLon, box.MinLat}).Valid() || !(Point{box.MaxLon, box.MaxLat}).Valid() || box.MinLat > box.MaxLat {
+		return Box{}, ErrInvalidBox
+	}
+	return box, nil
+}
+
+// CrossesAntimeridian 判断范围是否跨越 180 度经线
+func (b Box) CrossesAntimeridian() bool {
+	return b.MinLon > b.MaxLon
+}
+
+// Contains 判断坐标是否在范围内
+func (b Box) Contains(p Point) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.CrossesAntimeridian() {
+		return p.Lon >= b.MinLon || p.Lon <= b.MaxLon
+	}
+	return p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+}
+
+// Distance 使用半正矢公式计算两点间的球面距离（米）
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLon := radians(b.Lon - a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// BoxAround 返回包含以 center 为圆心、radius 米为半径的圆的最小经纬度范围，
+// 用于在数据库中预筛选后再按实际距离过滤
+func BoxAround(center Point, radius float64) Box {
+	dLat := degrees(radius / EarthRadius)
+	box := Box{MinLat: center.Lat - dLat, MaxLat: center.Lat + dLat, MinLon: -180, MaxLon: 180}
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		// 范围包含极点时覆盖全部经度
+		box.MinLat = math.Max(box.MinLat, -90)
+		box.MaxLat = math.Min(box.MaxLat, 90)
+		return box
+	}
+	dLon := degrees(math.Asin(math.Min(1, math.Sin(radius/EarthRadius)/math.Cos(radians(center.Lat)))))
+	if dLon >= 180 {
+		return box
+	}
+	box.MinLon = wrapLon(center.Lon - dLon)
+	box.MaxLon = wrapLon(center.Lon + dLon)
+	return box
+}
+
+// Cell 坐标在指定缩放级别下所在的网格，网格按 Web 墨卡托投影划分，在地图上近似为正方形
+type Cell struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// CellOf 返回坐标在缩放级别 zoom 下所在的网格
+func CellOf(p Point, zoom int) Cell {
+	n := float64(int(1)<<uint(clampZoom(zoom))) * cellsPerTile
+	lat := radians(math.Max(-maxMercatorLat, math.Min(maxMercatorLat, p.Lat)))
+	x := (p.Lon + 180) / 360
+	y := (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2
+	return Cell{X: clampIndex(x*n, n), Y: clampIndex(y*n, n)}
+}
+
+// Bounds 返回网格在缩放级别 zoom 下的经纬度范围
+func (c Cell) Bounds(zoom int) Box {
+	n := float64(int(1)<<uint(clampZoom(zoom))) * cellsPerTile
+	return Box{
+		MinLon: float64(c.X)/n*360 - 180,
+		MaxLon: float64(c.X+1)/n*360 - 180,
+		MaxLat: mercatorLat(float64(c.Y) / n),
+		MinLat: mercatorLat(float64(c.Y+1) / n),
+	}
+}
+
+func mercatorLat(y float64) float64 {
+	return degrees(math.Atan(math.Sinh(math.Pi * (1 - 2*y))))
+}
+
+func clampZoom(zoom int) int {
+	if zoom < 0 {
+		return 0
+	}
+	if zoom > MaxZoom {
+		return MaxZoom
+	}
+	return zoom
+}
+
+func clampIndex(v, n float64) int {
+	i := int(math.Floor(v))
+	if i < 0 {
+		return 0
+	}
+	if i >= int(n) {
+		return int(n) - 1
+	}
+	return i
+}
+
+func wrapLon(lon float64) float64 {
+	if lon > 180 {
+		return lon - 360
+	}
+	if lon < -180 {
+		return lon + 360
+	}
+	return lon
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
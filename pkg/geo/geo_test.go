@@ -0,0 +1,128 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestParseBox(t *testing.T) {
+	asserts := assert.New(t)
+
+	box, err := ParseBox("116.2, 39.8,116.5,40.1")
+	asserts.NoError(err)
+	asserts.Equal(Box{MinLon: 116.2, MinLat: 39.8, MaxLon: 116.5, MaxLat: 40.1}, box)
+	asserts.False(box.CrossesAntimeridian())
+
+	// 跨越 180 度经线
+	box, err = ParseBox("170,-10,-170,10")
+	asserts.NoError(err)
+	asserts.True(box.CrossesAntimeridian())
+	asserts.True(box.Contains(Point{Lon: 179, Lat: 0}))
+	asserts.True(box.Contains(Point{Lon: -179, Lat: 0}))
+	asserts.False(box.Contains(Point{Lon: 0, Lat: 0}))
+
+	for _, value := range []string{"", "1,2,3", "a,1,2,3", "0,10,1,5", "-181,0,0,1", "0,0,1,91"} {
+		_, err = ParseBox(value)
+		asserts.Equal(ErrInvalidBox, err, value)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 北京至上海约 1068 公里
+	beijing := Point{Lon: 116.4074, Lat: 39.9042}
+	shanghai := Point{Lon: 121.4737, Lat: 31.2304}
+	asserts.InDelta(1068000, Distance(beijing, shanghai), 5000)
+	asserts.Zero(Distance(beijing, beijing))
+
+	// 经度相差 1 度在赤道约 111 公里
+	asserts.InDelta(111195, Distance(Point{0, 0}, Point{1, 0}), 10)
+}
+
+func TestBoxAround(t *testing.T) {
+	asserts := assert.New(t)
+
+	center := Point{Lon: 116.4074, Lat: 39.9042}
+	box := BoxAround(center, 10000)
+	// 圆上各点均在范围内
+	for deg := 0; deg < 360; deg += 15 {
+		bearing := float64(deg) * math.Pi / 180
+		d := 10000 / EarthRadius
+		lat1, lon1 := center.Lat*math.Pi/180, center.Lon*math.Pi/180
+		lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(bearing))
+		lon2 := lon1 + math.Atan2(math.Sin(bearing)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+		p := Point{Lon: lon2 * 180 / math.Pi, Lat: lat2 * 180 / math.Pi}
+		asserts.True(box.Contains(Point{Lon: p.Lon - 1e-9*math.Copysign(1, p.Lon-center.Lon), Lat: p.Lat - 1e-9*math.Copysign(1, p.Lat-center.Lat)}), deg)
+	}
+	asserts.False(box.Contains(Point{Lon: 117, Lat: 39.9042}))
+
+	// 跨越 180 度经线
+	box = BoxAround(Point{Lon: 179.99, Lat: 0}, 10000)
+	asserts.True(box.CrossesAntimeridian())
+	asserts.True(box.Contains(Point{Lon: -179.99, Lat: 0}))
+
+	// 包含极点时覆盖全部经度
+	box = BoxAround(Point{Lon: 0, Lat: 89.99}, 10000)
+	asserts.Equal(-180.0, box.MinLon)
+	asserts.Equal(180.0, box.MaxLon)
+	asserts.Equal(90.0, box.MaxLat)
+}
+
+func TestGrid(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 缩放级别 0 时全球划分为 4x4 个网格
+	asserts.Equal(Cell{X: 0, Y: 0}, CellOf(Point{Lon: -180, Lat: 85}, 0))
+	asserts.Equal(Cell{X: 3, Y: 3}, CellOf(Point{Lon: 180, Lat: -90}, 0))
+	cell := CellOf(Point{Lon: 116.4, Lat: 39.9}, 10)
+	asserts.True(cell.Bounds(10).Contains(Point{Lon: 116.4, Lat: 39.9}))
+
+	grid := NewGrid(8)
+	grid.Add(Point{Lon: 116.40, Lat: 39.80}, "a")
+	grid.Add(Point{Lon: 116.40, Lat: 39.80}, "a")
+	grid.Add(Point{Lon: 116.41, Lat: 39.81}, "b")
+	grid.Add(Point{Lon: 121.47, Lat: 31.23}, "c")
+	clusters := grid.Clusters()
+	asserts.Len(clusters, 2)
+	asserts.Equal(int64(3), clusters[0].Count)
+	asserts.Equal(int64(2), clusters[0].Devices)
+	asserts.InDelta(116.4033, clusters[0].Center.Lon, 0.001)
+	asserts.Equal(int64(1), clusters[1].Count)
+
+	// 缩放级别越低网格越大
+	grid = NewGrid(2)
+	grid.Add(Point{Lon: 116.40, Lat: 39.90}, "a")
+	grid.Add(Point{Lon: 121.47, Lat: 31.23}, "c")
+	asserts.Len(grid.Clusters(), 1)
+}
+
+func TestFeatureWriter(t *testing.T) {
+	asserts := assert.New(t)
+	var buf bytes.Buffer
+
+	writer, err := NewFeatureWriter(&buf)
+	asserts.NoError(err)
+	asserts.NoError(writer.Close())
+	asserts.JSONEq(`{"type":"FeatureCollection","features":[]}`, buf.String())
+
+	buf.Reset()
+	writer, _ = NewFeatureWriter(&buf)
+	asserts.NoError(writer.Write(NewFeature(Point{Lon: 116.4, Lat: 39.9}, map[string]string{"name": "a"})))
+	asserts.NoError(writer.Write(NewFeature(Point{Lon: 121.4, Lat: 31.2}, nil)))
+	asserts.NoError(writer.Close())
+	asserts.Equal(2, writer.Count())
+
+	var collection struct {
+		Type     string    `json:"type"`
+		Features []Feature `json:"features"`
+	}
+	asserts.NoError(json.Unmarshal(buf.Bytes(), &collection))
+	asserts.Equal("FeatureCollection", collection.Type)
+	asserts.Len(collection.Features, 2)
+	asserts.Equal([2]float64{116.4, 39.9}, collection.Features[0].Geometry.Coordinates)
+	asserts.Equal("Point", collection.Features[0].Geometry.Type)
+}
@@ -0,0 +1,73 @@
+package geo
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// Geometry GeoJSON 点几何对象，坐标顺序为经度、纬度
+type Geometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// Feature GeoJSON 要素
+type Feature struct {
+	Type       string      `json:"type"`
+	Geometry   Geometry    `json:"geometry"`
+	Properties interface{} `json:"properties"`
+}
+
+// NewFeature 新建点要素
+func NewFeature(p Point, properties interface{}) Feature {
+	return Feature{
+		Type:       "Feature",
+		Geometry:   Geometry{Type: "Point", Coordinates: [2]float64{p.Lon, p.Lat}},
+		Properties: properties,
+	}
+}
+
+// FeatureWriter 逐个写出要素的 GeoJSON FeatureCollection，不在内存中保留已写出的要素
+type FeatureWriter struct {
+	w     *bufio.Writer
+	count int
+}
+
+// NewFeatureWriter 新建 FeatureCollection 写入器并写出集合头部
+func NewFeatureWriter(w io.Writer) (*FeatureWriter, error) {
+	writer := &FeatureWriter{w: bufio.NewWriter(w)}
+	if _, err := writer.w.WriteString(`{"type":"FeatureCollection","features":[`); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Write 写出一个要素
+func (fw *FeatureWriter) Write(feature Feature) error {
+	content, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+	if fw.count > 0 {
+		if err = fw.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	fw.count++
+	_, err = fw.w.Write(content)
+	return err
+}
+
+// Count 返回已写出的要素数量
+func (fw *FeatureWriter) Count() int {
+	return fw.count
+}
+
+// Close 写出集合尾部，不关闭底层写入器
+func (fw *FeatureWriter) Close() error {
+	if _, err := fw.w.WriteString("]}"); err != nil {
+		return err
+	}
+	return fw.w.Flush()
+}
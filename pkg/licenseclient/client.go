@@ -0,0 +1,443 @@
+package licenseclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zhouqiaokeji/server/pkg/licproto"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 授权状态，见 licproto
+const (
+	StatusActive    = licproto.StatusActive
+	StatusPending   = licproto.StatusPending
+	StatusExpired   = licproto.StatusExpired
+	StatusTrial     = licproto.StatusTrial
+	StatusSuspended = licproto.StatusSuspended
+	StatusRevoked   = licproto.StatusRevoked
+)
+
+var (
+	// ErrNoPublicKey 未配置返回结果签名对应的公钥
+	ErrNoPublicKey = errors.New("未找到签名密钥对应的公钥")
+	// ErrSignature 返回结果签名校验失败
+	ErrSignature = errors.New("返回结果签名校验失败")
+	// ErrNonceMismatch 返回结果中的随机数与请求不一致
+	ErrNonceMismatch = errors.New("返回结果与请求不匹配")
+	// ErrNoCache 服务端不可用且没有可用的缓存结果
+	ErrNoCache = errors.New("授权服务不可用且无可用缓存")
+)
+
+// ServerError 服务端返回的业务错误
+type ServerError struct {
+	Code int
+	Msg  string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("授权服务返回错误 %d: %s", e.Code, e.Msg)
+}
+
+// Config 客户端配置
+type Config struct {
+	// BaseURL 授权服务地址，如 https://license.example.com
+	BaseURL string
+	// PublicKeys 受信任的验签公钥，键为密钥ID，值为 PEM 格式公钥；
+	// 签名密钥同时用于加密请求
+	PublicKeys map[string]string
+	// Signing 加密请求使用的密钥ID，为空时使用 licproto.DefaultKeyID
+	Signing string
+	// CacheDir 最近一次有效校验结果的缓存目录，为空时不缓存
+	CacheDir string
+	// CacheTTL 缓存结果的最长使用时间，为 0 时仅受授权有效期限制
+	CacheTTL time.Duration
+	// HTTPClient 为空时使用 http.DefaultClient
+	HTTPClient *http.Client
+	// Gzip 批量上报时使用 gzip 压缩请求体
+	Gzip bool
+}
+
+// Client 授权服务客户端
+type Client struct {
+	config Config
+}
+
+// Fingerprint 主机硬件指纹，与 models.Fingerprint 结构一致
+type Fingerprint struct {
+	MachineID  string   `json:"machineId,omitempty"`
+	MACs       []string `json:"macs,omitempty"`
+	DiskSerial string   `json:"diskSerial,omitempty"`
+	CPUModel   string   `json:"cpuModel,omitempty"`
+	Hostname   string   `json:"hostname,omitempty"`
+}
+
+// LicenseRequest 授权申请及校验请求
+type LicenseRequest struct {
+	Name        string `json:"name"`
+	ContainerID string `json:"containerId"`
+	InstanceID  string `json:"instanceId,omitempty"`
+	// SeatID 浮动授权签出的席位，校验浮动授权时必填
+	SeatID      string       `json:"seatId,omitempty"`
+	IP          string       `json:"ip,omitempty"`
+	Domain      string       `json:"domain,omitempty"`
+	Fingerprint *Fingerprint `json:"fingerprint,omitempty"`
+}
+
+// DeviceInfo 服务上报的设备信息
+type DeviceInfo struct {
+	Name         string  `json:"name"`
+	ServerAddr   string  `json:"server_addr"`
+	Version      string  `json:"version"`
+	Platform     string  `json:"platform"`
+	WIFIName     string  `json:"wifi_name"`
+	WIFIMac      string  `json:"wifi_mac"`
+	BootLoader   string  `json:"boot_loader"`
+	LON          float32 `json:"lon"`
+	LAT          float32 `json:"lat"`
+	OSVersion    string  `json:"os_version"`
+	DeviceSN     string  `json:"device_sn"`
+	DeviceVendor string  `json:"device_vendor"`
+}
+
+// UserInfo 服务上报的终端用户信息
+type UserInfo struct {
+	UserId   int64  `json:"user_id,string"`
+	UserName string `json:"user_name"`
+	Mobile   string `json:"mobile"`
+}
+
+// CheckInResult 服务上报结果
+type CheckInResult struct {
+	ID      uint64 `json:"id"`
+	OverCap bool   `json:"overCap"`
+}
+
+// CheckInRecord 离线缓存的服务上报记录，Time 为记录产生时间，为空时使用当前时间；
+// Nonce 用于服务端对重试的记录去重，为空时自动生成并回填，应随记录一同持久化
+type CheckInRecord struct {
+	Device *DeviceInfo
+	User   *UserInfo
+	Time   time.Time
+	Nonce  string
+}
+
+// BatchResult 批量上报中单条记录的处理结果，与请求中的记录按顺序一一对应
+type BatchResult struct {
+	Index     int    `json:"index"`
+	ID        uint64 `json:"id"`
+	Nonce     string `json:"nonce"`
+	Code      int    `json:"code"`
+	Msg       string `json:"msg"`
+	Duplicate bool   `json:"duplicate"`
+	OverCap   bool   `json:"overCap"`
+}
+
+// OK 判断记录是否已被服务端接收，接收的记录可从本地缓存中删除
+func (r *BatchResult) OK() bool {
+	return r.Code == licproto.CodeOK
+}
+
+// signed 服务端加签返回的数据
+type signed struct {
+	Sign string `json:"sign"`
+	Kid  string `json:"kid"`
+	Data string `json:"data"`
+}
+
+// response 服务端统一返回格式
+type response struct {
+	Code int             `json:"code"`
+	Data json.RawMessage `json:"data"`
+	Msg  string          `json:"msg"`
+}
+
+// New 新建客户端
+func New(config Config) (*Client, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("授权服务地址不能为空")
+	}
+	if len(config.PublicKeys) == 0 {
+		return nil, ErrNoPublicKey
+	}
+	if config.Signing == "" {
+		config.Signing = licproto.DefaultKeyID
+	}
+	if _, ok := config.PublicKeys[config.Signing]; !ok {
+		return nil, ErrNoPublicKey
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &Client{config: config}, nil
+}
+
+// Create 申请授权，授权已存在时等同于校验
+func (c *Client) Create(ctx context.Context, req *LicenseRequest) (*Result, error) {
+	return c.license(ctx, "/license/create", req)
+}
+
+// Verify 校验授权；服务端不可用时返回磁盘中缓存的最近一次有效结果，
+// 服务端明确拒绝时清除缓存
+func (c *Client) Verify(ctx context.Context, req *LicenseRequest) (*Result, error) {
+	res, err := c.license(ctx, "/license/verify", req)
+	if err == nil {
+		return res, nil
+	}
+	// 服务端明确拒绝或返回结果不可信时不使用缓存，服务端内部错误及网络错误时使用缓存
+	var serverErr *ServerError
+	if (errors.As(err, &serverErr) && serverErr.Code < 50000) || errors.Is(err, ErrSignature) || errors.Is(err, ErrNonceMismatch) {
+		c.removeCache(req.ContainerID)
+		return nil, err
+	}
+	cached, cacheErr := c.loadCache(req.ContainerID)
+	if cacheErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoCache, err)
+	}
+	return cached, nil
+}
+
+// CheckIn 上报服务使用信息
+func (c *Client) CheckIn(ctx context.Context, device *DeviceInfo, user *UserInfo) (*CheckInResult, error) {
+	nonce := newNonce()
+	deviceInfo, err := json.Marshal(struct {
+		*DeviceInfo
+		Timestamp int64  `json:"timestamp"`
+		Nonce     string `json:"nonce"`
+	}{device, time.Now().Unix(), nonce})
+	if err != nil {
+		return nil, err
+	}
+	userInfo, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	envelope, cipherTexts, err := licproto.SealEnvelopeWithKid(c.config.Signing, c.config.PublicKeys[c.config.Signing], deviceInfo, userInfo)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]interface{}{
+		"version": envelope.Version,
+		"ek":      envelope.Key,
+		"kid":     envelope.Kid,
+		"key":     md5Hex(deviceInfo),
+		"d_str":   cipherTexts[0],
+		"u_str":   cipherTexts[1],
+	}
+
+	data, err := c.call(ctx, "/check/server", payload, false)
+	if err != nil {
+		return nil, err
+	}
+	res := &struct {
+		CheckInResult
+		Nonce string `json:"nonce"`
+	}{}
+	if err = json.Unmarshal([]byte(data.Data), res); err != nil {
+		return nil, err
+	}
+	if res.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return &res.CheckInResult, nil
+}
+
+// CheckInBatch 批量上报离线缓存的服务使用信息，各条记录保留其产生时间，
+// 返回每条记录的处理结果，客户端据此删除已接收的记录并保留失败的记录以便重试
+func (c *Client) CheckInBatch(ctx context.Context, records []*CheckInRecord) ([]BatchResult, error) {
+	nonce := newNonce()
+	guard, err := json.Marshal(map[string]interface{}{"timestamp": time.Now().Unix(), "nonce": nonce})
+	if err != nil {
+		return nil, err
+	}
+	plainTexts := [][]byte{guard}
+	for _, record := range records {
+		if record.Nonce == "" {
+			record.Nonce = newNonce()
+		}
+		at := record.Time
+		if at.IsZero() {
+			at = time.Now()
+		}
+		deviceInfo, err := json.Marshal(struct {
+			*DeviceInfo
+			Timestamp int64  `json:"timestamp"`
+			Nonce     string `json:"nonce"`
+		}{record.Device, at.Unix(), record.Nonce})
+		if err != nil {
+			return nil, err
+		}
+		userInfo, err := json.Marshal(record.User)
+		if err != nil {
+			return nil, err
+		}
+		plainTexts = append(plainTexts, deviceInfo, userInfo)
+	}
+	envelope, cipherTexts, err := licproto.SealEnvelopeWithKid(c.config.Signing, c.config.PublicKeys[c.config.Signing], plainTexts...)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]string, 0, len(records))
+	for i := 1; i < len(cipherTexts); i += 2 {
+		items = append(items, map[string]string{"d_str": cipherTexts[i], "u_str": cipherTexts[i+1]})
+	}
+	payload := map[string]interface{}{
+		"version": envelope.Version,
+		"ek":      envelope.Key,
+		"kid":     envelope.Kid,
+		"g_str":   cipherTexts[0],
+		"items":   items,
+	}
+
+	data, err := c.call(ctx, "/check/server/batch", payload, c.config.Gzip)
+	if err != nil {
+		return nil, err
+	}
+	res := &struct {
+		Nonce   string        `json:"nonce"`
+		Results []BatchResult `json:"results"`
+	}{}
+	if err = json.Unmarshal([]byte(data.Data), res); err != nil {
+		return nil, err
+	}
+	if res.Nonce != nonce || len(res.Results) != len(records) {
+		return nil, ErrNonceMismatch
+	}
+	return res.Results, nil
+}
+
+// license 加密授权请求并调用接口，校验通过的结果写入缓存
+func (c *Client) license(ctx context.Context, path string, req *LicenseRequest) (*Result, error) {
+	nonce := newNonce()
+	plainText, err := json.Marshal(struct {
+		*LicenseRequest
+		Timestamp int64  `json:"timestamp"`
+		Nonce     string `json:"nonce"`
+	}{req, time.Now().Unix(), nonce})
+	if err != nil {
+		return nil, err
+	}
+	envelope, cipherTexts, err := licproto.SealEnvelopeWithKid(c.config.Signing, c.config.PublicKeys[c.config.Signing], plainText)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]interface{}{
+		"version": envelope.Version,
+		"ek":      envelope.Key,
+		"kid":     envelope.Kid,
+		"key":     md5Hex(plainText),
+		"info":    cipherTexts[0],
+	}
+
+	data, err := c.call(ctx, path, payload, false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := parseResult(data)
+	if err != nil {
+		return nil, err
+	}
+	if res.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	c.saveCache(res)
+	return res, nil
+}
+
+// call 调用接口并校验返回结果签名，compress 为 true 时使用 gzip 压缩请求体
+func (c *Client) call(ctx context.Context, path string, payload interface{}, compress bool) (*signed, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err = gz.Write(body); err != nil {
+			return nil, err
+		}
+		if err = gz.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if compress {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := c.config.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("授权服务返回 HTTP %d", resp.StatusCode)
+	}
+
+	var res response
+	if err = json.Unmarshal(content, &res); err != nil {
+		return nil, err
+	}
+	if res.Code != licproto.CodeOK {
+		msg := res.Msg
+		if msg == "" {
+			// 部分错误将说明放在 data 中
+			_ = json.Unmarshal(res.Data, &msg)
+		}
+		return nil, &ServerError{Code: res.Code, Msg: msg}
+	}
+	data := &signed{}
+	if err = json.Unmarshal(res.Data, data); err != nil {
+		return nil, err
+	}
+	if err = c.verifySign(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// verifySign 使用对应密钥ID的公钥校验签名，旧版返回未携带密钥ID时使用签名密钥
+func (c *Client) verifySign(data *signed) error {
+	kid := data.Kid
+	if kid == "" {
+		kid = c.config.Signing
+	}
+	publicPem, ok := c.config.PublicKeys[kid]
+	if !ok {
+		return ErrNoPublicKey
+	}
+	if err := licproto.VerifyRSA([]byte(data.Data), data.Sign, publicPem); err != nil {
+		return ErrSignature
+	}
+	return nil
+}
+
+func md5Hex(data []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(data))
+}
+
+func newNonce() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
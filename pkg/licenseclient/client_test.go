@@ -0,0 +1,261 @@
+package licenseclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/binding"
+	"github.com/zhouqiaokeji/server/pkg/cache"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/id"
+	"github.com/zhouqiaokeji/server/pkg/licenseclient"
+	"github.com/zhouqiaokeji/server/pkg/rsa"
+	"github.com/zhouqiaokeji/server/routers"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var server *httptest.Server
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	id.Init()
+	conf.SystemConfig.Debug = true
+	cache.Store = cache.NewMemoStore()
+	_ = rsa.Ring.Generate(rsa.DefaultKeyID, 1024)
+	_ = rsa.Ring.SetSigning(rsa.DefaultKeyID)
+	model.Init()
+	server = httptest.NewServer(routers.InitMasterRouter())
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+func publicKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, key := range rsa.Ring.PublicKeys() {
+		keys[key.Kid] = key.Pem
+	}
+	return keys
+}
+
+func newClient(t *testing.T, baseURL string, cacheDir string) *licenseclient.Client {
+	client, err := licenseclient.New(licenseclient.Config{
+		BaseURL:    baseURL,
+		PublicKeys: publicKeys(),
+		CacheDir:   cacheDir,
+	})
+	assert.NoError(t, err)
+	return client
+}
+
+func activate(t *testing.T, containerID string) {
+	lic, err := model.GetLicense(containerID)
+	assert.NoError(t, err)
+	assert.NoError(t, lic.Transition(model.StatusActive, "test", nil))
+}
+
+func TestNew(t *testing.T) {
+	asserts := assert.New(t)
+
+	_, err := licenseclient.New(licenseclient.Config{PublicKeys: publicKeys()})
+	asserts.Error(err)
+
+	_, err = licenseclient.New(licenseclient.Config{BaseURL: server.URL})
+	asserts.Equal(licenseclient.ErrNoPublicKey, err)
+
+	_, err = licenseclient.New(licenseclient.Config{BaseURL: server.URL, PublicKeys: publicKeys(), Signing: "unknown"})
+	asserts.Equal(licenseclient.ErrNoPublicKey, err)
+}
+
+func TestCreateAndVerify(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	client := newClient(t, server.URL, "")
+	req := &licenseclient.LicenseRequest{
+		Name:        "TestCreateAndVerify",
+		ContainerID: "TestCreateAndVerify",
+		InstanceID:  "instance-1",
+		Fingerprint: &licenseclient.Fingerprint{MachineID: "machine", Hostname: "host"},
+	}
+
+	// 新申请的授权待审核
+	res, err := client.Create(ctx, req)
+	asserts.NoError(err)
+	asserts.Equal(licenseclient.StatusPending, res.Status)
+	asserts.False(res.Usable())
+	asserts.False(res.Cached)
+
+	// 审核前校验被拒绝
+	_, err = client.Verify(ctx, req)
+	var serverErr *licenseclient.ServerError
+	asserts.ErrorAs(err, &serverErr)
+
+	// 审核通过后校验成功并分配租约
+	activate(t, req.ContainerID)
+	res, err = client.Verify(ctx, req)
+	asserts.NoError(err)
+	asserts.True(res.Usable())
+	asserts.Equal(req.ContainerID, res.ContainerID)
+	asserts.NotEmpty(res.LeaseID)
+	asserts.NotNil(res.LeaseExpire)
+	_, ok := res.ExpireTime()
+	asserts.False(ok)
+
+	// 其他实例无法同时使用
+	other := *req
+	other.InstanceID = "instance-2"
+	_, err = client.Verify(ctx, &other)
+	asserts.ErrorAs(err, &serverErr)
+}
+
+func TestVerifyCache(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "licenseclient")
+	asserts.NoError(err)
+	defer os.RemoveAll(dir)
+	req := &licenseclient.LicenseRequest{Name: "TestVerifyCache", ContainerID: "TestVerifyCache", InstanceID: "instance"}
+
+	client := newClient(t, server.URL, dir)
+	_, err = client.Create(ctx, req)
+	asserts.NoError(err)
+	activate(t, req.ContainerID)
+	res, err := client.Verify(ctx, req)
+	asserts.NoError(err)
+	asserts.False(res.Cached)
+
+	// 服务端不可用时使用缓存
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	offline := newClient(t, down.URL, dir)
+	res, err = offline.Verify(ctx, req)
+	asserts.NoError(err)
+	asserts.True(res.Cached)
+	asserts.True(res.Usable())
+	asserts.Equal(req.ContainerID, res.ContainerID)
+
+	// 缓存被篡改时不可用
+	files, _ := ioutil.ReadDir(dir)
+	asserts.Len(files, 1)
+	path := dir + "/" + files[0].Name()
+	content, _ := ioutil.ReadFile(path)
+	asserts.NoError(ioutil.WriteFile(path, []byte(strings.Replace(string(content), "TestVerifyCache", "TestVerifyCacheX", 1)), 0600))
+	_, err = offline.Verify(ctx, req)
+	asserts.Error(err)
+
+	// 没有缓存
+	_, err = newClient(t, down.URL, "").Verify(ctx, req)
+	asserts.ErrorIs(err, licenseclient.ErrNoCache)
+}
+
+func TestVerifyTampered(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	req := &licenseclient.LicenseRequest{Name: "TestVerifyTampered", ContainerID: "TestVerifyTampered", InstanceID: "instance"}
+	_, err := newClient(t, server.URL, "").Create(ctx, req)
+	asserts.NoError(err)
+	activate(t, req.ContainerID)
+
+	// 中间人修改返回数据
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := http.Post(server.URL+r.URL.Path, "application/json", r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		if data, ok := body["data"].(map[string]interface{}); ok {
+			data["data"] = strings.Replace(data["data"].(string), `"status":0`, `"status":3`, 1)
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	defer proxy.Close()
+
+	_, err = newClient(t, proxy.URL, "").Verify(ctx, req)
+	asserts.Equal(licenseclient.ErrSignature, err)
+}
+
+func TestCheckIn(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	client := newClient(t, server.URL, "")
+
+	req := &licenseclient.LicenseRequest{Name: "TestCheckIn", ContainerID: "TestCheckIn", InstanceID: "instance"}
+	_, err := client.Create(ctx, req)
+	asserts.NoError(err)
+	lic, _ := model.GetLicense(req.ContainerID)
+	rules, _ := binding.ParseAll([]string{"checkin.example.com"})
+	asserts.NoError(lic.SetBindings(rules))
+	asserts.NoError(lic.SetUsageCap(1, ""))
+
+	device := &licenseclient.DeviceInfo{Name: "app", ServerAddr: "checkin.example.com", DeviceSN: "sn-1", Platform: "android"}
+	user := &licenseclient.UserInfo{UserId: 1, UserName: "user"}
+	res, err := client.CheckIn(ctx, device, user)
+	asserts.NoError(err)
+	asserts.NotZero(res.ID)
+	asserts.False(res.OverCap)
+
+	// 超出每月用量上限时标记
+	res, err = client.CheckIn(ctx, device, user)
+	asserts.NoError(err)
+	asserts.True(res.OverCap)
+}
+
+func TestCheckInBatch(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	client, err := licenseclient.New(licenseclient.Config{BaseURL: server.URL, PublicKeys: publicKeys(), Gzip: true})
+	asserts.NoError(err)
+
+	req := &licenseclient.LicenseRequest{Name: "TestCheckInBatch", ContainerID: "TestCheckInBatch", InstanceID: "instance"}
+	_, err = client.Create(ctx, req)
+	asserts.NoError(err)
+	lic, _ := model.GetLicense(req.ContainerID)
+	rules, _ := binding.ParseAll([]string{"batch.example.com"})
+	asserts.NoError(lic.SetBindings(rules))
+
+	offline := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	device := &licenseclient.DeviceInfo{Name: "app", ServerAddr: "batch.example.com", DeviceSN: "sn-1", Platform: "ios"}
+	user := &licenseclient.UserInfo{UserId: 1, UserName: "user"}
+	records := []*licenseclient.CheckInRecord{
+		{Device: device, User: user, Time: offline},
+		{Device: device, User: user},
+	}
+	results, err := client.CheckInBatch(ctx, records)
+	asserts.NoError(err)
+	asserts.Len(results, 2)
+	for i, res := range results {
+		asserts.True(res.OK())
+		asserts.False(res.Duplicate)
+		asserts.NotZero(res.ID)
+		asserts.Equal(records[i].Nonce, res.Nonce)
+	}
+
+	// 保留客户端记录时间
+	var info model.AppUseInfo
+	asserts.NoError(model.DB.First(&info, results[0].ID).Error)
+	asserts.True(offline.Equal(info.CreatedAt))
+
+	// 重试时已接收的记录按重复处理
+	records = append(records, &licenseclient.CheckInRecord{Device: device, User: user})
+	results, err = client.CheckInBatch(ctx, records)
+	asserts.NoError(err)
+	asserts.Len(results, 3)
+	asserts.True(results[0].OK())
+	asserts.True(results[0].Duplicate)
+	asserts.True(results[1].Duplicate)
+	asserts.False(results[2].Duplicate)
+	asserts.NotZero(results[2].ID)
+}
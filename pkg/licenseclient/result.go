@@ -0,0 +1,158 @@
+package licenseclient
+
+import (
+	"encoding/json"
+	"github.com/zhouqiaokeji/server/pkg/licproto"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Entitlement 授权权益，与 models.Entitlement 结构一致
+type Entitlement struct {
+	Features []string          `json:"features"`
+	Limits   map[string]int64  `json:"limits"`
+	Extras   map[string]string `json:"extras"`
+}
+
+// Result 校验通过的授权信息
+type Result struct {
+	Name        string      `json:"name"`
+	ContainerID string      `json:"containerId"`
+	Status      int         `json:"status"`
+	Expire      string      `json:"expire"`
+	Entitlement Entitlement `json:"entitlement"`
+	Revision    int         `json:"revision"`
+	Seats       int         `json:"seats"`
+	LeaseID     string      `json:"leaseId"`
+	LeaseExpire *time.Time  `json:"leaseExpire"`
+	LeaseTTL    int         `json:"leaseTtl"`
+	Nonce       string      `json:"nonce"`
+	OverCap     bool        `json:"overCap"`
+
+	// Cached 为 true 表示服务端不可用，结果来自磁盘缓存
+	Cached bool `json:"-"`
+	// ReceivedAt 从服务端获取结果的时间
+	ReceivedAt time.Time `json:"-"`
+
+	raw *signed
+}
+
+// cacheEntry 磁盘缓存内容，保留原始签名以便读取时重新验签
+type cacheEntry struct {
+	Data       string    `json:"data"`
+	Sign       string    `json:"sign"`
+	Kid        string    `json:"kid"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Usable 判断授权是否处于正常或试用状态且未过期
+func (r *Result) Usable() bool {
+	return (r.Status == StatusActive || r.Status == StatusTrial) && !r.Expired()
+}
+
+// Expired 判断授权是否已过期，未设置有效期时视为长期有效
+func (r *Result) Expired() bool {
+	expire, ok := r.ExpireTime()
+	return ok && time.Now().After(expire)
+}
+
+// ExpireTime 返回授权有效期，未设置时 ok 为 false
+func (r *Result) ExpireTime() (expire time.Time, ok bool) {
+	if r.Expire == "" {
+		return expire, false
+	}
+	expire, err := time.ParseInLocation(licproto.DateFormat, r.Expire, time.Local)
+	return expire, err == nil
+}
+
+// HasFeature 判断是否开通指定功能
+func (r *Result) HasFeature(feature string) bool {
+	for _, f := range r.Entitlement.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+func parseResult(data *signed) (*Result, error) {
+	res := &Result{raw: data, ReceivedAt: time.Now()}
+	if err := json.Unmarshal([]byte(data.Data), res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// cachePath 返回容器对应的缓存文件路径
+func (c *Client) cachePath(containerID string) string {
+	return filepath.Join(c.config.CacheDir, unsafeFileChars.ReplaceAllString(containerID, "_")+".json")
+}
+
+// saveCache 将校验通过的结果写入缓存，先写临时文件再替换，避免中断时留下不完整的缓存
+func (c *Client) saveCache(res *Result) {
+	if c.config.CacheDir == "" || res.raw == nil {
+		return
+	}
+	content, err := json.Marshal(&cacheEntry{
+		Data:       res.raw.Data,
+		Sign:       res.raw.Sign,
+		Kid:        res.raw.Kid,
+		ReceivedAt: res.ReceivedAt,
+	})
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(c.config.CacheDir, 0700); err != nil {
+		return
+	}
+	path := c.cachePath(res.ContainerID)
+	if err = ioutil.WriteFile(path+".tmp", content, 0600); err != nil {
+		return
+	}
+	_ = os.Rename(path+".tmp", path)
+}
+
+// loadCache 读取缓存并重新验签，缓存超过有效时间或授权已不可用时视为无效
+func (c *Client) loadCache(containerID string) (*Result, error) {
+	if c.config.CacheDir == "" {
+		return nil, ErrNoCache
+	}
+	content, err := ioutil.ReadFile(c.cachePath(containerID))
+	if err != nil {
+		return nil, ErrNoCache
+	}
+	var entry cacheEntry
+	if err = json.Unmarshal(content, &entry); err != nil {
+		return nil, ErrNoCache
+	}
+	data := &signed{Data: entry.Data, Sign: entry.Sign, Kid: entry.Kid}
+	if err = c.verifySign(data); err != nil {
+		return nil, err
+	}
+	res, err := parseResult(data)
+	if err != nil {
+		return nil, ErrNoCache
+	}
+	res.Cached = true
+	res.ReceivedAt = entry.ReceivedAt
+	if c.config.CacheTTL > 0 && time.Since(entry.ReceivedAt) > c.config.CacheTTL {
+		return nil, ErrNoCache
+	}
+	if res.ContainerID != containerID || !res.Usable() {
+		return nil, ErrNoCache
+	}
+	return res, nil
+}
+
+// removeCache 删除容器对应的缓存
+func (c *Client) removeCache(containerID string) {
+	if c.config.CacheDir == "" {
+		return
+	}
+	_ = os.Remove(c.cachePath(containerID))
+}
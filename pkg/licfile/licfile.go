@@ -0,0 +1,128 @@
+package licfile
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/rsa"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"time"
+)
+
+// Version 当前离线授权文件格式版本
+const Version = 1
+
+// 可用的授权状态，与 models.StatusActive、models.StatusTrial 保持一致
+const (
+	statusActive = 0
+	statusTrial  = 3
+)
+
+var (
+	ErrMalformed = errors.New("授权文件格式错误")
+	ErrSignature = errors.New("授权文件签名校验失败")
+	ErrVersion   = errors.New("不支持的授权文件版本")
+	ErrInactive  = errors.New("授权未启用")
+	ErrExpired   = errors.New("授权已过期")
+)
+
+// Payload 离线授权文件载荷
+type Payload struct {
+	Name        string      `json:"name"`
+	ContainerID string      `json:"containerId"`
+	Status      int         `json:"status"`
+	Expire      string      `json:"expire"`
+	IP          string      `json:"ip"`
+	Domain      string      `json:"domain"`
+	Bindings    []string    `json:"bindings,omitempty"`
+	Entitlement Entitlement `json:"entitlement"`
+	Revision    int         `json:"revision"`
+	IssuedAt    time.Time   `json:"issuedAt"`
+	Version     int         `json:"version"`
+}
+
+// Entitlement 授权权益，与 models.Entitlement 结构一致
+type Entitlement struct {
+	Features []string          `json:"features"`
+	Limits   map[string]int64  `json:"limits"`
+	Extras   map[string]string `json:"extras"`
+}
+
+// HasFeature 判断是否开通指定功能
+func (e *Entitlement) HasFeature(feature string) bool {
+	return util.ContainsString(e.Features, feature)
+}
+
+// Limit 获取数量限制，未设置时返回 ok=false
+func (e *Entitlement) Limit(name string) (limit int64, ok bool) {
+	limit, ok = e.Limits[name]
+	return
+}
+
+// File 离线授权文件，结构与在线校验返回的 sign/data 保持一致
+type File struct {
+	Data string `json:"data"`
+	Sign string `json:"sign"`
+	Kid  string `json:"kid"`
+}
+
+// Sign 使用服务端私钥签发离线授权文件
+func Sign(payload *Payload) ([]byte, error) {
+	payload.Version = Version
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	sign, kid := rsa.SignRSAWithKid(data)
+	return json.MarshalIndent(&File{
+		Data: string(data),
+		Sign: sign,
+		Kid:  kid,
+	}, "", "  ")
+}
+
+// KeyID 返回授权文件签名所用的密钥ID，便于客户端选择对应公钥
+func KeyID(content []byte) string {
+	var file File
+	_ = json.Unmarshal(content, &file)
+	return file.Kid
+}
+
+// Verify 仅使用公钥校验离线授权文件，返回其中的授权载荷
+func Verify(content []byte, publicPem string) (*Payload, error) {
+	var (
+		file    File
+		payload Payload
+	)
+	if err := json.Unmarshal(content, &file); err != nil || file.Data == "" {
+		return nil, ErrMalformed
+	}
+	if err := rsa.VerifyRSA([]byte(file.Data), file.Sign, publicPem); err != nil {
+		return nil, ErrSignature
+	}
+	if err := json.Unmarshal([]byte(file.Data), &payload); err != nil {
+		return nil, ErrMalformed
+	}
+	if payload.Version <= 0 || payload.Version > Version {
+		return &payload, ErrVersion
+	}
+	if payload.Status != statusActive && payload.Status != statusTrial {
+		return &payload, ErrInactive
+	}
+	if payload.Expired() {
+		return &payload, ErrExpired
+	}
+	return &payload, nil
+}
+
+// Expired 判断授权是否已过期，未设置过期时间视为长期有效
+func (p *Payload) Expired() bool {
+	if p.Expire == "" {
+		return false
+	}
+	loc, _ := time.LoadLocation("Local")
+	expire, err := time.ParseInLocation(util.FORMAT_DATE_y4Md, p.Expire, loc)
+	if err != nil {
+		return true
+	}
+	return time.Now().After(expire)
+}
@@ -0,0 +1,72 @@
+package licfile
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/rsa"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"testing"
+	"time"
+)
+
+// testPublicPem 测试密钥环的签名公钥
+var testPublicPem string
+
+func init() {
+	rsa.Ring = rsa.NewKeyRing()
+	if err := rsa.Ring.Generate(rsa.DefaultKeyID, 1024); err != nil {
+		panic(err)
+	}
+	_ = rsa.Ring.SetSigning(rsa.DefaultKeyID)
+	testPublicPem = rsa.Ring.PublicKeys()[0].Pem
+}
+
+func TestSignAndVerify(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 正常情况
+	{
+		content, err := Sign(&Payload{
+			Name:        "test",
+			ContainerID: "container",
+			Expire:      time.Now().AddDate(0, 0, 2).Format(util.FORMAT_DATE_y4Md),
+			IssuedAt:    time.Now(),
+		})
+		asserts.NoError(err)
+		payload, err := Verify(content, testPublicPem)
+		asserts.NoError(err)
+		asserts.Equal("container", payload.ContainerID)
+		asserts.Equal(Version, payload.Version)
+	}
+
+	// 内容被篡改
+	{
+		content, _ := Sign(&Payload{Name: "test", ContainerID: "container"})
+		var file File
+		_ = json.Unmarshal(content, &file)
+		file.Data = `{"name":"fake","containerId":"container","version":1}`
+		content, _ = json.Marshal(file)
+		_, err := Verify(content, testPublicPem)
+		asserts.Equal(ErrSignature, err)
+	}
+
+	// 格式错误
+	{
+		_, err := Verify([]byte("not a license"), testPublicPem)
+		asserts.Equal(ErrMalformed, err)
+	}
+
+	// 授权未启用
+	{
+		content, _ := Sign(&Payload{Name: "test", Status: 1})
+		_, err := Verify(content, testPublicPem)
+		asserts.Equal(ErrInactive, err)
+	}
+
+	// 授权已过期
+	{
+		content, _ := Sign(&Payload{Name: "test", Expire: "20000101"})
+		_, err := Verify(content, testPublicPem)
+		asserts.Equal(ErrExpired, err)
+	}
+}
@@ -0,0 +1,118 @@
+package licproto
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+)
+
+const (
+	// EnvelopeLegacy 旧版信封，明文直接使用 RSA PKCS#1 v1.5 加密，长度受单个 RSA 块限制
+	EnvelopeLegacy = 1
+	// EnvelopeHybrid 混合加密信封，随机 AES-256 密钥使用 RSA-OAEP(SHA-256) 加密，
+	// 明文使用 AES-GCM 加密，密文格式为 base64(nonce || ciphertext)
+	EnvelopeHybrid = 2
+
+	// EnvelopeKeySize 混合加密信封的 AES 密钥长度
+	EnvelopeKeySize = 32
+)
+
+// ErrInvalidPublicKey 公钥格式错误
+var ErrInvalidPublicKey = errors.New("invalid public key")
+
+// Envelope 客户端加密信封，Key 为使用公钥加密后的 AES 密钥（仅混合加密信封使用），
+// Kid 为加密所用公钥的密钥ID，服务端仅使用该密钥解密
+type Envelope struct {
+	Version int    `json:"version"`
+	Key     string `json:"ek,omitempty"`
+	Kid     string `json:"kid,omitempty"`
+}
+
+// ParsePublicKey 解析 PEM 格式的 RSA 公钥
+func ParsePublicKey(publicPem string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicPem))
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	publicKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := publicKeyInterface.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidPublicKey
+	}
+	return publicKey, nil
+}
+
+// VerifyRSA 使用公钥校验服务端 SHA256 PKCS#1 v1.5 签名，sign 为 base64 编码
+func VerifyRSA(data []byte, sign string, publicPem string) error {
+	signText, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return err
+	}
+	publicKey, err := ParsePublicKey(publicPem)
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signText)
+}
+
+// SealEnvelope 生成随机 AES 密钥并使用公钥加密，返回混合加密信封及各明文对应的密文；
+// 信封不携带密钥ID，服务端须依次尝试密钥环中的密钥，建议使用 SealEnvelopeWithKid
+func SealEnvelope(publicPem string, plainTexts ...[]byte) (*Envelope, []string, error) {
+	return SealEnvelopeWithKid("", publicPem, plainTexts...)
+}
+
+// SealEnvelopeWithKid 与 SealEnvelope 相同，信封同时携带公钥对应的密钥ID
+func SealEnvelopeWithKid(kid, publicPem string, plainTexts ...[]byte) (*Envelope, []string, error) {
+	publicKey, err := ParsePublicKey(publicPem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := make([]byte, EnvelopeKeySize)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := NewAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cipherTexts := make([]string, 0, len(plainTexts))
+	for _, plainText := range plainTexts {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, nil, err
+		}
+		cipherTexts = append(cipherTexts, base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plainText, nil)))
+	}
+	return &Envelope{
+		Version: EnvelopeHybrid,
+		Key:     base64.StdEncoding.EncodeToString(wrapped),
+		Kid:     kid,
+	}, cipherTexts, nil
+}
+
+// NewAEAD 使用 AES 密钥创建 AES-GCM 加解密器
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,72 @@
+package licproto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newTestKey(t *testing.T) (*rsa.PrivateKey, string) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	return privateKey, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestVerifyRSA(t *testing.T) {
+	asserts := assert.New(t)
+	privateKey, publicPem := newTestKey(t)
+
+	data := []byte("license")
+	hashed := sha256.Sum256(data)
+	signText, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	asserts.NoError(err)
+	sign := base64.StdEncoding.EncodeToString(signText)
+
+	asserts.NoError(VerifyRSA(data, sign, publicPem))
+	asserts.Error(VerifyRSA([]byte("tampered"), sign, publicPem))
+	asserts.Error(VerifyRSA(data, "not base64!", publicPem))
+	asserts.Equal(ErrInvalidPublicKey, VerifyRSA(data, sign, "bad key"))
+}
+
+func TestSealEnvelope(t *testing.T) {
+	asserts := assert.New(t)
+	privateKey, publicPem := newTestKey(t)
+
+	envelope, cipherTexts, err := SealEnvelope(publicPem, []byte("device"), []byte("user"))
+	asserts.NoError(err)
+	asserts.Equal(EnvelopeHybrid, envelope.Version)
+	asserts.Len(cipherTexts, 2)
+
+	// 使用私钥解开 AES 密钥后可还原各明文
+	wrapped, _ := base64.StdEncoding.DecodeString(envelope.Key)
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, wrapped, nil)
+	asserts.NoError(err)
+	asserts.Len(key, EnvelopeKeySize)
+	aead, err := NewAEAD(key)
+	asserts.NoError(err)
+	for i, expected := range []string{"device", "user"} {
+		raw, _ := base64.StdEncoding.DecodeString(cipherTexts[i])
+		nonce, sealed := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+		plainText, err := aead.Open(nil, nonce, sealed, nil)
+		asserts.NoError(err)
+		asserts.Equal(expected, string(plainText))
+	}
+
+	_, _, err = SealEnvelope("bad key")
+	asserts.Equal(ErrInvalidPublicKey, err)
+
+	// 携带公钥对应的密钥ID
+	asserts.Empty(envelope.Kid)
+	envelope, _, err = SealEnvelopeWithKid("2024", publicPem, []byte("device"))
+	asserts.NoError(err)
+	asserts.Equal("2024", envelope.Kid)
+}
@@ -0,0 +1,53 @@
+// Package licproto 授权服务与客户端共用的协议定义及公钥操作，仅依赖标准库，
+// 供客户端 SDK 引用而不引入服务端配置及签名密钥
+package licproto
+
+// DefaultKeyID 未指定签名密钥时使用的密钥ID
+const DefaultKeyID = "default"
+
+// DateFormat 授权有效期的日期格式
+const DateFormat = "20060102"
+
+// 授权状态，与 models.Status 取值一致
+const (
+	// StatusActive 正常
+	StatusActive = 0
+	// StatusPending 待审核
+	StatusPending = 1
+	// StatusExpired 已过期
+	StatusExpired = 2
+	// StatusTrial 试用
+	StatusTrial = 3
+	// StatusSuspended 已暂停
+	StatusSuspended = 4
+	// StatusRevoked 已吊销
+	StatusRevoked = 5
+)
+
+// 服务端返回的业务代码
+const (
+	// CodeOK 成功
+	CodeOK = 200
+	// CodeLicenseLeaseHeld 授权租约被其他实例占用
+	CodeLicenseLeaseHeld = 40010
+	// CodeLicenseLeaseInvalid 授权租约或席位无效或已过期
+	CodeLicenseLeaseInvalid = 40011
+	// CodeLicenseFingerprintMismatch 硬件指纹不匹配
+	CodeLicenseFingerprintMismatch = 40012
+	// CodeRequestReplayed 重复的请求
+	CodeRequestReplayed = 40013
+	// CodeUnsupportedEnvelope 不支持的加密信封版本
+	CodeUnsupportedEnvelope = 40014
+	// CodeDecryptFailed 客户端信息解密失败
+	CodeDecryptFailed = 40015
+	// CodeLicenseTransferDenied 授权迁移被拒绝
+	CodeLicenseTransferDenied = 40016
+	// CodeLicenseSeatsInUse 浮动授权席位已全部占用
+	CodeLicenseSeatsInUse = 40017
+	// CodeLicenseUsageCapExceeded 授权本月用量超出上限
+	CodeLicenseUsageCapExceeded = 40018
+	// CodeActivationDenied 激活码兑换被拒绝
+	CodeActivationDenied = 40019
+	// CodeLicenseSeatRequired 浮动授权未签出席位
+	CodeLicenseSeatRequired = 40020
+)
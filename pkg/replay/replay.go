@@ -0,0 +1,56 @@
+package replay
+
+import (
+	"github.com/zhouqiaokeji/server/pkg/cache"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"time"
+)
+
+const cachePrefix = "replay_nonce:"
+
+var (
+	// ErrMissing 请求缺少时间戳或随机数
+	ErrMissing = serializer.NewError(serializer.CodeParamErr, "请求缺少时间戳或随机数", nil)
+	// ErrSkewed 请求时间戳超出允许的时间偏差
+	ErrSkewed = serializer.NewError(serializer.CodeSignExpired, "请求时间戳超出允许范围，请校准客户端时间", nil)
+	// ErrReplayed 随机数已被使用
+	ErrReplayed = serializer.NewError(serializer.CodeRequestReplayed, "重复的请求", nil)
+)
+
+// Guard 加密信封中携带的防重放字段，Timestamp 为客户端 Unix 时间戳（秒）
+type Guard struct {
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+}
+
+// Check 校验请求时间戳是否在允许的偏差范围内，并在 scope 范围内记录随机数，
+// 同一随机数在时间窗口内只能使用一次。窗口配置为 0 时不做校验，
+// 开启旧版兼容时未携带时间戳和随机数的请求也不做校验
+func (g *Guard) Check(scope string) error {
+	window := int64(conf.LicenseConfig.ReplayWindow)
+	if window <= 0 {
+		return nil
+	}
+	if g.Timestamp == 0 && g.Nonce == "" && conf.LicenseConfig.ReplayLegacy {
+		return nil
+	}
+	if g.Timestamp == 0 || g.Nonce == "" {
+		return ErrMissing
+	}
+
+	skew := time.Now().Unix() - g.Timestamp
+	if skew > window || skew < -window {
+		return ErrSkewed
+	}
+
+	// 时间戳在窗口内的请求最多在 2 倍窗口时间内有效，随机数至少保留同样时长
+	ok, err := cache.SetNX(cachePrefix+scope+":"+g.Nonce, g.Timestamp, int(window*2))
+	if err != nil {
+		return serializer.NewError(serializer.CodeCacheOperation, "随机数记录失败", err)
+	}
+	if !ok {
+		return ErrReplayed
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package replay
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"testing"
+	"time"
+)
+
+func TestGuard_Check(t *testing.T) {
+	asserts := assert.New(t)
+	conf.LicenseConfig.ReplayWindow = 300
+	conf.LicenseConfig.ReplayLegacy = false
+
+	// 正常请求
+	guard := &Guard{Timestamp: time.Now().Unix(), Nonce: "nonce1"}
+	asserts.NoError(guard.Check("license"))
+
+	// 重放请求
+	asserts.Equal(ErrReplayed, guard.Check("license"))
+
+	// 不同作用域互不影响
+	asserts.NoError(guard.Check("app"))
+
+	// 缺少随机数
+	asserts.Equal(ErrMissing, (&Guard{Timestamp: time.Now().Unix()}).Check("license"))
+	asserts.Equal(ErrMissing, (&Guard{}).Check("license"))
+
+	// 兼容旧版客户端时，只放行完全未携带时间戳和随机数的请求
+	conf.LicenseConfig.ReplayLegacy = true
+	asserts.NoError((&Guard{}).Check("license"))
+	asserts.Equal(ErrMissing, (&Guard{Timestamp: time.Now().Unix()}).Check("license"))
+	conf.LicenseConfig.ReplayLegacy = false
+
+	// 时间戳超出范围
+	asserts.Equal(ErrSkewed, (&Guard{Timestamp: time.Now().Unix() - 301, Nonce: "nonce2"}).Check("license"))
+	asserts.Equal(ErrSkewed, (&Guard{Timestamp: time.Now().Unix() + 301, Nonce: "nonce3"}).Check("license"))
+
+	// 关闭校验
+	conf.LicenseConfig.ReplayWindow = 0
+	asserts.NoError((&Guard{}).Check("license"))
+}
@@ -0,0 +1,101 @@
+package rsa
+
+import (
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"github.com/zhouqiaokeji/server/pkg/licproto"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+)
+
+const (
+	// EnvelopeLegacy 旧版信封，见 licproto.EnvelopeLegacy
+	EnvelopeLegacy = licproto.EnvelopeLegacy
+	// EnvelopeHybrid 混合加密信封，见 licproto.EnvelopeHybrid
+	EnvelopeHybrid = licproto.EnvelopeHybrid
+)
+
+var (
+	ErrUnsupportedEnvelope = serializer.NewError(serializer.CodeUnsupportedEnvelope, "不支持的加密信封版本", nil)
+	ErrUnknownKey          = serializer.NewError(serializer.CodeDecryptFailed, "加密密钥不存在或已退役", nil)
+	ErrMalformedCipher     = serializer.NewError(serializer.CodeDecryptFailed, "密文格式错误", nil)
+	ErrKeyUnwrapFailed     = serializer.NewError(serializer.CodeDecryptFailed, "信封密钥解密失败", nil)
+	ErrCipherAuthFailed    = serializer.NewError(serializer.CodeDecryptFailed, "密文校验失败", nil)
+	ErrCipherDecryptFailed = serializer.NewError(serializer.CodeDecryptFailed, "密文解密失败", nil)
+)
+
+// Envelope 客户端加密信封，Key 为使用公钥加密后的 AES 密钥（仅混合加密信封使用），
+// Kid 为加密所用公钥的密钥ID，为空时兼容旧版客户端依次尝试密钥环中的密钥
+type Envelope struct {
+	Version int    `json:"version"`
+	Key     string `json:"ek,omitempty"`
+	Kid     string `json:"kid,omitempty"`
+
+	aead cipher.AEAD
+}
+
+// Open 按信封版本解密密文，版本为空时按旧版信封处理
+func (e *Envelope) Open(cipherText string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return nil, ErrMalformedCipher
+	}
+	switch e.Version {
+	case 0, EnvelopeLegacy:
+		plainText, err := Ring.Decrypt(e.Kid, raw)
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, ErrUnknownKey
+		} else if err != nil {
+			return nil, ErrCipherDecryptFailed
+		}
+		return plainText, nil
+	case EnvelopeHybrid:
+		aead, err := e.unwrap()
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) < aead.NonceSize() {
+			return nil, ErrMalformedCipher
+		}
+		plainText, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+		if err != nil {
+			return nil, ErrCipherAuthFailed
+		}
+		return plainText, nil
+	}
+	return nil, ErrUnsupportedEnvelope
+}
+
+// unwrap 使用密钥环解密 AES 密钥，同一信封只解密一次
+func (e *Envelope) unwrap() (cipher.AEAD, error) {
+	if e.aead != nil {
+		return e.aead, nil
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(e.Key)
+	if err != nil || len(wrapped) == 0 {
+		return nil, ErrMalformedCipher
+	}
+	key, err := Ring.DecryptOAEP(e.Kid, wrapped)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrUnknownKey
+	} else if err != nil || len(key) != licproto.EnvelopeKeySize {
+		return nil, ErrKeyUnwrapFailed
+	}
+	e.aead, err = licproto.NewAEAD(key)
+	return e.aead, err
+}
+
+// SealEnvelope 供客户端使用，生成随机 AES 密钥并使用公钥加密，
+// 返回混合加密信封及各明文对应的密文
+func SealEnvelope(publicPem string, plainTexts ...[]byte) (*Envelope, []string, error) {
+	return SealEnvelopeWithKid("", publicPem, plainTexts...)
+}
+
+// SealEnvelopeWithKid 与 SealEnvelope 相同，信封同时携带公钥对应的密钥ID
+func SealEnvelopeWithKid(kid, publicPem string, plainTexts ...[]byte) (*Envelope, []string, error) {
+	sealed, cipherTexts, err := licproto.SealEnvelopeWithKid(kid, publicPem, plainTexts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Envelope{Version: sealed.Version, Key: sealed.Key, Kid: sealed.Kid}, cipherTexts, nil
+}
@@ -0,0 +1,73 @@
+package rsa
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestEnvelope_Open(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 混合加密信封，支持超过单个 RSA 块长度的明文
+	{
+		large := []byte(strings.Repeat("device", 200))
+		envelope, cipherTexts, err := SealEnvelope(testPublicPem, large, []byte("user"))
+		asserts.NoError(err)
+		asserts.Len(cipherTexts, 2)
+
+		opened := &Envelope{Version: envelope.Version, Key: envelope.Key}
+		plainText, err := opened.Open(cipherTexts[0])
+		asserts.NoError(err)
+		asserts.Equal(large, plainText)
+		plainText, err = opened.Open(cipherTexts[1])
+		asserts.NoError(err)
+		asserts.Equal([]byte("user"), plainText)
+
+		// 密文被篡改
+		raw, _ := base64.StdEncoding.DecodeString(cipherTexts[1])
+		raw[len(raw)-1] ^= 0xff
+		_, err = opened.Open(base64.StdEncoding.EncodeToString(raw))
+		asserts.Equal(ErrCipherAuthFailed, err)
+
+		// 信封密钥错误
+		_, err = (&Envelope{Version: EnvelopeHybrid, Key: base64.StdEncoding.EncodeToString([]byte("key"))}).Open(cipherTexts[0])
+		asserts.Equal(ErrKeyUnwrapFailed, err)
+	}
+
+	// 携带密钥ID的信封仅使用该密钥解密
+	{
+		envelope, cipherTexts, err := SealEnvelopeWithKid(DefaultKeyID, testPublicPem, []byte("device"))
+		asserts.NoError(err)
+		asserts.Equal(DefaultKeyID, envelope.Kid)
+		plainText, err := (&Envelope{Version: envelope.Version, Key: envelope.Key, Kid: envelope.Kid}).Open(cipherTexts[0])
+		asserts.NoError(err)
+		asserts.Equal([]byte("device"), plainText)
+
+		_, err = (&Envelope{Version: envelope.Version, Key: envelope.Key, Kid: "unknown"}).Open(cipherTexts[0])
+		asserts.Equal(ErrUnknownKey, err)
+		cipherText := base64.StdEncoding.EncodeToString(EncryptRSA([]byte("legacy"), testPublicPem))
+		_, err = (&Envelope{Version: EnvelopeLegacy, Kid: "unknown"}).Open(cipherText)
+		asserts.Equal(ErrUnknownKey, err)
+	}
+
+	// 旧版信封
+	{
+		cipherText := base64.StdEncoding.EncodeToString(EncryptRSA([]byte("legacy"), testPublicPem))
+		plainText, err := (&Envelope{}).Open(cipherText)
+		asserts.NoError(err)
+		asserts.Equal([]byte("legacy"), plainText)
+
+		_, err = (&Envelope{Version: EnvelopeLegacy}).Open(base64.StdEncoding.EncodeToString([]byte("bad")))
+		asserts.Equal(ErrCipherDecryptFailed, err)
+	}
+
+	// 格式错误
+	{
+		_, err := (&Envelope{}).Open("not base64!")
+		asserts.Equal(ErrMalformedCipher, err)
+		_, err = (&Envelope{Version: 99}).Open("")
+		asserts.Equal(ErrUnsupportedEnvelope, err)
+	}
+}
@@ -0,0 +1,300 @@
+package rsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/licproto"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultKeyID 未指定签名密钥时使用的密钥ID，首次启动时以此ID生成密钥
+	DefaultKeyID = licproto.DefaultKeyID
+	// defaultKeyBits 首次启动时生成的密钥长度
+	defaultKeyBits = 2048
+	privateKeyExt  = ".pem"
+	publicKeyExt   = ".pub"
+)
+
+var (
+	ErrKeyNotFound   = errors.New("密钥不存在")
+	ErrNoSigningKey  = errors.New("未指定签名密钥")
+	ErrDecryptFailed = errors.New("密文无法使用密钥环中的任何密钥解密")
+)
+
+// Ring 全局密钥环，Init 之前为空，无法签名
+var Ring = NewKeyRing()
+
+// Key 密钥环中的单个密钥
+type Key struct {
+	ID         string
+	PrivateKey *rsa.PrivateKey
+}
+
+// PublicKey 公钥信息，字段兼容 JWKS 格式，并附带 PEM 格式公钥
+type PublicKey struct {
+	Kty     string `json:"kty"`
+	Kid     string `json:"kid"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Pem     string `json:"pem"`
+	Signing bool   `json:"signing"`
+}
+
+// KeyRing 密钥环，可同时持有多个密钥用于验签和解密，其中一个用于签名
+type KeyRing struct {
+	mu      sync.RWMutex
+	keys    []*Key
+	signing *Key
+}
+
+// NewKeyRing 新建空密钥环
+func NewKeyRing() *KeyRing {
+	return &KeyRing{}
+}
+
+// Init 根据配置加载全局密钥环，未配置目录时终止启动；
+// 目录中没有任何私钥时视为首次启动，生成签名密钥
+func Init() {
+	dir := conf.KeyRingConfig.Dir
+	if dir == "" {
+		util.Log().Panic("未配置密钥环目录 [KeyRing] Dir")
+	}
+	signing := conf.KeyRingConfig.Signing
+	if signing == "" {
+		signing = DefaultKeyID
+	}
+	files, _ := filepath.Glob(filepath.Join(util.RelativePath(dir), "*"+privateKeyExt))
+	if len(files) == 0 {
+		if err := GenerateRSAKey(defaultKeyBits, util.RelativePath(dir), signing); err != nil {
+			util.Log().Panic("签名密钥生成失败, %s", err)
+		}
+		util.Log().Warning("密钥环目录 %s 中没有密钥，已生成签名密钥 %s，请将公钥 %s%s 分发给客户端", dir, signing, signing, publicKeyExt)
+	}
+	ring, err := LoadKeyRing(dir, signing, conf.KeyRingConfig.Retired)
+	if err != nil {
+		util.Log().Panic("密钥环加载失败, %s", err)
+	}
+	Ring = ring
+	util.Log().Info("密钥环加载完成，当前签名密钥：%s", signing)
+}
+
+// LoadKeyRing 从目录加载所有 <kid>.pem 私钥，跳过已退役的密钥，并指定签名密钥
+func LoadKeyRing(dir, signing string, retired []string) (*KeyRing, error) {
+	files, err := filepath.Glob(filepath.Join(util.RelativePath(dir), "*"+privateKeyExt))
+	if err != nil {
+		return nil, err
+	}
+	ring := NewKeyRing()
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), privateKeyExt)
+		if util.ContainsString(retired, kid) {
+			continue
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err = ring.Add(kid, content); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	if err = ring.SetSigning(signing); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Add 添加 PEM 格式私钥
+func (ring *KeyRing) Add(kid string, pemBytes []byte) error {
+	//pem解码
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return errors.New("invalid private key")
+	}
+	//X509解码
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	for i, key := range ring.keys {
+		if key.ID == kid {
+			ring.keys[i] = &Key{ID: kid, PrivateKey: privateKey}
+			return nil
+		}
+	}
+	ring.keys = append(ring.keys, &Key{ID: kid, PrivateKey: privateKey})
+	return nil
+}
+
+// Generate 生成指定长度的私钥并加入密钥环，不写入文件
+func (ring *KeyRing) Generate(kid string, bits int) error {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return err
+	}
+	return ring.Add(kid, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+}
+
+// SetSigning 指定签名密钥
+func (ring *KeyRing) SetSigning(kid string) error {
+	if kid == "" {
+		return ErrNoSigningKey
+	}
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	for _, key := range ring.keys {
+		if key.ID == kid {
+			ring.signing = key
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+}
+
+// Retire 退役密钥，退役后使用该密钥签名的数据将无法验签，签名密钥不可退役
+func (ring *KeyRing) Retire(kid string) error {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if ring.signing != nil && ring.signing.ID == kid {
+		return errors.New("不能退役当前签名密钥")
+	}
+	for i, key := range ring.keys {
+		if key.ID == kid {
+			ring.keys = append(ring.keys[:i], ring.keys[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+}
+
+// Sign 使用签名密钥加签，返回密钥ID与签名
+func (ring *KeyRing) Sign(plainText []byte) (string, []byte, error) {
+	ring.mu.RLock()
+	key := ring.signing
+	ring.mu.RUnlock()
+	if key == nil {
+		return "", nil, ErrNoSigningKey
+	}
+	hashed := sha256.Sum256(plainText)
+	signText, err := rsa.SignPKCS1v15(rand.Reader, key.PrivateKey, crypto.SHA256, hashed[:])
+	return key.ID, signText, err
+}
+
+// Verify 使用指定密钥验签
+func (ring *KeyRing) Verify(kid string, plainText, signText []byte) error {
+	key := ring.Key(kid)
+	if key == nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	hashed := sha256.Sum256(plainText)
+	return rsa.VerifyPKCS1v15(&key.PrivateKey.PublicKey, crypto.SHA256, hashed[:], signText)
+}
+
+// Decrypt 使用指定密钥解密客户端使用公钥加密的数据；
+// kid 为空时兼容未携带密钥ID的旧版客户端，优先尝试签名密钥，再依次尝试其他密钥
+func (ring *KeyRing) Decrypt(kid string, cipherText []byte) ([]byte, error) {
+	return ring.decrypt(kid, func(key *Key) ([]byte, error) {
+		return rsa.DecryptPKCS1v15(rand.Reader, key.PrivateKey, cipherText)
+	})
+}
+
+// DecryptOAEP 解密客户端使用 RSA-OAEP(SHA-256) 加密的数据，密钥选择与 Decrypt 一致
+func (ring *KeyRing) DecryptOAEP(kid string, cipherText []byte) ([]byte, error) {
+	return ring.decrypt(kid, func(key *Key) ([]byte, error) {
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, key.PrivateKey, cipherText, nil)
+	})
+}
+
+func (ring *KeyRing) decrypt(kid string, decrypt func(key *Key) ([]byte, error)) ([]byte, error) {
+	keys := ring.ordered()
+	if kid != "" {
+		key := ring.Key(kid)
+		if key == nil {
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+		}
+		keys = []*Key{key}
+	}
+	for _, key := range keys {
+		if plainText, err := decrypt(key); err == nil {
+			return plainText, nil
+		}
+	}
+	return nil, ErrDecryptFailed
+}
+
+// Key 获取指定ID的密钥
+func (ring *KeyRing) Key(kid string) *Key {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	for _, key := range ring.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// PublicKeys 返回所有可用于验签的公钥
+func (ring *KeyRing) PublicKeys() []PublicKey {
+	keys := ring.ordered()
+	res := make([]PublicKey, 0, len(keys))
+	for _, key := range keys {
+		publicKey := &key.PrivateKey.PublicKey
+		X509PublicKey, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			continue
+		}
+		res = append(res, PublicKey{
+			Kty:     "RSA",
+			Kid:     key.ID,
+			Use:     "sig",
+			Alg:     "RS256",
+			N:       base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			Pem:     string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: X509PublicKey})),
+			Signing: ring.isSigning(key),
+		})
+	}
+	return res
+}
+
+// ordered 返回签名密钥在前的密钥列表
+func (ring *KeyRing) ordered() []*Key {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	res := make([]*Key, 0, len(ring.keys))
+	if ring.signing != nil {
+		res = append(res, ring.signing)
+	}
+	for _, key := range ring.keys {
+		if key != ring.signing {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+func (ring *KeyRing) isSigning(key *Key) bool {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	return ring.signing == key
+}
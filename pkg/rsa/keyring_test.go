@@ -0,0 +1,138 @@
+package rsa
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeyRing(t *testing.T) {
+	asserts := assert.New(t)
+	dir := t.TempDir()
+	asserts.NoError(GenerateRSAKey(1024, dir, "old"))
+	asserts.NoError(GenerateRSAKey(1024, dir, "new"))
+
+	// 正常加载
+	{
+		ring, err := LoadKeyRing(dir, "new", nil)
+		asserts.NoError(err)
+		asserts.NotNil(ring.Key("old"))
+		asserts.NotNil(ring.Key("new"))
+		keys := ring.PublicKeys()
+		asserts.Len(keys, 2)
+		asserts.Equal("new", keys[0].Kid)
+		asserts.True(keys[0].Signing)
+		asserts.False(keys[1].Signing)
+	}
+
+	// 退役密钥不会被加载
+	{
+		ring, err := LoadKeyRing(dir, "new", []string{"old"})
+		asserts.NoError(err)
+		asserts.Nil(ring.Key("old"))
+	}
+
+	// 签名密钥不存在
+	{
+		_, err := LoadKeyRing(dir, "missing", nil)
+		asserts.ErrorIs(err, ErrKeyNotFound)
+	}
+
+	// 未指定签名密钥
+	{
+		_, err := LoadKeyRing(dir, "", nil)
+		asserts.ErrorIs(err, ErrNoSigningKey)
+	}
+}
+
+func TestKeyRing_Rotate(t *testing.T) {
+	asserts := assert.New(t)
+	dir := t.TempDir()
+	asserts.NoError(GenerateRSAKey(1024, dir, "old"))
+	asserts.NoError(GenerateRSAKey(1024, dir, "new"))
+	ring, err := LoadKeyRing(dir, "old", nil)
+	asserts.NoError(err)
+
+	data := []byte("license")
+	kid, signText, err := ring.Sign(data)
+	asserts.NoError(err)
+	asserts.Equal("old", kid)
+
+	oldPublic, _ := ioutil.ReadFile(filepath.Join(dir, "old.pub"))
+	cipherText := EncryptRSA(data, string(oldPublic))
+
+	// 轮换后旧密钥签名仍可验签，旧公钥加密的数据仍可解密
+	asserts.NoError(ring.SetSigning("new"))
+	kid, _, err = ring.Sign(data)
+	asserts.NoError(err)
+	asserts.Equal("new", kid)
+	asserts.NoError(ring.Verify("old", data, signText))
+	asserts.NoError(VerifyRSA(data, base64.StdEncoding.EncodeToString(signText), string(oldPublic)))
+	plainText, err := ring.Decrypt("", cipherText)
+	asserts.NoError(err)
+	asserts.Equal(data, plainText)
+
+	// 携带密钥ID时仅使用该密钥解密
+	plainText, err = ring.Decrypt("old", cipherText)
+	asserts.NoError(err)
+	asserts.Equal(data, plainText)
+	_, err = ring.Decrypt("new", cipherText)
+	asserts.Equal(ErrDecryptFailed, err)
+	_, err = ring.Decrypt("unknown", cipherText)
+	asserts.ErrorIs(err, ErrKeyNotFound)
+
+	// 签名密钥不可退役
+	asserts.Error(ring.Retire("new"))
+
+	// 退役后旧密钥不可再用于验签和解密
+	asserts.NoError(ring.Retire("old"))
+	asserts.ErrorIs(ring.Verify("old", data, signText), ErrKeyNotFound)
+	_, err = ring.Decrypt("", cipherText)
+	asserts.Equal(ErrDecryptFailed, err)
+	_, err = ring.Decrypt("old", cipherText)
+	asserts.ErrorIs(err, ErrKeyNotFound)
+}
+
+func TestSignRSAWithKid(t *testing.T) {
+	asserts := assert.New(t)
+	data := []byte("license")
+	sign, kid := SignRSAWithKid(data)
+	asserts.Equal(DefaultKeyID, kid)
+	asserts.NoError(VerifyRSA(data, sign, testPublicPem))
+}
+
+func TestInit(t *testing.T) {
+	asserts := assert.New(t)
+	ring := Ring
+	defer func() {
+		Ring = ring
+		conf.KeyRingConfig.Dir = ""
+	}()
+
+	// 未配置密钥环目录时终止启动
+	conf.KeyRingConfig.Dir = ""
+	asserts.Panics(Init)
+
+	// 首次启动时生成签名密钥
+	dir := t.TempDir()
+	conf.KeyRingConfig.Dir = dir
+	asserts.NotPanics(Init)
+	asserts.FileExists(filepath.Join(dir, DefaultKeyID+privateKeyExt))
+	asserts.FileExists(filepath.Join(dir, DefaultKeyID+publicKeyExt))
+	kid, _, err := Ring.Sign([]byte("license"))
+	asserts.NoError(err)
+	asserts.Equal(DefaultKeyID, kid)
+	generated := Ring.PublicKeys()[0].N
+
+	// 再次启动时使用已生成的密钥
+	asserts.NotPanics(Init)
+	asserts.Equal(generated, Ring.PublicKeys()[0].N)
+
+	// 目录中已有密钥时不会生成指定的签名密钥
+	conf.KeyRingConfig.Signing = "missing"
+	defer func() { conf.KeyRingConfig.Signing = "" }()
+	asserts.Panics(Init)
+}
@@ -3,12 +3,22 @@ package rsa
 import (
 	"encoding/base64"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestGenerateRSAKey(t *testing.T) {
 	//生成密钥对，保存到文件
-	GenerateRSAKey(2048)
+	dir := t.TempDir()
+	if err := GenerateRSAKey(2048, dir, "test"); err != nil {
+		t.Fatalf("生成密钥失败：%s", err)
+	}
+	for _, name := range []string{"test.pem", "test.pub"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("密钥文件不存在：%s", name)
+		}
+	}
 }
 
 func TestEncryptRSA(t *testing.T) {
@@ -23,3 +33,25 @@ func TestDecryptRSA(t *testing.T) {
 	plainText := DecryptRSA(message)
 	fmt.Println("解密后为：", string(plainText))
 }
+
+const testPublicPem = "-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA12xyGxqk340BIJpmO7+U\n2UXy4hLh0z2otvDDHCIL9+khD69J6iBZ2rZDZmKNIGuYk7jVWdinvHWMx1/egHXi\nS9YNreP094PcxoQMGlpaxx8PVRbQRwlfgiFYv4V/BUkbZbp2ImedYpT1TXPMYOf7\nehHThjCJxRG5By1X9oZP8BUSB41L6kcG9CPDs/kOu0cm3TH9lL90MjQzhGjWxtWx\ngURMSxuY0g844oKy6lu1snES/XkAW8Ew52hg6013g9WYqEZbamI+5ybci7ZcjVmQ\nEBW5K5GzP7kkg5eWI8zue+iD04ts+GLOvrigXwUZTN/gBbP2t8CV/TXxaEz1ycP7\nNQIDAQAB\n-----END PUBLIC KEY-----"
+
+func TestVerifyRSA(t *testing.T) {
+	data := []byte(`{"name":"test"}`)
+	sign := SignRSA(data)
+
+	// 正常验签
+	if err := VerifyRSA(data, sign, testPublicPem); err != nil {
+		t.Fatalf("验签失败：%s", err)
+	}
+
+	// 数据被篡改
+	if err := VerifyRSA([]byte(`{"name":"fake"}`), sign, testPublicPem); err == nil {
+		t.Fatal("篡改数据不应通过验签")
+	}
+
+	// 公钥格式错误
+	if err := VerifyRSA(data, sign, "invalid"); err == nil {
+		t.Fatal("非法公钥不应通过验签")
+	}
+}
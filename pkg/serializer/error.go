@@ -3,6 +3,7 @@ package serializer
 import (
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/zhouqiaokeji/server/pkg/licproto"
 )
 
 // AppError 应用错误，实现了error接口
@@ -72,6 +73,28 @@ const (
 	CodeAdminRequired = 40008
 	// CodeMasterNotFound 主机节点未注册
 	CodeMasterNotFound = 40009
+	// CodeLicenseLeaseHeld 授权租约被其他实例占用
+	CodeLicenseLeaseHeld = licproto.CodeLicenseLeaseHeld
+	// CodeLicenseLeaseInvalid 授权租约无效或已过期
+	CodeLicenseLeaseInvalid = licproto.CodeLicenseLeaseInvalid
+	// CodeLicenseFingerprintMismatch 硬件指纹不匹配
+	CodeLicenseFingerprintMismatch = licproto.CodeLicenseFingerprintMismatch
+	// CodeRequestReplayed 重复的请求
+	CodeRequestReplayed = licproto.CodeRequestReplayed
+	// CodeUnsupportedEnvelope 不支持的加密信封版本
+	CodeUnsupportedEnvelope = licproto.CodeUnsupportedEnvelope
+	// CodeDecryptFailed 客户端信息解密失败
+	CodeDecryptFailed = licproto.CodeDecryptFailed
+	// CodeLicenseTransferDenied 授权迁移被拒绝
+	CodeLicenseTransferDenied = licproto.CodeLicenseTransferDenied
+	// CodeLicenseSeatsInUse 浮动授权席位已全部占用
+	CodeLicenseSeatsInUse = licproto.CodeLicenseSeatsInUse
+	// CodeLicenseUsageCapExceeded 授权本月用量超出上限
+	CodeLicenseUsageCapExceeded = licproto.CodeLicenseUsageCapExceeded
+	// CodeActivationDenied 激活码兑换被拒绝
+	CodeActivationDenied = licproto.CodeActivationDenied
+	// CodeLicenseSeatRequired 浮动授权未签出席位
+	CodeLicenseSeatRequired = licproto.CodeLicenseSeatRequired
 	// CodeDBError 数据库操作失败
 	CodeDBError = 50001
 	// CodeEncryptError 加密失败
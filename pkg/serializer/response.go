@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/gob"
+	"github.com/zhouqiaokeji/server/pkg/licproto"
 	"github.com/zhouqiaokeji/server/pkg/util"
 )
 
-const OK = 200
+const OK = licproto.CodeOK
 
 // CheckLogin 检查登录
 func CheckLogin() Response {
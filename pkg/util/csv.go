@@ -0,0 +1,23 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CSVCell 将字段值转换为导出表格的单元格。文本以公式字符开头时添加单引号前缀，
+// 避免在 Excel 等表格软件中打开时被当作公式执行；数值不做处理
+func CSVCell(value interface{}) string {
+	text, ok := value.(string)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	if text == "" || !strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return text
+	}
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return text
+	}
+	return "'" + text
+}
@@ -0,0 +1,25 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCSVCell(t *testing.T) {
+	asserts := assert.New(t)
+
+	asserts.Equal("device", CSVCell("device"))
+	asserts.Equal("", CSVCell(""))
+	// 以公式字符开头的文本
+	asserts.Equal("'=HYPERLINK(\"http://evil\")", CSVCell("=HYPERLINK(\"http://evil\")"))
+	asserts.Equal("'+cmd", CSVCell("+cmd"))
+	asserts.Equal("'-2+3", CSVCell("-2+3"))
+	asserts.Equal("'@SUM(A1)", CSVCell("@SUM(A1)"))
+	asserts.Equal("'\tvalue", CSVCell("\tvalue"))
+	asserts.Equal("'\rvalue", CSVCell("\rvalue"))
+	// 数值不做处理
+	asserts.Equal("-12", CSVCell("-12"))
+	asserts.Equal("+1.5", CSVCell("+1.5"))
+	asserts.Equal("-73.5", CSVCell(float32(-73.5)))
+	asserts.Equal("42", CSVCell(42))
+}
@@ -0,0 +1,164 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSheet 文件中没有工作表
+var ErrNoSheet = errors.New("xlsx: 文件中没有工作表")
+
+type sharedStrings struct {
+	Items []richText `xml:"si"`
+}
+
+type richText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t richText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	b.WriteString(t.Text)
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type workbookXML struct {
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		Ref   int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline richText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadAll 读取第一个工作表的全部行，单元格统一按文本返回，缺失的单元格以空字符串补齐
+func ReadAll(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var shared sharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err = decode(f, &shared); err != nil {
+			return nil, err
+		}
+	}
+	f, ok := files[firstSheet(files)]
+	if !ok {
+		return nil, ErrNoSheet
+	}
+	var sheet worksheet
+	if err = decode(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		// 补齐跳过的空行
+		for row.Ref > len(rows)+1 {
+			rows = append(rows, []string{})
+		}
+		values := make([]string, 0, len(row.Cells))
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col = columnIndex(cell.Ref)
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, errors.New("xlsx: 共享字符串索引无效")
+				}
+				value = shared.Items[index].String()
+			case "inlineStr":
+				value = cell.Inline.String()
+			}
+			values = append(values, value)
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// firstSheet 根据工作簿关系查找第一个工作表的路径
+func firstSheet(files map[string]*zip.File) string {
+	var (
+		book workbookXML
+		rels relationships
+	)
+	if f, ok := files["xl/workbook.xml"]; ok && decode(f, &book) == nil && len(book.Sheets) > 0 {
+		if f, ok := files["xl/_rels/workbook.xml.rels"]; ok && decode(f, &rels) == nil {
+			for _, rel := range rels.Items {
+				if rel.ID != book.Sheets[0].ID {
+					continue
+				}
+				if strings.HasPrefix(rel.Target, "/") {
+					return strings.TrimPrefix(rel.Target, "/")
+				}
+				return path.Join("xl", rel.Target)
+			}
+		}
+	}
+	return "xl/worksheets/sheet1.xml"
+}
+
+func decode(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// columnIndex 将 A1 形式的单元格引用转换为从 0 开始的列序号
+func columnIndex(ref string) int {
+	index := 0
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		index = index*26 + int(c-'A') + 1
+	}
+	return index - 1
+}
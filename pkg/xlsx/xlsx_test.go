@@ -0,0 +1,71 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func TestColumnName(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal("A", ColumnName(0))
+	asserts.Equal("Z", ColumnName(25))
+	asserts.Equal("AA", ColumnName(26))
+	asserts.Equal("AZ", ColumnName(51))
+	asserts.Equal("BA", ColumnName(52))
+	for i := 0; i < 1000; i++ {
+		asserts.Equal(i, columnIndex(ColumnName(i)+"12"))
+	}
+}
+
+func TestWriteAndReadAll(t *testing.T) {
+	asserts := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf)
+	asserts.NoError(err)
+	asserts.NoError(w.Write([]string{"container_id", "name"}))
+	asserts.NoError(w.Write([]string{"c1", "<客户 & 1>"}))
+	asserts.NoError(w.Write([]string{"c2", "", "x"}))
+	asserts.NoError(w.Close())
+
+	rows, err := ReadAll(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	asserts.NoError(err)
+	asserts.Equal([][]string{
+		{"container_id", "name"},
+		{"c1", "<客户 & 1>"},
+		{"c2", "", "x"},
+	}, rows)
+}
+
+func TestReadAll_SharedStrings(t *testing.T) {
+	asserts := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	parts := map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="S" sheetId="1" r:id="rId7"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId7" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>id</t></si><si><r><t>a</t></r><r><t>b</t></r></si></sst>`,
+		"xl/worksheets/data.xml":     `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData><row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1"><v>20240101</v></c></row><row r="3"><c r="B3" t="s"><v>1</v></c></row></sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		f, _ := zw.Create(name)
+		_, _ = io.WriteString(f, content)
+	}
+	asserts.NoError(zw.Close())
+
+	rows, err := ReadAll(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	asserts.NoError(err)
+	asserts.Equal([][]string{
+		{"id", "", "20240101"},
+		{},
+		{"", "ab"},
+	}, rows)
+
+	// 非 zip 文件
+	_, err = ReadAll(bytes.NewReader([]byte("a,b")), 3)
+	asserts.Error(err)
+}
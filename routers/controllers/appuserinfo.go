@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
 	"github.com/zhouqiaokeji/server/pkg/util"
 	"github.com/zhouqiaokeji/server/service/appuseinfo"
 	"strconv"
@@ -19,9 +21,22 @@ func CreateAppUseInfo(c *gin.Context) {
 	}
 }
 
+// CreateAppUseInfos 批量新增服务使用记录，请求体可使用 gzip 压缩
+func CreateAppUseInfos(c *gin.Context) {
+	var service appuseinfo.SignAppUseInfoBatch
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.CreateBatch(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 func GetAppInfos(c *gin.Context) {
 	type param struct {
 		ContainerId string   `json:"containerId"`
+		CustomerId  *uint64  `json:"customerId,string"`
+		Group       string   `json:"group"`
 		Time        []string `json:"time"`
 	}
 	var service appuseinfo.ServiceAppUseInfoDTO
@@ -39,7 +54,96 @@ func GetAppInfos(c *gin.Context) {
 			start, _ = time.ParseInLocation(util.FORMAT_DATETIME_y4Md, params.Time[0], loc)
 			end, _ = time.ParseInLocation(util.FORMAT_DATETIME_Y4MDHMS, params.Time[1]+" 23:59:59", loc)
 		}
-		res := service.GetAppInfos(params.ContainerId, page, limit, order, start, end)
+		res := service.GetAppInfos(params.ContainerId, params.CustomerId, params.Group == "customer", page, limit, order, start, end)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// GetAppActivity 统计活跃设备及终端用户
+func GetAppActivity(c *gin.Context) {
+	var service appuseinfo.ServiceActivityDTO
+	if err := c.ShouldBindQuery(&service); err == nil {
+		res := service.GetActivity()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// GetAppGeoPoints 查询范围内的服务上报位置
+func GetAppGeoPoints(c *gin.Context) {
+	var service appuseinfo.ServiceGeoDTO
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if err := c.ShouldBindQuery(&service); err == nil {
+		res := service.GetPoints(page, size)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// GetAppGeoClusters 按地图缩放级别聚合服务上报位置
+func GetAppGeoClusters(c *gin.Context) {
+	var service appuseinfo.ServiceGeoClusterDTO
+	if err := c.ShouldBindQuery(&service); err == nil {
+		res := service.GetClusters()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// ExportAppGeo 导出服务上报位置为 GeoJSON
+func ExportAppGeo(c *gin.Context) {
+	var service appuseinfo.ServiceGeoDTO
+	if err := c.ShouldBindQuery(&service); err != nil {
+		c.JSON(200, ErrorResponse(err))
+		return
+	}
+	filter, err := service.BoundedFilter()
+	if err != nil {
+		c.JSON(200, serializer.ParamErr(err.Error(), err))
+		return
+	}
+	filename := fmt.Sprintf("checkins-%s.geojson", time.Now().Format("20060102150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Header("Content-Type", "application/geo+json")
+	c.Status(200)
+	if err = service.Export(c.Writer, filter); err != nil {
+		util.Log().Warning("位置导出中断, %s", err)
+	}
+}
+
+// ExportAppUseInfos 流式导出服务使用记录为 CSV 或 NDJSON
+func ExportAppUseInfos(c *gin.Context) {
+	var service appuseinfo.ServiceExportDTO
+	if err := c.ShouldBindQuery(&service); err != nil {
+		c.JSON(200, ErrorResponse(err))
+		return
+	}
+	if err := service.Prepare(); err != nil {
+		c.JSON(200, serializer.ParamErr(err.Error(), err))
+		return
+	}
+	filename := fmt.Sprintf("checkins-%s.%s", time.Now().Format("20060102150405"), service.Format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Header("Content-Type", service.ContentType())
+	c.Status(200)
+	if err := service.Export(c.Writer, CurrentUser(c), util.GetIpAddr(c.Request)); err != nil {
+		util.Log().Warning("服务使用记录导出中断, %s", err)
+	}
+}
+
+// GetAppUseInfoExports 查询服务使用记录导出记录
+func GetAppUseInfoExports(c *gin.Context) {
+	var service appuseinfo.ServiceExportListDTO
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if err := c.ShouldBindQuery(&service); err == nil {
+		res := service.GetExports(page, size)
 		c.JSON(200, res)
 	} else {
 		c.JSON(200, ErrorResponse(err))
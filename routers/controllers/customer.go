@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"github.com/zhouqiaokeji/server/service/customer"
+	"strconv"
+)
+
+// GetCustomers 分页查询客户
+func GetCustomers(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("size", "20"))
+	res := customer.GetCustomers(page, limit, ctx.Query("keyword"))
+	ctx.JSON(200, res)
+}
+
+// GetCustomer 查询客户详情
+func GetCustomer(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Query("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	res := customer.GetCustomer(id)
+	ctx.JSON(200, res)
+}
+
+// CreateCustomer 新增客户
+func CreateCustomer(ctx *gin.Context) {
+	var service = &customer.ServiceCustomerDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Create()
+	ctx.JSON(200, res)
+}
+
+// UpdateCustomer 更新客户信息
+func UpdateCustomer(ctx *gin.Context) {
+	var service = &customer.ServiceCustomerDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Update()
+	ctx.JSON(200, res)
+}
+
+// RemoveCustomer 删除客户，客户名下仍有授权时不允许删除
+func RemoveCustomer(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Query("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	res := customer.Remove(id)
+	ctx.JSON(200, res)
+}
+
+// AssignCustomerLicenses 将授权归属到客户
+func AssignCustomerLicenses(ctx *gin.Context) {
+	var service = &customer.ServiceAssignDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Assign()
+	ctx.JSON(200, res)
+}
@@ -2,28 +2,33 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
 	"github.com/zhouqiaokeji/server/pkg/util"
 	"github.com/zhouqiaokeji/server/service/license"
 	"strconv"
+	"time"
 )
 
 func GetLicenses(ctx *gin.Context) {
-	var (
-		service license.ServiceLicenseDTO
-	)
+	var service = &license.ServiceLicenseListDTO{}
+	if err := ctx.ShouldBind(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
 	start, _ := strconv.Atoi(ctx.DefaultQuery("page", ctx.DefaultPostForm("page", "1")))
 	limit, _ := strconv.Atoi(ctx.DefaultQuery("size", ctx.DefaultPostForm("size", "20")))
-	order := ctx.Query("order")
-	res := service.GetLicense("", start, limit, order)
+	res := service.GetLicenses(start, limit)
 	ctx.JSON(200, res)
-
 }
+
 func CreateLicense(ctx *gin.Context) {
 	var service = &license.SignLicense{}
 	if err := ctx.BindJSON(service); err != nil {
 		util.Log().Error(err.Error())
 		ctx.JSON(200, ErrorResponse(err))
+		return
 	}
 	res := service.Create()
 	ctx.JSON(200, res)
@@ -33,26 +38,171 @@ func GetLicense(ctx *gin.Context) {
 	var service = &license.ServiceLicenseDTO{}
 	if id == "" {
 		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
 	}
-	res := service.Remove(id)
+	service.ContainerID = id
+	res := service.GetInfo()
 	ctx.JSON(200, res)
 }
 func ChangeStatus(ctx *gin.Context) {
+	var service = &license.ServiceLicenseStatusDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.UpdateLicenseStatus(CurrentUser(ctx))
+	ctx.JSON(200, res)
+}
+
+// GetLicenseState 查询授权状态及允许的后续操作
+func GetLicenseState(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	var service = &license.ServiceLicenseStatusDTO{ContainerID: id}
+	res := service.GetState()
+	ctx.JSON(200, res)
+}
+
+// GetLicenseHistories 查询授权状态变更历史
+func GetLicenseHistories(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("size", "20"))
+	var service = &license.ServiceLicenseStatusDTO{ContainerID: id}
+	res := service.GetHistories(page, limit)
+	ctx.JSON(200, res)
+}
+
+// GetExpiryEvents 查询授权到期事件，未指定 id 时查询全部
+func GetExpiryEvents(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("size", "20"))
+	var service = &license.ServiceExpiryEventDTO{ContainerID: ctx.Query("id")}
+	res := service.GetEvents(page, limit)
+	ctx.JSON(200, res)
+}
+
+// GetRevocations 增量拉取签名吊销列表
+func GetRevocations(ctx *gin.Context) {
+	var service = &license.ServiceRevocationDTO{}
+	if err := ctx.ShouldBindQuery(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.GetRevocations()
+	ctx.JSON(200, res)
+}
+
+// RenewLicense 授权续期
+func RenewLicense(ctx *gin.Context) {
+	var service = &license.ServiceRenewDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Renew(CurrentUser(ctx))
+	ctx.JSON(200, res)
+}
+
+// GetLicenseTerms 查询授权期限历史
+func GetLicenseTerms(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	var service = &license.ServiceRenewDTO{ContainerID: id}
+	res := service.GetTerms()
+	ctx.JSON(200, res)
+}
+
+// SetLicenseBindings 替换授权的全部绑定
+func SetLicenseBindings(ctx *gin.Context) {
+	var service = &license.ServiceBindingDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.SetBindings()
+	ctx.JSON(200, res)
+}
+
+// GetLicenseBindings 查询授权的全部绑定
+func GetLicenseBindings(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	var service = &license.ServiceBindingDTO{ContainerID: id}
+	res := service.GetBindings()
+	ctx.JSON(200, res)
+}
+
+// TransferLicense 管理员迁移授权到新的容器
+func TransferLicense(ctx *gin.Context) {
+	var service = &license.ServiceTransferDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Transfer(CurrentUser(ctx))
+	ctx.JSON(200, res)
+}
+
+// GetLicenseTransfers 查询授权迁移记录
+func GetLicenseTransfers(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("size", "20"))
+	var service = &license.ServiceTransferDTO{ContainerID: id}
+	res := service.GetTransfers(page, limit)
+	ctx.JSON(200, res)
+}
+
+// SelfTransferLicense 客户端自助迁移授权
+func SelfTransferLicense(ctx *gin.Context) {
+	var service = &license.SignLicense{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Transfer()
+	ctx.JSON(200, res)
+}
+
+func BindLicense(ctx *gin.Context) {
 	var service = &license.ServiceLicenseDTO{}
 	if err := ctx.ShouldBindJSON(&service); err != nil {
 		util.Log().Error(err.Error())
 		ctx.JSON(200, ErrorResponse(err))
 	}
-	res := service.UpdateLicenseStatus()
+	res := service.UpdateLicense(CurrentUser(ctx))
 	ctx.JSON(200, res)
 }
-func BindLicense(ctx *gin.Context) {
+func UpdateEntitlement(ctx *gin.Context) {
 	var service = &license.ServiceLicenseDTO{}
 	if err := ctx.ShouldBindJSON(&service); err != nil {
 		util.Log().Error(err.Error())
 		ctx.JSON(200, ErrorResponse(err))
+		return
 	}
-	res := service.UpdateLicense()
+	res := service.UpdateEntitlement()
 	ctx.JSON(200, res)
 }
 func RemoveLicense(ctx *gin.Context) {
@@ -69,7 +219,275 @@ func VerifyLicense(ctx *gin.Context) {
 	if err := ctx.BindJSON(service); err != nil {
 		util.Log().Error(err.Error())
 		ctx.JSON(200, ErrorResponse(err))
+		return
 	}
 	res := service.Verify()
 	ctx.JSON(200, res)
 }
+
+// ExportLicense 导出离线授权文件
+func ExportLicense(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	var service = &license.ServiceLicenseDTO{ContainerID: id}
+	content, err := service.Export(CurrentUser(ctx))
+	if err != nil {
+		ctx.JSON(200, serializer.Err(serializer.CodeNotSet, err.Error(), err))
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.lic\"", id))
+	ctx.Data(200, "application/octet-stream", content)
+}
+
+// ExportLicenses 按列表筛选条件批量导出授权为 CSV 或 XLSX
+func ExportLicenses(ctx *gin.Context) {
+	var service = &license.ServiceLicenseExportDTO{}
+	if err := ctx.ShouldBindQuery(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	filter, err := service.Filter()
+	if err != nil {
+		ctx.JSON(200, serializer.ParamErr(err.Error(), err))
+		return
+	}
+	filename := fmt.Sprintf("licenses-%s.%s", time.Now().Format("20060102150405"), service.Format)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	ctx.Header("Content-Type", service.ContentType())
+	ctx.Status(200)
+	if err = service.Export(ctx.Writer, filter); err != nil {
+		util.Log().Warning("授权导出中断, %s", err)
+	}
+}
+
+// ImportLicenses 从 CSV 或 XLSX 批量导入授权
+func ImportLicenses(ctx *gin.Context) {
+	var service = &license.ServiceLicenseImportDTO{}
+	if err := ctx.ShouldBind(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Import(file, CurrentUser(ctx))
+	ctx.JSON(200, res)
+}
+
+// LicenseHeartbeat 续期授权租约
+func LicenseHeartbeat(ctx *gin.Context) {
+	var service = &license.ServiceLeaseDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Heartbeat()
+	ctx.JSON(200, res)
+}
+
+// ReleaseLicense 释放授权租约
+func ReleaseLicense(ctx *gin.Context) {
+	var service = &license.ServiceLeaseDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Release()
+	ctx.JSON(200, res)
+}
+
+// CheckoutSeat 客户端签出浮动授权席位
+func CheckoutSeat(ctx *gin.Context) {
+	var service = &license.SignLicense{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Checkout()
+	ctx.JSON(200, res)
+}
+
+// RenewSeat 续期浮动授权席位
+func RenewSeat(ctx *gin.Context) {
+	var service = &license.ServiceSeatDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Renew()
+	ctx.JSON(200, res)
+}
+
+// CheckinSeat 签入浮动授权席位
+func CheckinSeat(ctx *gin.Context) {
+	var service = &license.ServiceSeatDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Checkin()
+	ctx.JSON(200, res)
+}
+
+// SetLicenseSeats 设置浮动授权席位数
+func SetLicenseSeats(ctx *gin.Context) {
+	var service = &license.ServiceSeatsDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.SetSeats()
+	ctx.JSON(200, res)
+}
+
+// GetLicenseSeats 查询浮动授权席位占用情况
+func GetLicenseSeats(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	var service = &license.ServiceSeatsDTO{ContainerID: id}
+	res := service.GetSeats()
+	ctx.JSON(200, res)
+}
+
+// ReleaseLicenseSeats 强制释放浮动授权的全部席位
+func ReleaseLicenseSeats(ctx *gin.Context) {
+	var service = &license.ServiceSeatsDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.ReleaseSeats()
+	ctx.JSON(200, res)
+}
+
+// GetLicenseUsage 查询授权在日期区间内的用量
+func GetLicenseUsage(ctx *gin.Context) {
+	var service = &license.ServiceUsageDTO{}
+	if err := ctx.ShouldBindQuery(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.GetUsage()
+	ctx.JSON(200, res)
+}
+
+// SetLicenseRetention 设置授权服务使用记录保留天数
+func SetLicenseRetention(ctx *gin.Context) {
+	var service = &license.ServiceRetentionDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.SetRetention()
+	ctx.JSON(200, res)
+}
+
+// SetLicenseUsageCap 设置授权每月用量上限
+func SetLicenseUsageCap(ctx *gin.Context) {
+	var service = &license.ServiceUsageCapDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.SetCap()
+	ctx.JSON(200, res)
+}
+
+// RedeemActivationCode 客户端兑换激活码
+func RedeemActivationCode(ctx *gin.Context) {
+	var service = &license.SignLicense{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Redeem(ctx.ClientIP())
+	ctx.JSON(200, res)
+}
+
+// CreateActivationCodes 批量生成激活码
+func CreateActivationCodes(ctx *gin.Context) {
+	var service = &license.ServiceActivationDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Create(CurrentUser(ctx))
+	ctx.JSON(200, res)
+}
+
+// GetActivationCodes 分页查询激活码
+func GetActivationCodes(ctx *gin.Context) {
+	var service = &license.ServiceActivationListDTO{}
+	if err := ctx.ShouldBindQuery(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("size", "20"))
+	res := service.GetCodes(page, limit)
+	ctx.JSON(200, res)
+}
+
+// RevokeActivationCodes 作废激活码
+func RevokeActivationCodes(ctx *gin.Context) {
+	var service = &license.ServiceActivationRevokeDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		util.Log().Error(err.Error())
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Revoke()
+	ctx.JSON(200, res)
+}
+
+// GetActivationRedemptions 查询激活码兑换记录，未指定 code 时查询全部
+func GetActivationRedemptions(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("size", "20"))
+	res := license.GetActivationRedemptions(ctx.Query("code"), page, limit)
+	ctx.JSON(200, res)
+}
+
+// EnrollFingerprint 重置或重新登记硬件指纹
+func EnrollFingerprint(ctx *gin.Context) {
+	var service = &license.ServiceFingerprintDTO{}
+	if err := ctx.ShouldBindJSON(service); err != nil {
+		ctx.JSON(200, ErrorResponse(err))
+		return
+	}
+	res := service.Enroll()
+	ctx.JSON(200, res)
+}
+
+// GetFingerprintMismatches 查询硬件指纹不匹配记录
+func GetFingerprintMismatches(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		ctx.JSON(200, ErrorResponse(errors.New("id must not null")))
+		return
+	}
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("size", "20"))
+	var service = &license.ServiceFingerprintDTO{ContainerID: id}
+	res := service.GetMismatches(page, limit)
+	ctx.JSON(200, res)
+}
+
+// GetPublicKeys 获取验签公钥
+func GetPublicKeys(ctx *gin.Context) {
+	res := license.GetPublicKeys()
+	ctx.JSON(200, res)
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/id"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	id.Init()
+	model.Init()
+	os.Exit(m.Run())
+}
+
+// TestGetLicenseKeepsLicense 查询授权详情不能删除授权
+func TestGetLicenseKeepsLicense(t *testing.T) {
+	asserts := assert.New(t)
+	lic := &model.License{Name: "getInfo", ContainerID: "TestGetLicenseKeepsLicense"}
+	_, err := lic.Create()
+	asserts.NoError(err)
+
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request, _ = http.NewRequest("GET", "/license/getInfo?id="+lic.ContainerID, nil)
+	GetLicense(ctx)
+
+	asserts.Equal(http.StatusOK, w.Code)
+	asserts.Contains(w.Body.String(), lic.ContainerID)
+	_, err = model.GetLicense(lic.ContainerID)
+	asserts.NoError(err)
+}
@@ -2,7 +2,10 @@ package controllers
 
 import (
 	"encoding/json"
+	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/zhouqiaokeji/server/middleware"
+	model "github.com/zhouqiaokeji/server/models"
 	"github.com/zhouqiaokeji/server/pkg/serializer"
 )
 
@@ -51,3 +54,12 @@ func ErrorResponse(err error) serializer.Response {
 
 	return serializer.ParamErr("参数错误", err)
 }
+
+// CurrentUser 获取当前登录用户
+func CurrentUser(c *gin.Context) *model.User {
+	var user *model.User
+	if u, _ := c.Get(middleware.CurrUser); u != nil {
+		user, _ = u.(*model.User)
+	}
+	return user
+}
@@ -36,23 +36,74 @@ func InitMasterRouter() *gin.Engine {
 	initCORS(app)
 	app.POST("/login", controllers.UserLogin)
 	app.POST("/check/server", controllers.CreateAppUseInfo)
+	app.POST("/check/server/batch", middleware.Decompress(), controllers.CreateAppUseInfos)
 	holiday := app.Group("/holiday")
 	holiday.GET("/get", controllers.GetHolidays)
 	// 授权路由
 	license := app.Group("/license")
 	license.POST("/create", controllers.CreateLicense)
 	license.POST("/verify", controllers.VerifyLicense)
+	license.POST("/heartbeat", controllers.LicenseHeartbeat)
+	license.POST("/release", controllers.ReleaseLicense)
+	license.GET("/keys", controllers.GetPublicKeys)
+	license.GET("/revocations", controllers.GetRevocations)
+	license.POST("/transfer/self", controllers.SelfTransferLicense)
+	license.POST("/seat/checkout", controllers.CheckoutSeat)
+	license.POST("/seat/renew", controllers.RenewSeat)
+	license.POST("/seat/checkin", controllers.CheckinSeat)
+	license.POST("/activate", controllers.RedeemActivationCode)
 	// 添加JWT验证
 	app.Use(middleware.CurrentUser())
-	license.GET("/list", controllers.GetLicenses)
-	license.GET("/getInfo", controllers.GetLicense)
-	license.POST("/status", controllers.ChangeStatus)
-	license.POST("/bind", controllers.BindLicense)
-	license.GET("/remove", controllers.RemoveLicense)
-	//holiday.POST("/list", controllers.listHolidays)
-	holiday.POST("/create", controllers.CreateHoliday)
+	// 分组创建时复制已注册的中间件，授权管理路由需使用登录后创建的分组
+	admin := app.Group("/license")
+	admin.GET("/list", controllers.GetLicenses)
+	admin.GET("/getInfo", controllers.GetLicense)
+	admin.POST("/status", controllers.ChangeStatus)
+	admin.GET("/status", controllers.GetLicenseState)
+	admin.GET("/history", controllers.GetLicenseHistories)
+	admin.GET("/expiry/events", controllers.GetExpiryEvents)
+	admin.POST("/renew", controllers.RenewLicense)
+	admin.GET("/terms", controllers.GetLicenseTerms)
+	admin.POST("/bindings", controllers.SetLicenseBindings)
+	admin.GET("/bindings", controllers.GetLicenseBindings)
+	admin.POST("/transfer", controllers.TransferLicense)
+	admin.GET("/transfers", controllers.GetLicenseTransfers)
+	admin.POST("/seats", controllers.SetLicenseSeats)
+	admin.GET("/seats", controllers.GetLicenseSeats)
+	admin.POST("/seats/release", controllers.ReleaseLicenseSeats)
+	admin.GET("/usage", controllers.GetLicenseUsage)
+	admin.POST("/usage/cap", controllers.SetLicenseUsageCap)
+	admin.POST("/retention", controllers.SetLicenseRetention)
+	admin.POST("/activation/codes", controllers.CreateActivationCodes)
+	admin.GET("/activation/codes", controllers.GetActivationCodes)
+	admin.POST("/activation/revoke", controllers.RevokeActivationCodes)
+	admin.GET("/activation/redemptions", controllers.GetActivationRedemptions)
+	admin.POST("/bind", controllers.BindLicense)
+	admin.POST("/entitlement", controllers.UpdateEntitlement)
+	admin.GET("/remove", controllers.RemoveLicense)
+	admin.GET("/export", controllers.ExportLicense)
+	admin.GET("/bulk/export", controllers.ExportLicenses)
+	admin.POST("/import", controllers.ImportLicenses)
+	admin.POST("/fingerprint", controllers.EnrollFingerprint)
+	admin.GET("/fingerprint/mismatch", controllers.GetFingerprintMismatches)
+	holidayAdmin := app.Group("/holiday")
+	//holidayAdmin.POST("/list", controllers.listHolidays)
+	holidayAdmin.POST("/create", controllers.CreateHoliday)
 	appInfo := app.Group("/appInfo")
 	appInfo.POST("/list", controllers.GetAppInfos)
+	appInfo.GET("/activity", controllers.GetAppActivity)
+	appInfo.GET("/geo/points", controllers.GetAppGeoPoints)
+	appInfo.GET("/geo/clusters", controllers.GetAppGeoClusters)
+	appInfo.GET("/geo/export", controllers.ExportAppGeo)
+	appInfo.GET("/export", controllers.ExportAppUseInfos)
+	appInfo.GET("/exports", controllers.GetAppUseInfoExports)
+	customer := app.Group("/customer")
+	customer.GET("/list", controllers.GetCustomers)
+	customer.GET("/getInfo", controllers.GetCustomer)
+	customer.POST("/create", controllers.CreateCustomer)
+	customer.POST("/update", controllers.UpdateCustomer)
+	customer.GET("/remove", controllers.RemoveCustomer)
+	customer.POST("/assign", controllers.AssignCustomerLicenses)
 	return app
 }
 
@@ -0,0 +1,52 @@
+package routers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// publicRoutes 客户端调用的路由，无需登录
+var publicRoutes = map[string]bool{
+	"POST /login":                 true,
+	"POST /check/server":          true,
+	"POST /check/server/batch":    true,
+	"GET /holiday/get":            true,
+	"POST /license/create":        true,
+	"POST /license/verify":        true,
+	"POST /license/heartbeat":     true,
+	"POST /license/release":       true,
+	"GET /license/keys":           true,
+	"GET /license/revocations":    true,
+	"POST /license/transfer/self": true,
+	"POST /license/seat/checkout": true,
+	"POST /license/seat/renew":    true,
+	"POST /license/seat/checkin":  true,
+	"POST /license/activate":      true,
+}
+
+// TestAdminRoutesRequireLogin 未登录访问管理路由时返回 401
+func TestAdminRoutesRequireLogin(t *testing.T) {
+	asserts := assert.New(t)
+	gin.SetMode(gin.TestMode)
+	app := InitMasterRouter()
+
+	for _, route := range app.Routes() {
+		if publicRoutes[route.Method+" "+route.Path] {
+			continue
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(route.Method, route.Path, nil)
+		app.ServeHTTP(w, req)
+		asserts.Equal(http.StatusUnauthorized, w.Code, route.Method+" "+route.Path)
+	}
+
+	// 导出授权文件不能绕过登录
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/license/export?id=test", nil)
+	app.ServeHTTP(w, req)
+	asserts.Equal(http.StatusUnauthorized, w.Code)
+}
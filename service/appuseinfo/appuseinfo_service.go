@@ -4,12 +4,18 @@ import (
 	"encoding/json"
 	"github.com/gin-gonic/gin"
 	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/replay"
 	"github.com/zhouqiaokeji/server/pkg/rsa"
 	"github.com/zhouqiaokeji/server/pkg/serializer"
 	"github.com/zhouqiaokeji/server/pkg/util"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// replayScope 服务上报的防重放作用域
+const replayScope = "app_use_info"
+
 type ServiceAppUseInfoDTO struct {
 	Id           uint64    `json:"id,string"`
 	Name         string    `json:"name"`
@@ -29,9 +35,12 @@ type ServiceAppUseInfoDTO struct {
 	DeviceSN     string    `json:"device_sn"`
 	DeviceVendor string    `json:"device_vendor"`
 	Time         time.Time `json:"time"`
+	CheckIns     int64     `json:"check_ins,omitempty"`
+	Rollup       bool      `json:"rollup,omitempty"`
 }
 
 type SignAppUseInfo struct {
+	rsa.Envelope
 	Key        string `json:"key"`
 	DeviceInfo string `json:"d_str" binding:"required"`
 	UserInfo   string `json:"u_str" binding:"required"`
@@ -40,45 +49,61 @@ type SignAppUseInfo struct {
 type LicenseUseInfos struct {
 	Name        string                 `json:"name"`
 	ContainerID string                 `json:"containerId" binding:"required"`
+	CustomerID  uint64                 `json:"customer_id,string"`
+	Customer    string                 `json:"customer,omitempty"`
 	UseInfos    []ServiceAppUseInfoDTO `json:"use_infos"`
 }
 
+// CustomerUseInfos 按客户分组的授权使用信息
+type CustomerUseInfos struct {
+	CustomerID uint64            `json:"customer_id,string"`
+	Customer   string            `json:"customer"`
+	Licenses   []LicenseUseInfos `json:"licenses"`
+}
+
 func (s *SignAppUseInfo) Create(c *gin.Context) serializer.Response {
 
-	useInfoDTO, err := s.decode(c)
+	useInfoDTO, guard, err := s.decode(c)
 	if err != nil {
-		return serializer.Err(serializer.CodeNotFullySuccess, "信息解密异常", nil)
-	}
-	useInfo := &model.AppUseInfo{
-		Name:         useInfoDTO.Name,
-		Mobile:       useInfoDTO.Mobile,
-		ServerAddr:   useInfoDTO.ServerAddr,
-		RequestIp:    useInfoDTO.RequestIp,
-		UserId:       useInfoDTO.UserId,
-		UserName:     useInfoDTO.UserName,
-		Version:      useInfoDTO.Version,
-		Platform:     useInfoDTO.Platform,
-		WIFIName:     useInfoDTO.WIFIName,
-		WIFIMac:      useInfoDTO.WIFIMac,
-		BootLoader:   useInfoDTO.BootLoader,
-		LON:          useInfoDTO.LON,
-		LAT:          useInfoDTO.LAT,
-		OSVersion:    useInfoDTO.OSVersion,
-		DeviceSN:     useInfoDTO.DeviceSN,
-		DeviceVendor: useInfoDTO.DeviceVendor,
+		return serializer.Err(serializer.CodeNotFullySuccess, "信息解密异常", err)
 	}
+	useInfo := newAppUseInfo(&useInfoDTO, guard.Timestamp)
 	id, _ := useInfo.Create()
+	// 回显随机数并加签，客户端据此确认返回结果对应自身请求
+	res := map[string]interface{}{
+		"id":    id,
+		"nonce": guard.Nonce,
+	}
+	// 上报计入绑定该服务地址的授权用量，超出每月用量上限时在返回中标记
+	if license, err := model.FindLicenseByAddr(useInfo.ServerAddr); err == nil {
+		if license.UsageExceeded(time.Now()) {
+			res["overCap"] = true
+		}
+		recordCheckIn(&license, useInfo)
+	}
+	data, _ := json.Marshal(res)
+	sign, kid := rsa.SignRSAWithKid(data)
 	return serializer.Response{
 		Code: serializer.OK,
 		Data: map[string]interface{}{
-			"id": id,
+			"id":   id,
+			"sign": sign,
+			"kid":  kid,
+			"data": string(data),
 		},
 	}
 }
 
-func (s *ServiceAppUseInfoDTO) GetAppInfos(containerId string, page, size int, order string, date ...time.Time) serializer.Response {
+// GetAppInfos 查询服务使用信息；未指定容器时分页列出授权及其最近的使用信息，
+// 可按客户筛选，group 为 true 时将当前页的授权按客户分组
+func (s *ServiceAppUseInfoDTO) GetAppInfos(containerId string, customerId *uint64, group bool, page, size int, order string, date ...time.Time) serializer.Response {
 	if containerId == "" {
-		licenses, total := model.GetLicenses(page, size, "", "")
+		licenses, total := model.GetLicenses(page, size, "", &model.LicenseFilter{CustomerID: customerId})
+		ids := make([]uint64, 0, len(licenses))
+		for _, t := range licenses {
+			ids = append(ids, t.CustomerID)
+		}
+		customers := model.GetCustomersByIDs(ids)
 		res := make([]LicenseUseInfos, 0, len(licenses))
 
 		for _, t := range licenses {
@@ -86,14 +111,20 @@ func (s *ServiceAppUseInfoDTO) GetAppInfos(containerId string, page, size int, o
 			res = append(res, LicenseUseInfos{
 				Name:        t.Name,
 				ContainerID: t.ContainerID,
+				CustomerID:  t.CustomerID,
+				Customer:    customers[t.CustomerID].Name,
 				UseInfos:    resUseInfos,
 			})
 		}
+		var content interface{} = res
+		if group {
+			content = groupByCustomer(res)
+		}
 		return serializer.Response{
 			Code: serializer.OK,
 			Data: &serializer.Page{
 				Total:   total,
-				Content: res,
+				Content: content,
 				Page:    page,
 				Size:    size,
 			},
@@ -116,62 +147,204 @@ func (s *ServiceAppUseInfoDTO) GetAppInfos(containerId string, page, size int, o
 	}
 }
 
-func (s *SignAppUseInfo) decode(c *gin.Context) (ServiceAppUseInfoDTO, error) {
+func (s *SignAppUseInfo) decode(c *gin.Context) (ServiceAppUseInfoDTO, *replay.Guard, error) {
+	useInfoDTO, guard, err := openUseInfo(&s.Envelope, s.DeviceInfo, s.UserInfo)
+	if err != nil {
+		return useInfoDTO, guard, err
+	}
+	if err = guard.Check(replayScope); err != nil {
+		return useInfoDTO, guard, err
+	}
+	useInfoDTO.RequestIp = util.GetIpAddr(c.Request)
+	return useInfoDTO, guard, nil
+}
+
+// openUseInfo 解密设备信息及终端用户信息，防重放字段随设备信息一同加密上报
+func openUseInfo(envelope *rsa.Envelope, deviceCipher, userCipher string) (ServiceAppUseInfoDTO, *replay.Guard, error) {
 	var (
-		err        error
 		useInfoDTO ServiceAppUseInfoDTO
+		guard      = &replay.Guard{}
 	)
-	deviceInfoBase64 := rsa.BcryptRSA(s.DeviceInfo)
-	if err = json.Unmarshal([]byte(deviceInfoBase64), &useInfoDTO); err != nil {
+	deviceInfo, err := envelope.Open(deviceCipher)
+	if err != nil {
+		return useInfoDTO, guard, err
+	}
+	if err = json.Unmarshal(deviceInfo, &useInfoDTO); err != nil {
 		util.Log().Error(err.Error())
+		return useInfoDTO, guard, err
 	}
-	userInfoBase64 := rsa.BcryptRSA(s.UserInfo)
-	if err = json.Unmarshal([]byte(userInfoBase64), &useInfoDTO); err != nil {
+	_ = json.Unmarshal(deviceInfo, guard)
+	userInfo, err := envelope.Open(userCipher)
+	if err != nil {
+		return useInfoDTO, guard, err
+	}
+	if err = json.Unmarshal(userInfo, &useInfoDTO); err != nil {
 		util.Log().Error(err.Error())
+		return useInfoDTO, guard, err
 	}
-	useInfoDTO.RequestIp = util.GetIpAddr(c.Request)
-	return useInfoDTO, nil
+	return useInfoDTO, guard, nil
+}
+
+// newAppUseInfo 构建服务使用记录，使用客户端上报时间作为记录时间
+func newAppUseInfo(useInfoDTO *ServiceAppUseInfoDTO, timestamp int64) *model.AppUseInfo {
+	useInfo := &model.AppUseInfo{
+		Name:         useInfoDTO.Name,
+		Mobile:       useInfoDTO.Mobile,
+		ServerAddr:   useInfoDTO.ServerAddr,
+		RequestIp:    useInfoDTO.RequestIp,
+		UserId:       useInfoDTO.UserId,
+		UserName:     useInfoDTO.UserName,
+		Version:      useInfoDTO.Version,
+		Platform:     useInfoDTO.Platform,
+		WIFIName:     useInfoDTO.WIFIName,
+		WIFIMac:      useInfoDTO.WIFIMac,
+		BootLoader:   useInfoDTO.BootLoader,
+		LON:          useInfoDTO.LON,
+		LAT:          useInfoDTO.LAT,
+		OSVersion:    useInfoDTO.OSVersion,
+		DeviceSN:     useInfoDTO.DeviceSN,
+		DeviceVendor: useInfoDTO.DeviceVendor,
+	}
+	useInfo.CreatedAt = reportTime(timestamp, useInfoDTO.Time)
+	return useInfo
+}
+
+// reportTime 返回客户端上报时间，优先使用防重放时间戳；
+// 未上报或晚于服务端当前时间时使用服务端时间
+func reportTime(timestamp int64, reported time.Time) time.Time {
+	now := time.Now()
+	at := reported
+	if timestamp > 0 {
+		at = time.Unix(timestamp, 0)
+	}
+	if at.IsZero() || at.After(now) {
+		return now
+	}
+	return at
+}
+
+// recordCheckIn 按上报时间计入授权用量
+func recordCheckIn(license *model.License, useInfo *model.AppUseInfo) {
+	user := ""
+	if useInfo.UserId != 0 {
+		user = strconv.FormatInt(useInfo.UserId, 10)
+	}
+	license.RecordCheckIn(useInfo.CreatedAt, useInfo.DeviceSN, user)
 }
 
 func getLicenseUseInfo(license model.License, page, size int, order string, date ...time.Time) ([]ServiceAppUseInfoDTO, int64) {
 	var (
-		serverAddr []string
-		total      int64
-		infos      []model.AppUseInfo
-		res        []ServiceAppUseInfoDTO
+		total int64
+		res   []ServiceAppUseInfoDTO
 	)
-	serverAddr = make([]string, 0, 2)
-	if license.IP != "" {
-		serverAddr = append(serverAddr, license.IP)
-	}
-	if license.Domain != "" {
-		serverAddr = append(serverAddr, license.Domain)
-	}
-	if len(serverAddr) > 0 {
-		infos, total = model.GetAppUseInfoByServerAddr(page, size, order, serverAddr, date)
-		res = make([]ServiceAppUseInfoDTO, 0, len(infos))
-		for _, t := range infos {
-			res = append(res, ServiceAppUseInfoDTO{
-				Id:           t.ID,
-				Name:         t.Name,
-				Mobile:       t.Mobile,
-				ServerAddr:   t.ServerAddr,
-				RequestIp:    t.RequestIp,
-				UserId:       t.UserId,
-				UserName:     t.UserName,
-				Version:      t.Version,
-				Platform:     t.Platform,
-				WIFIName:     t.WIFIName,
-				WIFIMac:      t.WIFIMac,
-				BootLoader:   t.BootLoader,
-				LON:          t.LON,
-				LAT:          t.LAT,
-				OSVersion:    t.OSVersion,
-				DeviceSN:     t.DeviceSN,
-				DeviceVendor: t.DeviceVendor,
-				Time:         t.CreatedAt,
-			})
+	// 服务地址命中授权任一绑定即视为该授权的使用信息
+	serverAddr := model.GetServerAddrsMatching(license.BindingRules())
+	if len(serverAddr) == 0 {
+		return res, total
+	}
+
+	asc := ascending(order)
+	raw := func(offset, limit int) ([]ServiceAppUseInfoDTO, int64) {
+		infos, count := model.GetAppUseInfoByServerAddr(offset, limit, order, serverAddr, date)
+		items := make([]ServiceAppUseInfoDTO, 0, len(infos))
+		for i := range infos {
+			items = append(items, newUseInfoDTO(&infos[i]))
+		}
+		return items, count
+	}
+	rolled := func(offset, limit int) ([]ServiceAppUseInfoDTO, int64) {
+		rollups, count := model.GetAppUseInfoRollups(offset, limit, asc, serverAddr, date)
+		items := make([]ServiceAppUseInfoDTO, 0, len(rollups))
+		for i := range rollups {
+			items = append(items, newRollupDTO(&rollups[i]))
 		}
+		return items, count
+	}
+	// 超出保留期的记录已按日汇总，早于全部原始记录：倒序时排在原始记录之后，正序时排在之前，
+	// 当前页未满时以下一部分补足
+	segments := []func(offset, limit int) ([]ServiceAppUseInfoDTO, int64){raw, rolled}
+	if asc {
+		segments[0], segments[1] = rolled, raw
+	}
+	res = make([]ServiceAppUseInfoDTO, 0, size)
+	start := (page - 1) * size
+	for _, segment := range segments {
+		offset := start - int(total)
+		if offset < 0 {
+			offset = 0
+		}
+		items, count := segment(offset, size-len(res))
+		res = append(res, items...)
+		total += count
 	}
 	return res, total
 }
+
+// ascending 判断排序条件是否为正序
+func ascending(order string) bool {
+	fields := strings.Fields(strings.ToLower(order))
+	return len(fields) > 0 && fields[len(fields)-1] == "asc"
+}
+
+// newRollupDTO 将按日汇总转换为返回信息，记录时间为当天最后一次上报时间
+func newRollupDTO(t *model.AppUseInfoRollup) ServiceAppUseInfoDTO {
+	return ServiceAppUseInfoDTO{
+		Id:           t.ID,
+		Name:         t.Name,
+		Mobile:       t.Mobile,
+		ServerAddr:   t.ServerAddr,
+		RequestIp:    t.RequestIp,
+		UserId:       t.UserId,
+		UserName:     t.UserName,
+		Version:      t.Version,
+		Platform:     t.Platform,
+		LON:          t.LON,
+		LAT:          t.LAT,
+		OSVersion:    t.OSVersion,
+		DeviceSN:     t.DeviceSN,
+		DeviceVendor: t.DeviceVendor,
+		Time:         t.LastAt,
+		CheckIns:     t.CheckIns,
+		Rollup:       true,
+	}
+}
+
+// newUseInfoDTO 将服务使用记录转换为返回信息，记录时间为客户端上报时间
+func newUseInfoDTO(t *model.AppUseInfo) ServiceAppUseInfoDTO {
+	return ServiceAppUseInfoDTO{
+		Id:           t.ID,
+		Name:         t.Name,
+		Mobile:       t.Mobile,
+		ServerAddr:   t.ServerAddr,
+		RequestIp:    t.RequestIp,
+		UserId:       t.UserId,
+		UserName:     t.UserName,
+		Version:      t.Version,
+		Platform:     t.Platform,
+		WIFIName:     t.WIFIName,
+		WIFIMac:      t.WIFIMac,
+		BootLoader:   t.BootLoader,
+		LON:          t.LON,
+		LAT:          t.LAT,
+		OSVersion:    t.OSVersion,
+		DeviceSN:     t.DeviceSN,
+		DeviceVendor: t.DeviceVendor,
+		Time:         t.CreatedAt,
+	}
+}
+
+// groupByCustomer 按客户分组，保持各客户首次出现的顺序
+func groupByCustomer(infos []LicenseUseInfos) []CustomerUseInfos {
+	res := make([]CustomerUseInfos, 0)
+	index := make(map[uint64]int)
+	for _, info := range infos {
+		i, ok := index[info.CustomerID]
+		if !ok {
+			i = len(res)
+			index[info.CustomerID] = i
+			res = append(res, CustomerUseInfos{CustomerID: info.CustomerID, Customer: info.Customer})
+		}
+		res[i].Licenses = append(res[i].Licenses, info)
+	}
+	return res
+}
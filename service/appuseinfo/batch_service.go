@@ -0,0 +1,164 @@
+package appuseinfo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/replay"
+	"github.com/zhouqiaokeji/server/pkg/rsa"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"time"
+)
+
+// errItemExpired 记录产生时间早于随机数有效期，无法判断是否已入库
+var errItemExpired = serializer.NewError(serializer.CodeSignExpired, "记录产生时间超出补报期限", nil)
+
+// SignAppUseInfoBatch 批量上报的服务使用信息，各条记录共用同一加密信封，
+// 整个请求的防重放字段加密于 g_str 中
+type SignAppUseInfoBatch struct {
+	rsa.Envelope
+	Guard string               `json:"g_str" binding:"required"`
+	Items []SignAppUseInfoItem `json:"items" binding:"required,min=1"`
+}
+
+// SignAppUseInfoItem 批量上报中的单条记录，设备信息中的时间戳为记录产生时间，
+// 随机数用于单条记录去重
+type SignAppUseInfoItem struct {
+	DeviceInfo string `json:"d_str"`
+	UserInfo   string `json:"u_str"`
+}
+
+// AppUseInfoResult 单条记录的处理结果，Code 为 serializer.OK 时客户端可删除该记录；
+// Duplicate 为 true 表示该记录此前已入库
+type AppUseInfoResult struct {
+	Index     int    `json:"index"`
+	Id        uint64 `json:"id,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Code      int    `json:"code"`
+	Msg       string `json:"msg,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	OverCap   bool   `json:"overCap,omitempty"`
+}
+
+// CreateBatch 批量记录服务使用信息，解密失败的记录单独返回错误，
+// 其余记录在同一事务中入库，返回结果与请求中的记录按顺序一一对应
+func (s *SignAppUseInfoBatch) CreateBatch(c *gin.Context) serializer.Response {
+	if len(s.Items) > conf.LicenseConfig.CheckInBatchSize {
+		return serializer.ParamErr(fmt.Sprintf("单次最多上报 %d 条记录", conf.LicenseConfig.CheckInBatchSize), nil)
+	}
+	guard := &replay.Guard{}
+	plainText, err := s.Open(s.Guard)
+	if err == nil {
+		err = json.Unmarshal(plainText, guard)
+	}
+	if err == nil {
+		err = guard.Check(replayScope + "_batch")
+	}
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFullySuccess, "信息解密异常", err)
+	}
+
+	var (
+		requestIp = util.GetIpAddr(c.Request)
+		results   = make([]AppUseInfoResult, len(s.Items))
+		useInfos  = make([]*model.AppUseInfo, 0, len(s.Items))
+		pending   = make([]int, 0, len(s.Items))
+		nonces    = make(map[string]bool, len(s.Items))
+		earliest  = time.Now().Add(-model.AppUseInfoNonceTTL)
+	)
+	for i, item := range s.Items {
+		results[i] = AppUseInfoResult{Index: i, Code: serializer.OK}
+		useInfoDTO, itemGuard, err := openUseInfo(&s.Envelope, item.DeviceInfo, item.UserInfo)
+		results[i].Nonce = itemGuard.Nonce
+		if err != nil {
+			results[i].Code, results[i].Msg = itemErr(err)
+			continue
+		}
+		useInfoDTO.RequestIp = requestIp
+		useInfo := newAppUseInfo(&useInfoDTO, itemGuard.Timestamp)
+		if useInfo.CreatedAt.Before(earliest) {
+			results[i].Code, results[i].Msg = itemErr(errItemExpired)
+			continue
+		}
+		// 随机数随记录在同一事务中入库，由唯一索引识别客户端重试的记录
+		if nonce := itemGuard.Nonce; nonce != "" {
+			if nonces[nonce] {
+				results[i].Duplicate = true
+				continue
+			}
+			nonces[nonce] = true
+			useInfo.Nonce = &nonce
+		}
+		useInfos = append(useInfos, useInfo)
+		pending = append(pending, i)
+	}
+
+	duplicates, err := model.CreateAppUseInfos(useInfos)
+	if err != nil {
+		for _, i := range pending {
+			results[i].Code, results[i].Msg = serializer.CodeDBError, "记录入库失败"
+		}
+	} else {
+		recordCheckIns(useInfos, duplicates, pending, results)
+	}
+
+	// 回显请求随机数并加签，客户端据此确认返回结果对应自身请求
+	data, _ := json.Marshal(map[string]interface{}{
+		"nonce":   guard.Nonce,
+		"results": results,
+	})
+	sign, kid := rsa.SignRSAWithKid(data)
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: map[string]interface{}{
+			"sign": sign,
+			"kid":  kid,
+			"data": string(data),
+		},
+	}
+}
+
+// recordCheckIns 将已入库的记录计入绑定对应服务地址的授权用量，
+// 超出每月用量上限的授权在对应结果中标记，此前已入库的记录标记为重复
+func recordCheckIns(useInfos []*model.AppUseInfo, duplicates []bool, pending []int, results []AppUseInfoResult) {
+	type usage struct {
+		license *model.License
+		overCap bool
+	}
+	licenses := make(map[string]*usage)
+	now := time.Now()
+	for j, useInfo := range useInfos {
+		i := pending[j]
+		if duplicates[j] {
+			results[i].Duplicate = true
+			continue
+		}
+		results[i].Id = useInfo.ID
+		u, ok := licenses[useInfo.ServerAddr]
+		if !ok {
+			u = &usage{}
+			if license, err := model.FindLicenseByAddr(useInfo.ServerAddr); err == nil {
+				u.license = &license
+				u.overCap = license.UsageExceeded(now)
+			}
+			licenses[useInfo.ServerAddr] = u
+		}
+		if u.license != nil {
+			results[i].OverCap = u.overCap
+			recordCheckIn(u.license, useInfo)
+		}
+	}
+}
+
+// itemErr 将单条记录的处理错误转换为错误码及说明
+func itemErr(err error) (int, string) {
+	var appErr serializer.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Code, appErr.Msg
+	}
+	return serializer.CodeParamErr, "信息解密异常"
+}
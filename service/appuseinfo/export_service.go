@@ -0,0 +1,317 @@
+package appuseinfo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导出格式
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// exportBatchSize 导出时每批读取的记录数
+const exportBatchSize = 500
+
+// utf8BOM 便于 Excel 正确识别 CSV 中的中文
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// exportColumn 可导出的字段，column 为数据库字段名
+type exportColumn struct {
+	name   string
+	column string
+	value  func(t *model.AppUseInfo) interface{}
+}
+
+// exportColumns 可导出的字段，未指定字段时按此顺序导出全部字段；
+// 雪花ID及终端用户ID按字符串导出，避免 JavaScript 等客户端丢失精度
+var exportColumns = []exportColumn{
+	{"id", "id", func(t *model.AppUseInfo) interface{} { return strconv.FormatUint(t.ID, 10) }},
+	{"time", "created_at", func(t *model.AppUseInfo) interface{} { return t.CreatedAt.Local().Format(time.RFC3339) }},
+	{"name", "name", func(t *model.AppUseInfo) interface{} { return t.Name }},
+	{"server_addr", "server_addr", func(t *model.AppUseInfo) interface{} { return t.ServerAddr }},
+	{"request_ip", "request_ip", func(t *model.AppUseInfo) interface{} { return t.RequestIp }},
+	{"user_id", "user_id", func(t *model.AppUseInfo) interface{} { return strconv.FormatInt(t.UserId, 10) }},
+	{"user_name", "user_name", func(t *model.AppUseInfo) interface{} { return t.UserName }},
+	{"mobile", "mobile", func(t *model.AppUseInfo) interface{} { return t.Mobile }},
+	{"version", "version", func(t *model.AppUseInfo) interface{} { return t.Version }},
+	{"platform", "platform", func(t *model.AppUseInfo) interface{} { return t.Platform }},
+	{"os_version", "os_version", func(t *model.AppUseInfo) interface{} { return t.OSVersion }},
+	{"device_sn", "device_sn", func(t *model.AppUseInfo) interface{} { return t.DeviceSN }},
+	{"device_vendor", "device_vendor", func(t *model.AppUseInfo) interface{} { return t.DeviceVendor }},
+	{"wifi_name", "wifi_name", func(t *model.AppUseInfo) interface{} { return t.WIFIName }},
+	{"wifi_mac", "wifi_mac", func(t *model.AppUseInfo) interface{} { return t.WIFIMac }},
+	{"boot_loader", "boot_loader", func(t *model.AppUseInfo) interface{} { return t.BootLoader }},
+	{"lon", "lon", func(t *model.AppUseInfo) interface{} { return t.LON }},
+	{"lat", "lat", func(t *model.AppUseInfo) interface{} { return t.LAT }},
+}
+
+// ServiceExportDTO 服务使用记录导出请求，需指定授权或客户，日期格式为 20060102 或 2006-01-02；
+// Columns 为逗号分隔的导出字段，为空时导出全部字段。超出保留期已汇总的记录不在导出范围内
+type ServiceExportDTO struct {
+	ContainerID string `form:"containerId"`
+	CustomerID  uint64 `form:"customerId"`
+	From        string `form:"from"`
+	To          string `form:"to"`
+	Format      string `form:"format" binding:"required,oneof=csv ndjson"`
+	Columns     string `form:"columns"`
+
+	useInfoRange *model.AppUseInfoRange
+	columns      []exportColumn
+}
+
+// ServiceExportListDTO 导出记录查询
+type ServiceExportListDTO struct {
+	ContainerID string `form:"containerId"`
+}
+
+// AppUseInfoExportDTO 导出记录
+type AppUseInfoExportDTO struct {
+	Id          uint64     `json:"id,string"`
+	Actor       uint64     `json:"actor,string"`
+	ActorName   string     `json:"actor_name"`
+	RequestIP   string     `json:"request_ip"`
+	ContainerID string     `json:"containerId,omitempty"`
+	CustomerID  uint64     `json:"customer_id,string,omitempty"`
+	From        *time.Time `json:"from"`
+	To          *time.Time `json:"to"`
+	Format      string     `json:"format"`
+	Columns     []string   `json:"columns"`
+	Rows        int64      `json:"rows"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Time        time.Time  `json:"time"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// Prepare 校验导出范围及字段，需在写出响应头之前调用
+func (s *ServiceExportDTO) Prepare() error {
+	s.useInfoRange = &model.AppUseInfoRange{}
+	if s.From != "" {
+		from, err := parseDay(s.From)
+		if err != nil {
+			return errors.New("开始日期格式错误")
+		}
+		s.useInfoRange.From = &from
+	}
+	if s.To != "" {
+		to, err := parseDay(s.To)
+		if err != nil {
+			return errors.New("结束日期格式错误")
+		}
+		to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		s.useInfoRange.To = &to
+	}
+	if s.useInfoRange.From != nil && s.useInfoRange.To != nil && s.useInfoRange.From.After(*s.useInfoRange.To) {
+		return errors.New("开始日期不能晚于结束日期")
+	}
+
+	switch {
+	case s.ContainerID != "":
+		license, err := model.GetLicense(s.ContainerID)
+		if err != nil {
+			return errors.New("授权信息不存在")
+		}
+		s.useInfoRange.ServerAddrs = serverAddrsOf([]model.License{license})
+	case s.CustomerID != 0:
+		if _, err := model.GetCustomer(s.CustomerID); err != nil {
+			return errors.New("客户不存在")
+		}
+		s.useInfoRange.ServerAddrs = serverAddrsOf(model.GetCustomerLicenses(s.CustomerID))
+	default:
+		return errors.New("授权或客户不能为空")
+	}
+
+	var err error
+	s.columns, err = parseExportColumns(s.Columns)
+	return err
+}
+
+// parseExportColumns 解析逗号分隔的导出字段，重复的字段只导出一次，为空时导出全部字段
+func parseExportColumns(value string) ([]exportColumn, error) {
+	if strings.TrimSpace(value) == "" {
+		return exportColumns, nil
+	}
+	columns := make([]exportColumn, 0)
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		column, ok := findExportColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("不支持的导出字段 %s", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// ContentType 导出文件的 MIME 类型
+func (s *ServiceExportDTO) ContentType() string {
+	if s.Format == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Export 按 ID 顺序流式导出服务使用记录并记录导出审计，导出中断时审计记录标记为失败
+func (s *ServiceExportDTO) Export(w io.Writer, actor *model.User, requestIP string) error {
+	names := make([]string, 0, len(s.columns))
+	columns := make([]string, 0, len(s.columns))
+	for _, column := range s.columns {
+		names = append(names, column.name)
+		columns = append(columns, column.column)
+	}
+	export := &model.AppUseInfoExport{
+		RequestIP:   requestIP,
+		ContainerID: s.ContainerID,
+		CustomerID:  s.CustomerID,
+		From:        s.useInfoRange.From,
+		To:          s.useInfoRange.To,
+		Format:      s.Format,
+		Columns:     strings.Join(names, ","),
+	}
+	if actor != nil {
+		export.Creator = actor.ID
+		export.ActorName = actor.UserName
+	}
+	if err := export.Create(); err != nil {
+		return err
+	}
+
+	var (
+		rows   int64
+		writer = bufio.NewWriter(w)
+		err    error
+	)
+	if s.Format == FormatNDJSON {
+		err = s.exportNDJSON(writer, columns, &rows)
+	} else {
+		err = s.exportCSV(writer, names, columns, &rows)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	export.Finish(rows, err)
+	return err
+}
+
+// exportCSV 写出表头及各行记录
+func (s *ServiceExportDTO) exportCSV(w *bufio.Writer, names, columns []string, rows *int64) error {
+	if _, err := w.Write(utf8BOM); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(names); err != nil {
+		return err
+	}
+	record := make([]string, len(s.columns))
+	err := model.EachAppUseInfoBatch(s.useInfoRange, columns, exportBatchSize, func(useInfos []model.AppUseInfo) error {
+		for i := range useInfos {
+			for j, column := range s.columns {
+				record[j] = util.CSVCell(column.value(&useInfos[i]))
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+			*rows++
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportNDJSON 每行写出一条记录，字段按指定顺序排列
+func (s *ServiceExportDTO) exportNDJSON(w *bufio.Writer, columns []string, rows *int64) error {
+	keys := make([][]byte, len(s.columns))
+	for i, column := range s.columns {
+		keys[i], _ = json.Marshal(column.name)
+	}
+	return model.EachAppUseInfoBatch(s.useInfoRange, columns, exportBatchSize, func(useInfos []model.AppUseInfo) error {
+		for i := range useInfos {
+			if err := w.WriteByte('{'); err != nil {
+				return err
+			}
+			for j, column := range s.columns {
+				value, err := json.Marshal(column.value(&useInfos[i]))
+				if err != nil {
+					return err
+				}
+				if j > 0 {
+					_ = w.WriteByte(',')
+				}
+				_, _ = w.Write(keys[j])
+				_ = w.WriteByte(':')
+				_, _ = w.Write(value)
+			}
+			if _, err := w.WriteString("}\n"); err != nil {
+				return err
+			}
+			*rows++
+		}
+		return w.Flush()
+	})
+}
+
+// GetExports 分页查询导出记录
+func (s *ServiceExportListDTO) GetExports(page, size int) serializer.Response {
+	exports, total := model.GetAppUseInfoExports(s.ContainerID, page, size)
+	res := make([]AppUseInfoExportDTO, 0, len(exports))
+	for _, t := range exports {
+		dto := AppUseInfoExportDTO{
+			Id:          t.ID,
+			Actor:       t.Creator,
+			ActorName:   t.ActorName,
+			RequestIP:   t.RequestIP,
+			ContainerID: t.ContainerID,
+			CustomerID:  t.CustomerID,
+			From:        t.From,
+			To:          t.To,
+			Format:      t.Format,
+			Columns:     strings.Split(t.Columns, ","),
+			Rows:        t.Rows,
+			Status:      t.Status,
+			Error:       t.Error,
+			Time:        t.CreatedAt,
+			FinishedAt:  t.FinishedAt,
+		}
+		res = append(res, dto)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+// findExportColumn 按名称查找可导出的字段
+func findExportColumn(name string) (exportColumn, bool) {
+	for _, column := range exportColumns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return exportColumn{}, false
+}
@@ -0,0 +1,31 @@
+package appuseinfo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExportColumns(t *testing.T) {
+	asserts := assert.New(t)
+	names := func(columns []exportColumn) []string {
+		res := make([]string, 0, len(columns))
+		for _, column := range columns {
+			res = append(res, column.name)
+		}
+		return res
+	}
+
+	columns, err := parseExportColumns(" ")
+	asserts.NoError(err)
+	asserts.Len(columns, len(exportColumns))
+
+	// 按指定顺序导出，重复字段只导出一次
+	columns, err = parseExportColumns("device_sn, time,device_sn")
+	asserts.NoError(err)
+	asserts.Equal([]string{"device_sn", "time"}, names(columns))
+	asserts.Equal("created_at", columns[1].column)
+
+	_, err = parseExportColumns("device_sn,password")
+	asserts.Error(err)
+}
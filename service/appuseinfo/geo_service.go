@@ -0,0 +1,197 @@
+package appuseinfo
+
+import (
+	"errors"
+	"fmt"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/geo"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"io"
+	"time"
+)
+
+const (
+	// defaultGeoDays 位置聚合及导出未指定日期时的默认天数
+	defaultGeoDays = 30
+	// maxGeoDays 位置聚合及导出单次查询的最大天数
+	maxGeoDays = 92
+)
+
+// ServiceGeoDTO 服务上报位置查询条件，范围可使用 bbox（minLon,minLat,maxLon,maxLat）
+// 或 lon、lat、radius（米）指定，日期格式为 20060102 或 2006-01-02；
+// 指定授权时查询该授权，指定客户时查询客户名下全部授权
+type ServiceGeoDTO struct {
+	ContainerID string   `form:"containerId"`
+	CustomerID  uint64   `form:"customerId"`
+	From        string   `form:"from"`
+	To          string   `form:"to"`
+	Box         string   `form:"bbox"`
+	Lon         *float64 `form:"lon"`
+	Lat         *float64 `form:"lat"`
+	Radius      float64  `form:"radius" binding:"gte=0"`
+}
+
+// ServiceGeoClusterDTO 按地图缩放级别聚合服务上报位置
+type ServiceGeoClusterDTO struct {
+	ServiceGeoDTO
+	Zoom int `form:"zoom" binding:"gte=0,lte=22"`
+}
+
+// GeoPointDTO 服务上报位置，按圆形范围查询时返回与圆心的距离（米）
+type GeoPointDTO struct {
+	ServiceAppUseInfoDTO
+	Distance *float64 `json:"distance,omitempty"`
+}
+
+// GeoClustersDTO 服务上报位置聚合结果
+type GeoClustersDTO struct {
+	Zoom     int           `json:"zoom"`
+	Total    int64         `json:"total"`
+	Clusters []geo.Cluster `json:"clusters"`
+}
+
+// Filter 将查询条件转换为位置筛选条件
+func (s *ServiceGeoDTO) Filter() (*model.GeoFilter, error) {
+	filter := &model.GeoFilter{}
+	if s.From != "" {
+		from, err := parseDay(s.From)
+		if err != nil {
+			return nil, errors.New("开始日期格式错误")
+		}
+		filter.From = &from
+	}
+	if s.To != "" {
+		to, err := parseDay(s.To)
+		if err != nil {
+			return nil, errors.New("结束日期格式错误")
+		}
+		to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		filter.To = &to
+	}
+
+	switch {
+	case s.Lon != nil || s.Lat != nil || s.Radius > 0:
+		if s.Lon == nil || s.Lat == nil || s.Radius <= 0 {
+			return nil, errors.New("按半径查询时经度、纬度及半径均不能为空")
+		}
+		center := geo.Point{Lon: *s.Lon, Lat: *s.Lat}
+		if !center.Valid() {
+			return nil, errors.New("经纬度超出范围")
+		}
+		filter.Center, filter.Radius = &center, s.Radius
+	case s.Box != "":
+		box, err := geo.ParseBox(s.Box)
+		if err != nil {
+			return nil, err
+		}
+		filter.Box = &box
+	}
+
+	switch {
+	case s.ContainerID != "":
+		license, err := model.GetLicense(s.ContainerID)
+		if err != nil {
+			return nil, errors.New("授权信息不存在")
+		}
+		filter.ServerAddrs = serverAddrsOf([]model.License{license})
+	case s.CustomerID != 0:
+		if _, err := model.GetCustomer(s.CustomerID); err != nil {
+			return nil, errors.New("客户不存在")
+		}
+		filter.ServerAddrs = serverAddrsOf(model.GetCustomerLicenses(s.CustomerID))
+	}
+	return filter, nil
+}
+
+// BoundedFilter 将查询条件转换为位置筛选条件并限定时间范围，用于需要读取范围内全部记录的聚合及导出；
+// 未指定日期时默认最近 30 天，最多 92 天
+func (s *ServiceGeoDTO) BoundedFilter() (*model.GeoFilter, error) {
+	filter, err := s.Filter()
+	if err != nil {
+		return nil, err
+	}
+	if filter.To == nil {
+		now := time.Now()
+		to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1).Add(-time.Nanosecond)
+		filter.To = &to
+	}
+	if filter.From == nil {
+		from := time.Date(filter.To.Year(), filter.To.Month(), filter.To.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1-defaultGeoDays)
+		filter.From = &from
+	}
+	if filter.From.After(*filter.To) {
+		return nil, errors.New("开始日期不能晚于结束日期")
+	}
+	if !filter.To.Before(filter.From.AddDate(0, 0, maxGeoDays)) {
+		return nil, fmt.Errorf("时间范围不能超过 %d 天", maxGeoDays)
+	}
+	return filter, nil
+}
+
+// GetPoints 分页查询范围内的服务上报位置，按上报时间倒序排列
+func (s *ServiceGeoDTO) GetPoints(page, size int) serializer.Response {
+	filter, err := s.Filter()
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	useInfos, total, err := model.GetAppUseInfosInArea(filter, page, size)
+	if err != nil {
+		return serializer.DBErr("位置查询失败", err)
+	}
+	res := make([]GeoPointDTO, 0, len(useInfos))
+	for i := range useInfos {
+		point := GeoPointDTO{ServiceAppUseInfoDTO: newUseInfoDTO(&useInfos[i])}
+		if filter.Center != nil {
+			distance := geo.Distance(*filter.Center, useInfos[i].Point())
+			point.Distance = &distance
+		}
+		res = append(res, point)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+// GetClusters 按地图缩放级别将范围内的服务上报位置聚合到网格，时间范围受 BoundedFilter 限制
+func (s *ServiceGeoClusterDTO) GetClusters() serializer.Response {
+	filter, err := s.BoundedFilter()
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	res := &GeoClustersDTO{Zoom: s.Zoom}
+	grid := geo.NewGrid(s.Zoom)
+	err = model.EachAppUseInfoInArea(filter, func(useInfo *model.AppUseInfo) error {
+		res.Total++
+		grid.Add(useInfo.Point(), useInfo.DeviceSN)
+		return nil
+	})
+	if err != nil {
+		return serializer.DBErr("位置查询失败", err)
+	}
+	res.Clusters = grid.Clusters()
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: res,
+	}
+}
+
+// Export 将范围内的服务上报位置导出为 GeoJSON FeatureCollection，设备及终端用户信息作为要素属性
+func (s *ServiceGeoDTO) Export(w io.Writer, filter *model.GeoFilter) error {
+	writer, err := geo.NewFeatureWriter(w)
+	if err != nil {
+		return err
+	}
+	err = model.EachAppUseInfoInArea(filter, func(useInfo *model.AppUseInfo) error {
+		return writer.Write(geo.NewFeature(useInfo.Point(), newUseInfoDTO(useInfo)))
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
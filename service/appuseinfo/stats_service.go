@@ -0,0 +1,113 @@
+package appuseinfo
+
+import (
+	"fmt"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/binding"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"strings"
+	"time"
+)
+
+// maxActivityDays 活跃统计单次查询的最大天数
+const maxActivityDays = 366
+
+// ServiceActivityDTO 活跃统计请求，日期格式为 20060102 或 2006-01-02，默认统计最近 30 天，最多 366 天；
+// 指定授权时统计该授权，指定客户时统计客户名下全部授权，均未指定时统计全部上报
+type ServiceActivityDTO struct {
+	ContainerID string `form:"containerId"`
+	CustomerID  uint64 `form:"customerId"`
+	From        string `form:"from"`
+	To          string `form:"to"`
+	Period      string `form:"period" binding:"omitempty,oneof=day week month"`
+	Dimension   string `form:"dimension" binding:"omitempty,oneof=platform version os_version device_vendor"`
+}
+
+// ActivityDTO 活跃统计结果
+type ActivityDTO struct {
+	ContainerID string               `json:"containerId,omitempty"`
+	CustomerID  uint64               `json:"customer_id,string,omitempty"`
+	From        string               `json:"from"`
+	To          string               `json:"to"`
+	Period      string               `json:"period"`
+	Dimension   string               `json:"dimension,omitempty"`
+	Stats       []model.ActivityStat `json:"stats"`
+}
+
+// GetActivity 按日、周或月统计活跃设备及终端用户，可按平台、版本、系统版本或设备厂商拆分
+func (s *ServiceActivityDTO) GetActivity() serializer.Response {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from, to := today.AddDate(0, 0, -29), today
+	var err error
+	if s.From != "" {
+		if from, err = parseDay(s.From); err != nil {
+			return serializer.ParamErr("开始日期格式错误", err)
+		}
+	}
+	if s.To != "" {
+		if to, err = parseDay(s.To); err != nil {
+			return serializer.ParamErr("结束日期格式错误", err)
+		}
+	}
+	if from.After(to) {
+		return serializer.ParamErr("开始日期不能晚于结束日期", nil)
+	}
+	if to.After(from.AddDate(0, 0, maxActivityDays-1)) {
+		return serializer.ParamErr(fmt.Sprintf("统计范围不能超过 %d 天", maxActivityDays), nil)
+	}
+	if s.Period == "" {
+		s.Period = model.PeriodDay
+	}
+
+	filter := &model.ActivityFilter{From: from, To: to.AddDate(0, 0, 1).Add(-time.Nanosecond)}
+	res := &ActivityDTO{
+		From:      from.Format(util.FORMAT_DATE_y4Md),
+		To:        to.Format(util.FORMAT_DATE_y4Md),
+		Period:    s.Period,
+		Dimension: s.Dimension,
+	}
+	switch {
+	case s.ContainerID != "":
+		license, err := model.GetLicense(s.ContainerID)
+		if err != nil {
+			return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+		}
+		res.ContainerID = license.ContainerID
+		filter.ServerAddrs = serverAddrsOf([]model.License{license})
+	case s.CustomerID != 0:
+		if _, err := model.GetCustomer(s.CustomerID); err != nil {
+			return serializer.Err(serializer.CodeNotFound, "客户不存在", err)
+		}
+		res.CustomerID = s.CustomerID
+		filter.ServerAddrs = serverAddrsOf(model.GetCustomerLicenses(s.CustomerID))
+	}
+
+	if res.Stats, err = model.GetActivityStats(filter, s.Period, s.Dimension); err != nil {
+		return serializer.DBErr("活跃统计查询失败", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: res,
+	}
+}
+
+// serverAddrsOf 返回命中授权任一绑定的已上报服务地址，没有命中时返回空切片而非 nil
+func serverAddrsOf(licenses []model.License) []string {
+	rules := make([]binding.Rule, 0)
+	for i := range licenses {
+		rules = append(rules, licenses[i].BindingRules()...)
+	}
+	addrs := model.GetServerAddrsMatching(rules)
+	if addrs == nil {
+		addrs = []string{}
+	}
+	return addrs
+}
+
+// parseDay 解析 20060102 或 2006-01-02 格式的日期
+func parseDay(value string) (time.Time, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), "-", "")
+	return time.ParseInLocation(util.FORMAT_DATE_y4Md, value, time.Local)
+}
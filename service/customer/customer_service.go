@@ -0,0 +1,156 @@
+package customer
+
+import (
+	"encoding/json"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"strings"
+	"time"
+)
+
+// ServiceCustomerDTO 客户信息
+type ServiceCustomerDTO struct {
+	ID       uint64          `json:"id,string"`
+	Name     string          `json:"name" binding:"required"`
+	Contacts []model.Contact `json:"contacts"`
+	Notes    string          `json:"notes"`
+	CRMID    string          `json:"crm_id"`
+	Licenses int64           `json:"licenses"`
+	Time     time.Time       `json:"time"`
+}
+
+// ServiceAssignDTO 授权归属客户请求，CustomerID 为 0 时取消归属
+type ServiceAssignDTO struct {
+	CustomerID   uint64   `json:"customer_id,string"`
+	ContainerIDs []string `json:"containerIds" binding:"required,min=1"`
+}
+
+// Create 新增客户
+func (s *ServiceCustomerDTO) Create() serializer.Response {
+	customer := &model.Customer{
+		Name:     strings.TrimSpace(s.Name),
+		Contacts: marshalContacts(s.Contacts),
+		Notes:    s.Notes,
+		CRMID:    s.CRMID,
+	}
+	if _, err := customer.Create(); err != nil {
+		return customerErr(err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: newCustomerDTO(customer, 0),
+	}
+}
+
+// Update 更新客户信息
+func (s *ServiceCustomerDTO) Update() serializer.Response {
+	customer, err := model.GetCustomer(s.ID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "客户不存在", err)
+	}
+	if err = customer.Update(map[string]interface{}{
+		"name":     strings.TrimSpace(s.Name),
+		"contacts": marshalContacts(s.Contacts),
+		"notes":    s.Notes,
+		"crm_id":   s.CRMID,
+	}); err != nil {
+		return customerErr(err)
+	}
+	return GetCustomer(s.ID)
+}
+
+// GetCustomer 查询客户信息
+func GetCustomer(id uint64) serializer.Response {
+	customer, err := model.GetCustomer(id)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "客户不存在", err)
+	}
+	counts := model.CountCustomerLicenses([]uint64{id})
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: newCustomerDTO(&customer, counts[id]),
+	}
+}
+
+// GetCustomers 分页查询客户
+func GetCustomers(page, size int, keyword string) serializer.Response {
+	customers, total := model.GetCustomers(page, size, strings.TrimSpace(keyword))
+	ids := make([]uint64, 0, len(customers))
+	for _, t := range customers {
+		ids = append(ids, t.ID)
+	}
+	counts := model.CountCustomerLicenses(ids)
+	res := make([]ServiceCustomerDTO, 0, len(customers))
+	for i := range customers {
+		res = append(res, *newCustomerDTO(&customers[i], counts[customers[i].ID]))
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+// Remove 删除客户
+func Remove(id uint64) serializer.Response {
+	if err := model.RemoveCustomer(id); err != nil {
+		return customerErr(err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+	}
+}
+
+// Assign 将授权归属到客户
+func (s *ServiceAssignDTO) Assign() serializer.Response {
+	if s.CustomerID != 0 {
+		if _, err := model.GetCustomer(s.CustomerID); err != nil {
+			return serializer.Err(serializer.CodeNotFound, "客户不存在", err)
+		}
+	}
+	count, err := model.AssignLicenses(s.CustomerID, s.ContainerIDs)
+	if err != nil {
+		return serializer.DBErr("授权归属更新失败", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: map[string]interface{}{
+			"updated": count,
+		},
+	}
+}
+
+func newCustomerDTO(customer *model.Customer, licenses int64) *ServiceCustomerDTO {
+	return &ServiceCustomerDTO{
+		ID:       customer.ID,
+		Name:     customer.Name,
+		Contacts: customer.GetContacts(),
+		Notes:    customer.Notes,
+		CRMID:    customer.CRMID,
+		Licenses: licenses,
+		Time:     customer.CreatedAt,
+	}
+}
+
+func marshalContacts(contacts []model.Contact) []byte {
+	if contacts == nil {
+		contacts = []model.Contact{}
+	}
+	raw, _ := json.Marshal(contacts)
+	return raw
+}
+
+// customerErr 将客户操作错误转换为返回信息
+func customerErr(err error) serializer.Response {
+	switch err {
+	case model.ErrCustomerExists:
+		return serializer.Err(serializer.CodeObjectExist, err.Error(), nil)
+	case model.ErrCustomerHasLicenses:
+		return serializer.Err(serializer.CodeNotFullySuccess, err.Error(), nil)
+	}
+	return serializer.DBErr("", err)
+}
@@ -0,0 +1,239 @@
+package license
+
+import (
+	"encoding/json"
+	"errors"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/actcode"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"strings"
+	"time"
+)
+
+// ServiceActivationDTO 批量生成激活码请求，MaxRedemptions 为 0 时默认只允许兑换一次，
+// ExpireAt 为激活码兑换截止日期，格式与 License.Expire 一致
+type ServiceActivationDTO struct {
+	Count          int                `json:"count" binding:"required,min=1,max=1000"`
+	Batch          string             `json:"batch" binding:"max=64"`
+	Plan           string             `json:"plan" binding:"required"`
+	Days           int                `json:"days" binding:"gte=0"`
+	MaxRedemptions int                `json:"max_redemptions" binding:"gte=0"`
+	ExpireAt       string             `json:"expire_at"`
+	CustomerID     uint64             `json:"customer_id,string"`
+	Entitlement    *model.Entitlement `json:"entitlement"`
+}
+
+// ServiceActivationListDTO 激活码列表筛选条件
+type ServiceActivationListDTO struct {
+	Batch  string `form:"batch"`
+	Plan   string `form:"plan"`
+	Status string `form:"status" binding:"omitempty,oneof=active revoked"`
+}
+
+// ServiceActivationRevokeDTO 作废激活码请求，未指定激活码时作废整个批次
+type ServiceActivationRevokeDTO struct {
+	Codes  []string `json:"codes"`
+	Batch  string   `json:"batch"`
+	Reason string   `json:"reason" binding:"required"`
+}
+
+// ActivationCodeDTO 激活码
+type ActivationCodeDTO struct {
+	Code           string             `json:"code"`
+	Batch          string             `json:"batch"`
+	Plan           string             `json:"plan"`
+	Days           int                `json:"days"`
+	MaxRedemptions int                `json:"max_redemptions"`
+	Redemptions    int                `json:"redemptions"`
+	CustomerID     uint64             `json:"customer_id,string"`
+	Entitlement    *model.Entitlement `json:"entitlement,omitempty"`
+	ExpireAt       *time.Time         `json:"expire_at"`
+	Revoked        bool               `json:"revoked"`
+	RevokeReason   string             `json:"revoke_reason,omitempty"`
+	Time           time.Time          `json:"time"`
+}
+
+// ActivationRedemptionDTO 激活码兑换记录
+type ActivationRedemptionDTO struct {
+	Code        string    `json:"code"`
+	ContainerID string    `json:"containerId"`
+	InstanceID  string    `json:"instance_id"`
+	RequestIP   string    `json:"request_ip"`
+	Expire      string    `json:"expire"`
+	Time        time.Time `json:"time"`
+}
+
+// Redeem 客户端提交激活码及容器信息，兑换成功后直接返回加签的可用授权
+func (s *SignLicense) Redeem(requestIP string) serializer.Response {
+	req, err := s.decode()
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	if req.ContainerID == "" || req.Name == "" {
+		return serializer.ParamErr("容器信息不能为空", nil)
+	}
+	code, err := model.GetActivationCode(req.ActivationCode)
+	if err != nil {
+		return activationErr(err)
+	}
+	// 兑换前预先校验客户端，避免兑换后校验失败而白白占用兑换次数
+	if license, err := model.GetLicense(req.ContainerID); err == nil {
+		if _, err = checkUsage(&license); err != nil {
+			return verifyErr(err)
+		}
+		if err = license.CheckVerify(&req.License, req.instance(), req.SeatID); err != nil {
+			return verifyErr(err)
+		}
+	}
+	if _, err = code.Redeem(&req.License, req.instance(), requestIP); err != nil {
+		return activationErr(err)
+	}
+	return verify(req)
+}
+
+// Create 批量生成激活码
+func (s *ServiceActivationDTO) Create(actor *model.User) serializer.Response {
+	template := &model.ActivationCode{
+		Batch:          strings.TrimSpace(s.Batch),
+		Plan:           s.Plan,
+		Days:           s.Days,
+		MaxRedemptions: s.MaxRedemptions,
+		CustomerID:     s.CustomerID,
+	}
+	if template.MaxRedemptions == 0 {
+		template.MaxRedemptions = 1
+	}
+	if template.Batch == "" {
+		template.Batch = time.Now().Format("20060102150405")
+	}
+	if s.ExpireAt != "" {
+		day, err := parseDate(s.ExpireAt)
+		if err != nil {
+			return serializer.ParamErr("激活码截止日期格式错误", err)
+		}
+		// 截止日期当天仍可兑换
+		expireAt, _ := time.ParseInLocation(util.FORMAT_DATE_y4Md, day, time.Local)
+		expireAt = expireAt.AddDate(0, 0, 1).Add(-time.Second)
+		template.ExpireAt = &expireAt
+	}
+	if s.Entitlement != nil {
+		template.Entitlement, _ = json.Marshal(normalizeEntitlement(*s.Entitlement))
+	}
+	if actor != nil {
+		template.Creator = actor.ID
+	}
+
+	codes, err := model.CreateActivationCodes(template, s.Count)
+	if err != nil {
+		return serializer.DBErr("激活码生成失败", err)
+	}
+	res := make([]ActivationCodeDTO, 0, len(codes))
+	for i := range codes {
+		res = append(res, *newActivationCodeDTO(&codes[i]))
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: res,
+	}
+}
+
+// GetCodes 分页查询激活码
+func (s *ServiceActivationListDTO) GetCodes(page, size int) serializer.Response {
+	filter := &model.ActivationFilter{Batch: s.Batch, Plan: s.Plan}
+	if s.Status != "" {
+		revoked := s.Status == "revoked"
+		filter.Revoked = &revoked
+	}
+	codes, total := model.GetActivationCodes(page, size, filter)
+	res := make([]ActivationCodeDTO, 0, len(codes))
+	for i := range codes {
+		res = append(res, *newActivationCodeDTO(&codes[i]))
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+// Revoke 作废激活码
+func (s *ServiceActivationRevokeDTO) Revoke() serializer.Response {
+	if len(s.Codes) == 0 && s.Batch == "" {
+		return serializer.ParamErr("激活码或批次不能为空", nil)
+	}
+	count, err := model.RevokeActivationCodes(s.Codes, s.Batch, s.Reason)
+	if err != nil {
+		return serializer.DBErr("激活码作废失败", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: count,
+	}
+}
+
+// GetActivationRedemptions 分页查询激活码兑换记录
+func GetActivationRedemptions(code string, page, size int) serializer.Response {
+	redemptions, total := model.GetActivationRedemptions(code, page, size)
+	res := make([]ActivationRedemptionDTO, 0, len(redemptions))
+	for _, t := range redemptions {
+		res = append(res, ActivationRedemptionDTO{
+			Code:        actcode.Format(t.Code),
+			ContainerID: t.ContainerID,
+			InstanceID:  t.InstanceID,
+			RequestIP:   t.RequestIP,
+			Expire:      t.Expire,
+			Time:        t.CreatedAt,
+		})
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+func newActivationCodeDTO(code *model.ActivationCode) *ActivationCodeDTO {
+	dto := &ActivationCodeDTO{
+		Code:           actcode.Format(code.Code),
+		Batch:          code.Batch,
+		Plan:           code.Plan,
+		Days:           code.Days,
+		MaxRedemptions: code.MaxRedemptions,
+		Redemptions:    code.Redemptions,
+		CustomerID:     code.CustomerID,
+		ExpireAt:       code.ExpireAt,
+		Revoked:        code.Revoked,
+		RevokeReason:   code.RevokeReason,
+		Time:           code.CreatedAt,
+	}
+	if len(code.Entitlement) > 0 {
+		dto.Entitlement = &model.Entitlement{}
+		_ = json.Unmarshal(code.Entitlement, dto.Entitlement)
+	}
+	return dto
+}
+
+// activationErr 将激活码兑换错误转换为返回信息
+func activationErr(err error) serializer.Response {
+	for _, target := range []error{
+		model.ErrCodeInvalid, model.ErrCodeExpired, model.ErrCodeRevoked,
+		model.ErrCodeExhausted, model.ErrCodeRedeemed,
+	} {
+		if errors.Is(err, target) {
+			return serializer.Err(serializer.CodeActivationDenied, err.Error(), nil)
+		}
+	}
+	if errors.Is(err, model.ErrTransitionNotAllowed) {
+		return serializer.Err(serializer.CodeActivationDenied, "授权状态不允许兑换激活码", nil)
+	}
+	return serializer.DBErr("激活码兑换失败", err)
+}
@@ -0,0 +1,68 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/binding"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+)
+
+// ServiceBindingDTO 授权绑定请求，Bindings 支持 IP、CIDR、域名及 *. 开头的通配域名
+type ServiceBindingDTO struct {
+	ContainerID string   `json:"containerId" binding:"required"`
+	Bindings    []string `json:"bindings"`
+}
+
+// BindingConflictDTO 与其他授权冲突的绑定
+type BindingConflictDTO struct {
+	ContainerID string `json:"containerId"`
+	Kind        string `json:"kind"`
+	Value       string `json:"value"`
+}
+
+// SetBindings 替换授权的全部绑定
+func (s *ServiceBindingDTO) SetBindings() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	rules, err := binding.ParseAll(s.Bindings)
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	if conflicts := model.FindBindingConflicts(rules, s.ContainerID); len(conflicts) > 0 {
+		return bindingConflictErr(conflicts)
+	}
+	if err = license.SetBindings(rules); err != nil {
+		return serializer.DBErr("授权绑定更新失败", err)
+	}
+	return s.GetBindings()
+}
+
+// GetBindings 查询授权的全部绑定
+func (s *ServiceBindingDTO) GetBindings() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: license.BindingRules(),
+	}
+}
+
+// bindingConflictErr 返回冲突的绑定及其所属授权
+func bindingConflictErr(conflicts []model.LicenseBinding) serializer.Response {
+	res := make([]BindingConflictDTO, 0, len(conflicts))
+	for _, t := range conflicts {
+		res = append(res, BindingConflictDTO{
+			ContainerID: t.ContainerID,
+			Kind:        t.Kind,
+			Value:       t.Value,
+		})
+	}
+	return serializer.Response{
+		Code: serializer.CodeNotFullySuccess,
+		Msg:  "绑定与其他授权存在冲突",
+		Data: res,
+	}
+}
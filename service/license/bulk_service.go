@@ -0,0 +1,497 @@
+package license
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/binding"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"github.com/zhouqiaokeji/server/pkg/xlsx"
+	"gorm.io/gorm"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatCSV CSV 格式
+	FormatCSV = "csv"
+	// FormatXLSX XLSX 格式
+	FormatXLSX = "xlsx"
+
+	// exportPageSize 导出时每次查询的授权数量
+	exportPageSize = 500
+	// importMaxSize 导入文件大小上限
+	importMaxSize = 10 << 20
+	// bindingSeparator 绑定列中多条规则的分隔符
+	bindingSeparator = ";"
+)
+
+const (
+	importCreate    = "create"
+	importUpdate    = "update"
+	importUnchanged = "unchanged"
+	importError     = "error"
+)
+
+// exportColumns 导出列，导入时只识别前五列，其余列忽略
+var exportColumns = []string{"container_id", "name", "status", "expire", "bindings", "last_online_time", "created_at"}
+
+// utf8BOM 便于 Excel 正确识别 CSV 中的中文
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ServiceLicenseExportDTO 授权批量导出请求，筛选条件与授权列表一致
+type ServiceLicenseExportDTO struct {
+	ServiceLicenseListDTO
+	Format string `form:"format" json:"format" binding:"required,oneof=csv xlsx"`
+}
+
+// ServiceLicenseImportDTO 授权批量导入请求，DryRun 为 true 时只校验并返回变更预览
+type ServiceLicenseImportDTO struct {
+	Format string `form:"format" json:"format" binding:"omitempty,oneof=csv xlsx"`
+	DryRun bool   `form:"dry_run" json:"dry_run"`
+}
+
+// ImportRowDTO 单行导入结果，Row 为文件中的行号
+type ImportRowDTO struct {
+	Row         int      `json:"row"`
+	ContainerID string   `json:"containerId"`
+	Action      string   `json:"action"`
+	Changes     []string `json:"changes,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// ImportResultDTO 导入结果；存在错误行时不会写入任何数据
+type ImportResultDTO struct {
+	DryRun    bool           `json:"dry_run"`
+	Applied   bool           `json:"applied"`
+	Total     int            `json:"total"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Failed    int            `json:"failed"`
+	Rows      []ImportRowDTO `json:"rows"`
+}
+
+// rowWriter 导出行写入器
+type rowWriter interface {
+	Write(record []string) error
+	Close() error
+}
+
+type csvRowWriter struct {
+	*csv.Writer
+}
+
+func (w csvRowWriter) Close() error {
+	w.Flush()
+	return w.Error()
+}
+
+// ContentType 导出文件的 MIME 类型
+func (s *ServiceLicenseExportDTO) ContentType() string {
+	if s.Format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Filter 校验并返回导出的筛选条件
+func (s *ServiceLicenseExportDTO) Filter() (*model.LicenseFilter, error) {
+	return s.filter()
+}
+
+// Export 按筛选条件分批查询授权并流式写出
+func (s *ServiceLicenseExportDTO) Export(w io.Writer, filter *model.LicenseFilter) error {
+	var (
+		writer rowWriter
+		err    error
+	)
+	if s.Format == FormatXLSX {
+		if writer, err = xlsx.NewWriter(w); err != nil {
+			return err
+		}
+	} else {
+		if _, err = w.Write(utf8BOM); err != nil {
+			return err
+		}
+		writer = csvRowWriter{csv.NewWriter(w)}
+	}
+
+	if err = writer.Write(exportColumns); err != nil {
+		return err
+	}
+	for page := 1; ; page++ {
+		licenses, _ := model.GetLicenses(page, exportPageSize, "created_at asc", filter)
+		for i := range licenses {
+			if err = writer.Write(exportRow(&licenses[i])); err != nil {
+				return err
+			}
+		}
+		if len(licenses) < exportPageSize {
+			break
+		}
+	}
+	return writer.Close()
+}
+
+func exportRow(license *model.License) []string {
+	rules := license.BindingRules()
+	bindings := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		bindings = append(bindings, rule.Value)
+	}
+	row := []string{
+		license.ContainerID,
+		license.Name,
+		license.Status.String(),
+		license.Expire,
+		strings.Join(bindings, bindingSeparator),
+		license.LastOnlineTime,
+		license.CreatedAt.Format(util.FORMAT_DATETIME_Y4MDHMS),
+	}
+	// 名称、绑定等由客户端上报，避免被表格软件当作公式执行
+	for i := range row {
+		row[i] = util.CSVCell(row[i])
+	}
+	return row
+}
+
+// importRow 解析后的导入行，空白单元格表示不修改
+type importRow struct {
+	result   *ImportRowDTO
+	license  *model.License
+	name     string
+	status   *model.Status
+	expire   string
+	rules    []binding.Rule
+	bindings bool
+}
+
+// Import 校验导入文件中的每一行，全部通过且非预览模式时写入
+func (s *ServiceLicenseImportDTO) Import(file *multipart.FileHeader, actor *model.User) serializer.Response {
+	records, err := s.read(file)
+	if err != nil {
+		return serializer.ParamErr("无法解析导入文件", err)
+	}
+	rows, err := parseImportRows(records)
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+
+	res := &ImportResultDTO{DryRun: s.DryRun, Total: len(rows), Rows: make([]ImportRowDTO, 0, len(rows))}
+	for _, row := range rows {
+		switch row.result.Action {
+		case importCreate:
+			res.Created++
+		case importUpdate:
+			res.Updated++
+		case importUnchanged:
+			res.Unchanged++
+		default:
+			res.Failed++
+		}
+	}
+
+	// 全部行在同一事务中写入，任一行失败时整体回滚
+	if res.Failed == 0 && !s.DryRun {
+		err = model.DB.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				if err := row.apply(tx, actor); err != nil {
+					row.fail(err.Error())
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			res.Failed++
+		} else {
+			res.Applied = true
+		}
+	}
+	for _, row := range rows {
+		res.Rows = append(res.Rows, *row.result)
+	}
+
+	if res.Failed > 0 {
+		return serializer.Response{
+			Code: serializer.CodeNotFullySuccess,
+			Msg:  fmt.Sprintf("%d 行导入失败", res.Failed),
+			Data: res,
+		}
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: res,
+	}
+}
+
+// read 读取上传文件的全部行，未指定格式时按扩展名判断
+func (s *ServiceLicenseImportDTO) read(file *multipart.FileHeader) ([][]string, error) {
+	if file.Size > importMaxSize {
+		return nil, errors.New("导入文件过大")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	format := s.Format
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+	}
+	switch format {
+	case FormatXLSX:
+		return xlsx.ReadAll(bytes.NewReader(content), int64(len(content)))
+	case FormatCSV:
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, utf8BOM)))
+		reader.FieldsPerRecord = -1
+		return reader.ReadAll()
+	}
+	return nil, errors.New("不支持的文件格式")
+}
+
+// parseImportRows 按表头解析并校验全部数据行
+func parseImportRows(records [][]string) ([]*importRow, error) {
+	if len(records) == 0 {
+		return nil, errors.New("导入文件为空")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["container_id"]; !ok {
+		return nil, errors.New("导入文件缺少 container_id 列")
+	}
+	cell := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var (
+		rows       = make([]*importRow, 0, len(records)-1)
+		containers = make(map[string]int)
+		today      = time.Now().Format(util.FORMAT_DATE_y4Md)
+	)
+	for i, record := range records[1:] {
+		if isBlank(record) {
+			continue
+		}
+		row := &importRow{
+			result: &ImportRowDTO{Row: i + 2, ContainerID: cell(record, "container_id")},
+			name:   cell(record, "name"),
+		}
+		rows = append(rows, row)
+		row.parse(record, cell, today)
+
+		containerID := row.result.ContainerID
+		if containerID == "" {
+			continue
+		}
+		if line, ok := containers[containerID]; ok {
+			row.fail(fmt.Sprintf("与第 %d 行的 container_id 重复", line))
+			continue
+		}
+		containers[containerID] = row.result.Row
+	}
+
+	checkImportConflicts(rows)
+	for _, row := range rows {
+		if len(row.result.Errors) > 0 {
+			row.result.Action = importError
+			row.result.Changes = nil
+		}
+	}
+	return rows, nil
+}
+
+// parse 校验单行并计算相对现有授权的变更
+func (row *importRow) parse(record []string, cell func([]string, string) string, today string) {
+	if row.result.ContainerID == "" {
+		row.fail("container_id 不能为空")
+		return
+	}
+	if value := cell(record, "status"); value != "" {
+		status, ok := model.ParseStatus(value)
+		if !ok {
+			row.fail("无效的状态: " + value)
+		}
+		row.status = &status
+	}
+	if value := cell(record, "expire"); value != "" {
+		expire, err := parseDate(value)
+		if err != nil {
+			row.fail("无效的有效期: " + value)
+		}
+		row.expire = expire
+	}
+	if value := cell(record, "bindings"); value != "" {
+		rules, err := binding.ParseAll(strings.Split(value, bindingSeparator))
+		if err != nil {
+			row.fail("无效的绑定: " + value)
+		}
+		row.rules, row.bindings = rules, true
+	}
+
+	license, err := model.GetLicense(row.result.ContainerID)
+	if err != nil {
+		row.result.Action = importCreate
+		if row.name == "" {
+			row.fail("新建授权时 name 不能为空")
+		}
+		if row.expire != "" && row.expire <= today {
+			row.fail("有效期须晚于今天")
+		}
+		row.result.Changes = append(row.result.Changes, "name: "+row.name)
+		// 新建授权处于待审核状态，按状态变更规则转换到指定状态
+		if row.status != nil && *row.status != model.StatusPending && !model.StatusPending.CanTransit(*row.status) {
+			row.fail(fmt.Sprintf("状态不允许从 %s 变更为 %s", model.StatusPending, *row.status))
+		}
+		if row.status != nil {
+			row.result.Changes = append(row.result.Changes, "status: "+row.status.String())
+		}
+		if row.expire != "" {
+			row.result.Changes = append(row.result.Changes, "expire: "+row.expire)
+		}
+		if row.bindings {
+			row.result.Changes = append(row.result.Changes, "bindings: "+strings.Join(ruleValues(row.rules), bindingSeparator))
+		}
+		return
+	}
+
+	row.license = &license
+	row.result.Action = importUnchanged
+	if row.name != "" && row.name != license.Name {
+		row.fail("name 与已有授权不一致")
+	}
+	if row.status != nil && *row.status != license.Status {
+		if !license.Status.CanTransit(*row.status) {
+			row.fail(fmt.Sprintf("状态不允许从 %s 变更为 %s", license.Status, *row.status))
+		}
+		row.change(fmt.Sprintf("status: %s -> %s", license.Status, *row.status))
+	}
+	if row.expire != "" && row.expire != license.Expire {
+		// 与续期接口一致，从当前有效期结束处或今天开始续接
+		start := today
+		if !license.Expired() && license.Expire > start {
+			start = license.Expire
+		}
+		if row.expire <= start {
+			row.fail("有效期不能早于当前有效期或今天")
+		}
+		row.change(fmt.Sprintf("expire: %s -> %s", license.Expire, row.expire))
+	}
+	if row.bindings {
+		current := ruleValues(license.BindingRules())
+		next := ruleValues(row.rules)
+		if strings.Join(current, bindingSeparator) != strings.Join(next, bindingSeparator) {
+			row.change(fmt.Sprintf("bindings: %s -> %s", strings.Join(current, bindingSeparator), strings.Join(next, bindingSeparator)))
+		}
+	}
+}
+
+// checkImportConflicts 检查绑定与数据库中其他授权及文件中其他行的冲突
+func checkImportConflicts(rows []*importRow) {
+	for i, row := range rows {
+		if !row.bindings || row.result.ContainerID == "" {
+			continue
+		}
+		for _, conflict := range model.FindBindingConflicts(row.rules, row.result.ContainerID) {
+			row.fail(fmt.Sprintf("绑定 %s 与授权 %s 冲突", conflict.Value, conflict.ContainerID))
+		}
+		for _, other := range rows[:i] {
+			if !other.bindings || other.result.ContainerID == row.result.ContainerID {
+				continue
+			}
+			for _, rule := range row.rules {
+				for _, existing := range other.rules {
+					if rule.Overlaps(existing) {
+						row.fail(fmt.Sprintf("绑定 %s 与第 %d 行的 %s 冲突", rule.Value, other.result.Row, existing.Value))
+					}
+				}
+			}
+		}
+	}
+}
+
+// apply 在导入事务中写入单行变更，新建的授权以待审核状态创建后再变更状态并记录历史
+func (row *importRow) apply(tx *gorm.DB, actor *model.User) error {
+	const reason = "批量导入"
+	switch row.result.Action {
+	case importCreate:
+		license := &model.License{
+			Name:        row.name,
+			ContainerID: row.result.ContainerID,
+			Status:      model.StatusPending,
+		}
+		if err := license.CreateTx(tx); err != nil {
+			return err
+		}
+		row.license = license
+	case importUpdate:
+		// 已有授权仅写入变更的列
+	default:
+		return nil
+	}
+
+	if row.status != nil && *row.status != row.license.Status {
+		if err := row.license.TransitionTx(tx, *row.status, reason, actor); err != nil {
+			return err
+		}
+	}
+	if row.expire != "" && row.expire != row.license.Expire {
+		// 与续期接口一致，从当前有效期结束处或今天开始续接
+		term := &model.LicenseTerm{Start: time.Now().Format(util.FORMAT_DATE_y4Md), End: row.expire, Plan: "import"}
+		if !row.license.Expired() && row.license.Expire > term.Start {
+			term.Start = row.license.Expire
+		}
+		if err := row.license.RenewTx(tx, term, actor); err != nil {
+			return err
+		}
+	}
+	if row.bindings {
+		return row.license.SetBindingsTx(tx, row.rules)
+	}
+	return nil
+}
+
+func (row *importRow) fail(msg string) {
+	row.result.Errors = append(row.result.Errors, msg)
+}
+
+func (row *importRow) change(msg string) {
+	row.result.Changes = append(row.result.Changes, msg)
+	row.result.Action = importUpdate
+}
+
+func ruleValues(rules []binding.Rule) []string {
+	values := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		values = append(values, rule.Value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
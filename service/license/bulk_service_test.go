@@ -0,0 +1,49 @@
+package license
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	model "github.com/zhouqiaokeji/server/models"
+)
+
+func TestExportRow(t *testing.T) {
+	asserts := assert.New(t)
+	license := &model.License{
+		Name:           "=HYPERLINK(\"http://evil\",\"click\")",
+		ContainerID:    "TestExportRow",
+		Status:         model.StatusActive,
+		Domain:         "export.bulk.test",
+		LastOnlineTime: "@now",
+	}
+	if _, err := license.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 以公式字符开头的单元格添加单引号前缀
+	row := exportRow(license)
+	asserts.Equal("TestExportRow", row[0])
+	asserts.Equal("'=HYPERLINK(\"http://evil\",\"click\")", row[1])
+	asserts.Equal("export.bulk.test", row[4])
+	asserts.Equal("'@now", row[5])
+
+	// 写出的 CSV 中同样转义
+	var buf bytes.Buffer
+	service := &ServiceLicenseExportDTO{Format: FormatCSV}
+	filter, err := service.Filter()
+	asserts.NoError(err)
+	asserts.NoError(service.Export(&buf, filter))
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(buf.Bytes(), utf8BOM))).ReadAll()
+	asserts.NoError(err)
+	asserts.Equal(exportColumns, records[0])
+	found := false
+	for _, record := range records[1:] {
+		if record[0] == "TestExportRow" {
+			found = true
+			asserts.Equal("'=HYPERLINK(\"http://evil\",\"click\")", record[1])
+		}
+	}
+	asserts.True(found)
+}
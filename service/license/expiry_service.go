@@ -0,0 +1,49 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"time"
+)
+
+// ServiceExpiryEventDTO 授权到期事件查询请求
+type ServiceExpiryEventDTO struct {
+	ContainerID string `form:"id" json:"containerId"`
+}
+
+// ExpiryEventDTO 授权到期事件
+type ExpiryEventDTO struct {
+	ContainerID string    `json:"containerId"`
+	Name        string    `json:"name"`
+	Expire      string    `json:"expire"`
+	Threshold   int       `json:"threshold"`
+	DaysLeft    int       `json:"days_left"`
+	Expired     bool      `json:"expired"`
+	Time        time.Time `json:"time"`
+}
+
+// GetEvents 分页查询授权到期事件
+func (s *ServiceExpiryEventDTO) GetEvents(page, size int) serializer.Response {
+	events, total := model.GetLicenseExpiryEvents(s.ContainerID, page, size)
+	res := make([]ExpiryEventDTO, 0, len(events))
+	for _, t := range events {
+		res = append(res, ExpiryEventDTO{
+			ContainerID: t.ContainerID,
+			Name:        t.Name,
+			Expire:      t.Expire,
+			Threshold:   t.Threshold,
+			DaysLeft:    t.DaysLeft,
+			Expired:     t.Threshold == 0,
+			Time:        t.CreatedAt,
+		})
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
@@ -0,0 +1,59 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/licfile"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"time"
+)
+
+// Export 导出离线授权文件，并记录签发人与签发时间
+func (s *ServiceLicenseDTO) Export(issuer *model.User) ([]byte, error) {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return nil, serializer.NewError(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if !license.Status.Usable() {
+		return nil, serializer.NewError(serializer.CodeNotFullySuccess, "授权未启用，无法导出", nil)
+	}
+
+	payload := &licfile.Payload{
+		Name:        license.Name,
+		ContainerID: license.ContainerID,
+		Status:      int(license.Status),
+		Expire:      license.Expire,
+		IP:          license.IP,
+		Domain:      license.Domain,
+		Entitlement: licfile.Entitlement(license.GetEntitlement()),
+		Revision:    license.Revision,
+		IssuedAt:    time.Now(),
+	}
+	for _, rule := range license.BindingRules() {
+		payload.Bindings = append(payload.Bindings, rule.Value)
+	}
+	if payload.Expired() {
+		return nil, serializer.NewError(serializer.CodeNotFullySuccess, "授权已过期，无法导出", nil)
+	}
+	content, err := licfile.Sign(payload)
+	if err != nil {
+		util.Log().Error(err.Error())
+		return nil, serializer.NewError(serializer.CodeEncryptError, "授权文件签发失败", err)
+	}
+
+	record := &model.LicenseFile{
+		LicenseID:   license.ID,
+		ContainerID: license.ContainerID,
+		IssuedAt:    payload.IssuedAt,
+		Expire:      payload.Expire,
+		Version:     payload.Version,
+	}
+	if issuer != nil {
+		record.Creator = issuer.ID
+		record.IssuerName = issuer.UserName
+	}
+	if _, err := record.Create(); err != nil {
+		return nil, serializer.NewError(serializer.CodeDBError, "签发记录保存失败", err)
+	}
+	return content, nil
+}
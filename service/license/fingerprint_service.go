@@ -0,0 +1,72 @@
+package license
+
+import (
+	"encoding/json"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"time"
+)
+
+// ServiceFingerprintDTO 硬件指纹重置/重新登记请求
+type ServiceFingerprintDTO struct {
+	ContainerID string             `json:"containerId" binding:"required"`
+	Fingerprint *model.Fingerprint `json:"fingerprint"`
+}
+
+// FingerprintMismatchDTO 硬件指纹不匹配记录
+type FingerprintMismatchDTO struct {
+	ContainerID string                    `json:"containerId"`
+	InstanceID  string                    `json:"instance_id"`
+	Matched     int                       `json:"matched"`
+	Total       int                       `json:"total"`
+	Accepted    bool                      `json:"accepted"`
+	Changes     []model.FingerprintChange `json:"changes"`
+	Time        time.Time                 `json:"time"`
+}
+
+// Enroll 重置硬件指纹，未提供指纹时清除登记，由客户端下次激活时重新登记
+func (s *ServiceFingerprintDTO) Enroll() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = license.EnrollFingerprint(s.Fingerprint); err != nil {
+		return serializer.DBErr("硬件指纹登记失败", err)
+	}
+	fingerprint := license.GetFingerprint()
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &ServiceFingerprintDTO{
+			ContainerID: license.ContainerID,
+			Fingerprint: &fingerprint,
+		},
+	}
+}
+
+// GetMismatches 分页查询硬件指纹不匹配记录
+func (s *ServiceFingerprintDTO) GetMismatches(page, size int) serializer.Response {
+	mismatches, total := model.GetFingerprintMismatches(s.ContainerID, page, size)
+	res := make([]FingerprintMismatchDTO, 0, len(mismatches))
+	for _, t := range mismatches {
+		var changes []model.FingerprintChange
+		_ = json.Unmarshal(t.Changes, &changes)
+		res = append(res, FingerprintMismatchDTO{
+			ContainerID: t.ContainerID,
+			InstanceID:  t.InstanceID,
+			Matched:     t.Matched,
+			Total:       t.Total,
+			Accepted:    t.Accepted,
+			Changes:     changes,
+			Time:        t.CreatedAt,
+		})
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
@@ -0,0 +1,24 @@
+package license
+
+import (
+	"github.com/zhouqiaokeji/server/pkg/rsa"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+)
+
+// GetPublicKeys 返回所有可用于验签的公钥及当前签名密钥ID
+func GetPublicKeys() serializer.Response {
+	keys := rsa.Ring.PublicKeys()
+	signing := ""
+	for _, key := range keys {
+		if key.Signing {
+			signing = key.Kid
+		}
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: map[string]interface{}{
+			"keys":    keys,
+			"signing": signing,
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"time"
+)
+
+// ServiceLeaseDTO 授权租约续期/释放请求
+type ServiceLeaseDTO struct {
+	ContainerID string     `json:"containerId" binding:"required"`
+	LeaseID     string     `json:"leaseId" binding:"required"`
+	InstanceID  string     `json:"instanceId"`
+	LeaseExpire *time.Time `json:"leaseExpire,omitempty"`
+	LeaseTTL    int        `json:"leaseTtl,omitempty"`
+}
+
+// Heartbeat 续期授权租约，并返回加签的租约信息
+func (s *ServiceLeaseDTO) Heartbeat() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if !license.Status.Usable() || license.Expired() {
+		return serializer.Err(serializer.CodeCheckLogin, "授权已失效", nil)
+	}
+	if err = license.RenewLease(s.LeaseID, s.instance()); err != nil {
+		return leaseErr(err)
+	}
+	return signResponse(&ServiceLeaseDTO{
+		ContainerID: license.ContainerID,
+		LeaseID:     license.LeaseID,
+		InstanceID:  license.LeaseInstance,
+		LeaseExpire: license.LeaseExpire,
+		LeaseTTL:    conf.LicenseConfig.LeaseTTL,
+	})
+}
+
+// Release 客户端停止时释放授权租约
+func (s *ServiceLeaseDTO) Release() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = license.ReleaseLease(s.LeaseID, s.instance()); err != nil {
+		return leaseErr(err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+	}
+}
+
+// instance 返回客户端实例标识，未上报时以容器ID代替
+func (s *ServiceLeaseDTO) instance() string {
+	if s.InstanceID != "" {
+		return s.InstanceID
+	}
+	return s.ContainerID
+}
+
+func leaseErr(err error) serializer.Response {
+	if err == model.ErrLeaseInvalid {
+		return serializer.Err(serializer.CodeLicenseLeaseInvalid, err.Error(), nil)
+	}
+	return serializer.DBErr("", err)
+}
@@ -6,110 +6,100 @@ import (
 	"errors"
 	"fmt"
 	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/binding"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/replay"
 	"github.com/zhouqiaokeji/server/pkg/rsa"
 	"github.com/zhouqiaokeji/server/pkg/serializer"
 	"github.com/zhouqiaokeji/server/pkg/util"
+	"strings"
 	"time"
 )
 
 type ServiceLicenseAuthDTO struct {
-	Name        string       `json:"name"`
-	ContainerID string       `json:"containerId" `
-	Status      model.Status `json:"status"`
+	Name        string            `json:"name"`
+	ContainerID string            `json:"containerId" `
+	Status      model.Status      `json:"status"`
+	Expire      string            `json:"expire"`
+	Entitlement model.Entitlement `json:"entitlement"`
+	Revision    int               `json:"revision"`
+	Seats       int               `json:"seats,omitempty"`
+	LeaseID     string            `json:"leaseId,omitempty"`
+	LeaseExpire *time.Time        `json:"leaseExpire,omitempty"`
+	LeaseTTL    int               `json:"leaseTtl,omitempty"`
+	Nonce       string            `json:"nonce,omitempty"`
+	OverCap     bool              `json:"overCap,omitempty"`
 }
 type ServiceLicenseDTO struct {
-	Name        string       `json:"name"`
-	ContainerID string       `json:"containerId" binding:"required"`
-	Status      model.Status `json:"status"`
-	IP          string       `json:"ip" `
-	Domain      string       `json:"domain" `
-	Expire      string       `json:"expire"`
-	Time        time.Time    `json:"time" `
+	Name        string             `json:"name"`
+	ContainerID string             `json:"containerId" binding:"required"`
+	Status      model.Status       `json:"status"`
+	IP          string             `json:"ip" `
+	Domain      string             `json:"domain" `
+	Expire      string             `json:"expire"`
+	Entitlement *model.Entitlement `json:"entitlement,omitempty"`
+	Bindings    []binding.Rule     `json:"bindings,omitempty"`
+	CustomerID  uint64             `json:"customer_id,string"`
+	Customer    string             `json:"customer,omitempty"`
+	Seats       int                `json:"seats"`
+	Revision    int                `json:"revision"`
+	Time        time.Time          `json:"time" `
 }
 
 type SignLicense struct {
+	rsa.Envelope
 	Key  string `json:"key" binding:"required"`
 	Info string `json:"info" binding:"required"`
 }
 
+// licenseRequest 客户端提交的授权请求明文
+type licenseRequest struct {
+	model.License
+	replay.Guard
+	InstanceID string `json:"instanceId"`
+	// 浮动授权签出的席位
+	SeatID string `json:"seatId"`
+	// 自助迁移时的原容器ID及迁移原因
+	FromContainerID string `json:"fromContainerId"`
+	Reason          string `json:"reason"`
+	// 兑换激活码时提交的激活码
+	ActivationCode string `json:"activationCode"`
+}
+
+// instance 返回客户端实例标识，旧版客户端未上报时以容器ID代替
+func (r *licenseRequest) instance() string {
+	if r.InstanceID != "" {
+		return r.InstanceID
+	}
+	return r.ContainerID
+}
+
 // Create 新增并返回加密授权信息
 func (s *SignLicense) Create() serializer.Response {
-	var (
-		data []byte
-		err  error
-	)
-	license, err := s.decode()
-	license.Status = model.Disabled
-	if model.CheckExistByContainer(nil, license.ContainerID) {
-		verifyLicense, _ := model.GetLicense(license.ContainerID)
-		res, err := verifyLicense.Verify(license)
-		if err != nil {
-			return serializer.Response{
-				Code: serializer.CodeCheckLogin,
-				Data: "非法授权认证",
-			}
-		}
-		if data, err = json.Marshal(&ServiceLicenseAuthDTO{
-			Name:        res.Name,
-			ContainerID: res.ContainerID,
-			Status:      res.Status,
-		}); err != nil {
-			util.Log().Error(err.Error())
-		}
-		return serializer.Response{
-			Code: serializer.OK,
-			Data: map[string]interface{}{
-				"sign": rsa.SignRSA(data),
-				"data": string(data),
-			},
-		}
+	req, err := s.decode()
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
 	}
-	_, _ = license.Create()
-	if data, err = json.Marshal(&ServiceLicenseAuthDTO{
-		Name:        license.Name,
-		ContainerID: license.ContainerID,
-		Status:      license.Status,
-	}); err != nil {
-		util.Log().Error(err.Error())
+	license := &req.License
+	license.Status = model.StatusPending
+	if model.CheckExistByContainer(nil, license.ContainerID) {
+		return verify(req)
 	}
-	return serializer.Response{
-		Code: serializer.OK,
-		Data: map[string]interface{}{
-			"sign": rsa.SignRSA(data),
-			"data": string(data),
-		},
+	if _, err = license.Create(); err != nil {
+		return serializer.DBErr("授权信息保存失败", err)
 	}
+	return signResponse(newLicenseAuthDTO(license).withNonce(req.Nonce))
 }
 
-// Verify 校验授权信息
+// Verify 校验授权信息，校验通过后为客户端实例分配授权租约
 func (s *SignLicense) Verify() serializer.Response {
-	var (
-		data []byte
-	)
-	license, _ := s.decode()
+	req, err := s.decode()
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	license := &req.License
 	if model.CheckExistByContainer(nil, license.ContainerID) {
-		verifyLicense, _ := model.GetLicense(license.ContainerID)
-		res, err := verifyLicense.Verify(license)
-		if err != nil {
-			return serializer.Response{
-				Code: serializer.CodeCheckLogin,
-				Data: "非法授权认证",
-			}
-		}
-		if data, err = json.Marshal(&ServiceLicenseAuthDTO{
-			Name:        res.Name,
-			ContainerID: res.ContainerID,
-			Status:      res.Status,
-		}); err != nil {
-			util.Log().Error(err.Error())
-		}
-		return serializer.Response{
-			Code: serializer.OK,
-			Data: map[string]interface{}{
-				"sign": rsa.SignRSA(data),
-				"data": string(data),
-			},
-		}
+		return verify(req)
 	}
 	return serializer.Response{
 		Code: serializer.CodeCheckLogin,
@@ -117,14 +107,18 @@ func (s *SignLicense) Verify() serializer.Response {
 	}
 }
 
-// UpdateLicense 更新授权信息
-func (s *ServiceLicenseDTO) UpdateLicense() serializer.Response {
-	license := model.License{
-		Name:        s.Name,
-		ContainerID: s.ContainerID,
-		IP:          s.IP,
-		Domain:      s.Domain,
-		Expire:      s.Expire,
+// UpdateLicense 为授权追加 IP、域名绑定并更新有效期，绑定以绑定表为准
+func (s *ServiceLicenseDTO) UpdateLicense(actor *model.User) serializer.Response {
+	rules := make([]binding.Rule, 0, 2)
+	for _, value := range []string{s.IP, s.Domain} {
+		if value == "" {
+			continue
+		}
+		rule, err := binding.Parse(value)
+		if err != nil {
+			return serializer.ParamErr(err.Error(), err)
+		}
+		rules = append(rules, rule)
 	}
 	if model.CheckExistIpOrDomain(s.IP, "", s.ContainerID) {
 		return serializer.Err(serializer.CodeNotFullySuccess, "IP 已绑定服务", nil)
@@ -132,69 +126,230 @@ func (s *ServiceLicenseDTO) UpdateLicense() serializer.Response {
 	if model.CheckExistIpOrDomain("", s.Domain, s.ContainerID) {
 		return serializer.Err(serializer.CodeNotFullySuccess, "域名 已绑定服务", nil)
 	}
-	updateLicense, _ := model.GetLicense(s.ContainerID)
-	updateLicense.Update(license)
+	updateLicense, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	// 先更新有效期，有效期不合法时不做任何修改
+	if s.Expire != "" && s.Expire != updateLicense.Expire {
+		if err = updateLicense.SetExpire(s.Expire, actor); err != nil {
+			if err == model.ErrInvalidTerm {
+				return serializer.ParamErr("有效期格式错误或不晚于当天", err)
+			}
+			return serializer.DBErr("授权有效期更新失败", err)
+		}
+	}
+	if err = updateLicense.AddBindings(rules); err != nil {
+		return serializer.DBErr("授权绑定更新失败", err)
+	}
 	return serializer.Response{
 		Code: serializer.OK,
 		Data: s,
 	}
 }
 
-// UpdateLicenseStatus 更新授权状态
-func (s *ServiceLicenseDTO) UpdateLicenseStatus() serializer.Response {
-	updateLicense, _ := model.GetLicense(s.ContainerID)
-	updateLicense.UpdateStatus(s.Status)
+// UpdateEntitlement 更新授权权益
+func (s *ServiceLicenseDTO) UpdateEntitlement() serializer.Response {
+	if s.Entitlement == nil {
+		return serializer.ParamErr("授权权益不能为空", nil)
+	}
+	updateLicense, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = updateLicense.UpdateEntitlement(normalizeEntitlement(*s.Entitlement)); err != nil {
+		return serializer.DBErr("授权权益更新失败", err)
+	}
 	return serializer.Response{
 		Code: serializer.OK,
-		Data: s,
+		Data: newLicenseDTO(&updateLicense),
 	}
 }
 
-// GetLicense 分页查询授权信息
-func (s *ServiceLicenseDTO) GetLicense(name string, page, size int, order string) serializer.Response {
-	licenses, total := model.GetLicenses(page, size, order, name)
-	res := make([]ServiceLicenseDTO, 0, len(licenses))
-	for _, t := range licenses {
-		res = append(res, ServiceLicenseDTO{
-			Name:        t.Name,
-			ContainerID: t.ContainerID,
-			Status:      t.Status,
-			IP:          t.IP,
-			Domain:      t.Domain,
-			Time:        t.CreatedAt,
-		})
+// GetInfo 查询授权详情
+func (s *ServiceLicenseDTO) GetInfo() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
 	}
+	res := newLicenseDTO(&license)
+	res.Bindings = license.BindingRules()
 	return serializer.Response{
 		Code: serializer.OK,
-		Data: &serializer.Page{
-			Total:   total,
-			Content: res,
-			Page:    page,
-			Size:    size,
-		},
+		Data: res,
 	}
 }
 
 // Remove 删除授权信息
 func (s *ServiceLicenseDTO) Remove(key string) serializer.Response {
-	model.Remove(key)
+	if err := model.Remove(key); err != nil {
+		return serializer.DBErr("授权删除失败", err)
+	}
 	return serializer.Response{
 		Code: serializer.OK,
 	}
 }
 
-func (s *SignLicense) decode() (*model.License, error) {
-	var err error
-	licenseStr := rsa.BcryptRSA(s.Info)
-	key := fmt.Sprintf("%x", md5.Sum([]byte(licenseStr)))
+func (s *SignLicense) decode() (*licenseRequest, error) {
+	plainText, err := s.Open(s.Info)
+	if err != nil {
+		return nil, err
+	}
+	licenseStr := string(plainText)
+	key := fmt.Sprintf("%x", md5.Sum(plainText))
 	if s.Key != key {
 		return nil, errors.New("信息校验失败")
 	}
-	license := &model.License{}
-	if err = json.Unmarshal([]byte(licenseStr), &license); err != nil {
+	req := &licenseRequest{}
+	if err = json.Unmarshal([]byte(licenseStr), req); err != nil {
 		util.Log().Error(err.Error())
 		return nil, errors.New("信息解析失败")
 	}
+	if err = req.Check("license"); err != nil {
+		return nil, err
+	}
+	// 客户端只能提交容器信息，状态、权益、席位、客户、用量及租约等仅允许服务端设置
+	fingerprint := req.GetFingerprint()
+	req.License = model.License{
+		Name:        req.Name,
+		ContainerID: req.ContainerID,
+		IP:          req.IP,
+		Domain:      req.Domain,
+		Expire:      req.Expire,
+	}
+	// 规范化客户端上报的硬件指纹
+	if !fingerprint.IsEmpty() {
+		req.Fingerprint, _ = json.Marshal(&fingerprint)
+	}
+
+	return req, nil
+}
+
+// verify 校验已存在的授权并记录用量，超出每月用量上限时按策略标记或拒绝
+func verify(req *licenseRequest) serializer.Response {
+	verifyLicense, _ := model.GetLicense(req.ContainerID)
+	overCap, err := checkUsage(&verifyLicense)
+	if err != nil {
+		return verifyErr(err)
+	}
+	res, err := verifyLicense.Verify(&req.License, req.instance(), req.SeatID)
+	if err != nil {
+		return verifyErr(err)
+	}
+	res.RecordVerify(req.instance())
+	dto := newLicenseAuthDTO(res).withNonce(req.Nonce)
+	dto.OverCap = overCap
+	return signResponse(dto)
+}
+
+// signResponse 使用签名密钥对返回数据加签，并附带密钥ID
+func signResponse(v interface{}) serializer.Response {
+	data, err := json.Marshal(v)
+	if err != nil {
+		util.Log().Error(err.Error())
+	}
+	sign, kid := rsa.SignRSAWithKid(data)
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: map[string]interface{}{
+			"sign": sign,
+			"kid":  kid,
+			"data": string(data),
+		},
+	}
+}
+
+// verifyErr 将授权校验错误转换为返回信息
+func verifyErr(err error) serializer.Response {
+	if errors.Is(err, model.ErrLeaseHeld) {
+		return serializer.Err(serializer.CodeLicenseLeaseHeld, err.Error(), nil)
+	}
+	if errors.Is(err, model.ErrUsageCapExceeded) {
+		return serializer.Err(serializer.CodeLicenseUsageCapExceeded, err.Error(), nil)
+	}
+	if errors.Is(err, model.ErrFingerprintMismatch) {
+		return serializer.Err(serializer.CodeLicenseFingerprintMismatch, err.Error(), nil)
+	}
+	if errors.Is(err, model.ErrSeatRequired) {
+		return serializer.Err(serializer.CodeLicenseSeatRequired, err.Error(), nil)
+	}
+	if errors.Is(err, model.ErrSeatInvalid) {
+		return serializer.Err(serializer.CodeLicenseLeaseInvalid, err.Error(), nil)
+	}
+	return serializer.Response{
+		Code: serializer.CodeCheckLogin,
+		Data: "非法授权认证",
+	}
+}
+
+func newLicenseAuthDTO(license *model.License) *ServiceLicenseAuthDTO {
+	dto := &ServiceLicenseAuthDTO{
+		Name:        license.Name,
+		ContainerID: license.ContainerID,
+		Status:      license.Status,
+		Expire:      license.Expire,
+		Entitlement: license.GetEntitlement(),
+		Revision:    license.Revision,
+		Seats:       license.Seats,
+	}
+	if license.LeaseID != "" {
+		dto.LeaseID = license.LeaseID
+		dto.LeaseExpire = license.LeaseExpire
+		dto.LeaseTTL = conf.LicenseConfig.LeaseTTL
+	}
+	return dto
+}
+
+// withNonce 回显客户端请求中的随机数
+func (dto *ServiceLicenseAuthDTO) withNonce(nonce string) *ServiceLicenseAuthDTO {
+	dto.Nonce = nonce
+	return dto
+}
+
+func newLicenseDTO(license *model.License) *ServiceLicenseDTO {
+	entitlement := license.GetEntitlement()
+	return &ServiceLicenseDTO{
+		Name:        license.Name,
+		ContainerID: license.ContainerID,
+		Status:      license.Status,
+		IP:          license.IP,
+		Domain:      license.Domain,
+		Expire:      license.Expire,
+		Entitlement: &entitlement,
+		Revision:    license.Revision,
+		CustomerID:  license.CustomerID,
+		Seats:       license.Seats,
+		Time:        license.CreatedAt,
+	}
+}
+
+// newLicenseDTOs 批量转换授权信息并填充客户名称
+func newLicenseDTOs(licenses []model.License) []ServiceLicenseDTO {
+	ids := make([]uint64, 0, len(licenses))
+	for i := range licenses {
+		if licenses[i].CustomerID != 0 {
+			ids = append(ids, licenses[i].CustomerID)
+		}
+	}
+	customers := model.GetCustomersByIDs(ids)
+	res := make([]ServiceLicenseDTO, 0, len(licenses))
+	for i := range licenses {
+		dto := newLicenseDTO(&licenses[i])
+		dto.Customer = customers[licenses[i].CustomerID].Name
+		res = append(res, *dto)
+	}
+	return res
+}
 
-	return license, nil
+// normalizeEntitlement 去除空白及重复的功能开关
+func normalizeEntitlement(entitlement model.Entitlement) model.Entitlement {
+	features := make([]string, 0, len(entitlement.Features))
+	for _, feature := range entitlement.Features {
+		feature = strings.TrimSpace(feature)
+		if feature != "" && !util.ContainsString(features, feature) {
+			features = append(features, feature)
+		}
+	}
+	entitlement.Features = features
+	return entitlement
 }
@@ -0,0 +1,61 @@
+package license
+
+import (
+	"crypto/md5"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/rsa"
+)
+
+// sealRequest 按客户端方式加密授权请求明文
+func sealRequest(t *testing.T, plainText string) *SignLicense {
+	envelope, cipherTexts, err := rsa.SealEnvelope(testPublicPem, []byte(plainText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SignLicense{
+		Envelope: *envelope,
+		Key:      fmt.Sprintf("%x", md5.Sum([]byte(plainText))),
+		Info:     cipherTexts[0],
+	}
+}
+
+func TestSignLicense_decode(t *testing.T) {
+	asserts := assert.New(t)
+	window := conf.LicenseConfig.ReplayWindow
+	defer func() { conf.LicenseConfig.ReplayWindow = window }()
+	conf.LicenseConfig.ReplayWindow = 0
+
+	// 客户端提交的服务端字段一律忽略
+	req, err := sealRequest(t, `{"name":"app","containerId":"decode","ip":"10.0.0.1","domain":"app.example",
+		"expire":"20300101","status":1,"seats":5,"customer_id":42,"usage_cap":100,"usage_policy":"refuse",
+		"retention":7,"last_online_time":"2026-01-01","revision":9,"entitlement":{"features":["all"]},
+		"fingerprint":{"machineId":"m1"},"instanceId":"i1"}`).decode()
+	asserts.NoError(err)
+	asserts.Equal("app", req.Name)
+	asserts.Equal("decode", req.ContainerID)
+	asserts.Equal("10.0.0.1", req.IP)
+	asserts.Equal("app.example", req.Domain)
+	asserts.Equal("20300101", req.Expire)
+	asserts.Equal("i1", req.InstanceID)
+	asserts.Equal("m1", req.GetFingerprint().MachineID)
+	asserts.Zero(req.Status)
+	asserts.Zero(req.Seats)
+	asserts.Zero(req.CustomerID)
+	asserts.Zero(req.UsageCap)
+	asserts.Empty(req.UsagePolicy)
+	asserts.Zero(req.Retention)
+	asserts.Empty(req.LastOnlineTime)
+	asserts.Zero(req.Revision)
+	asserts.Empty(req.Entitlement)
+	asserts.False(req.Floating())
+
+	// 校验值不匹配
+	sign := sealRequest(t, `{"containerId":"decode"}`)
+	sign.Key = "bad"
+	_, err = sign.decode()
+	asserts.Error(err)
+}
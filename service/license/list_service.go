@@ -0,0 +1,175 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServiceLicenseListDTO 授权列表查询条件；Status 为逗号分隔的状态值，CustomerID 为 0 时查询未归属客户的授权，
+// 有效期支持 20060102 或 2006-01-02，在线及创建时间支持日期或日期时间
+type ServiceLicenseListDTO struct {
+	Name           string `form:"name" json:"name"`
+	CustomerID     string `form:"customer_id" json:"customer_id"`
+	Status         string `form:"status" json:"status"`
+	ExpireFrom     string `form:"expire_from" json:"expire_from"`
+	ExpireTo       string `form:"expire_to" json:"expire_to"`
+	ExpiringWithin int    `form:"expiring_within" json:"expiring_within" binding:"gte=0"`
+	Addr           string `form:"addr" json:"addr"`
+	OnlineFrom     string `form:"online_from" json:"online_from"`
+	OnlineTo       string `form:"online_to" json:"online_to"`
+	CreatedFrom    string `form:"created_from" json:"created_from"`
+	CreatedTo      string `form:"created_to" json:"created_to"`
+	Order          string `form:"order" json:"order"`
+	Group          string `form:"group" json:"group" binding:"omitempty,oneof=customer"`
+}
+
+// CustomerLicensesDTO 按客户分组的授权
+type CustomerLicensesDTO struct {
+	CustomerID   uint64              `json:"customer_id,string"`
+	CustomerName string              `json:"customer_name"`
+	Total        int64               `json:"total"`
+	Licenses     []ServiceLicenseDTO `json:"licenses"`
+}
+
+// GetLicenses 按条件分页查询授权信息
+func (s *ServiceLicenseListDTO) GetLicenses(page, size int) serializer.Response {
+	filter, err := s.filter()
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	if s.Group == "customer" {
+		return s.groupByCustomer(page, size, filter)
+	}
+	licenses, total := model.GetLicenses(page, size, s.Order, filter)
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: newLicenseDTOs(licenses),
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+// groupByCustomer 按客户分组分页返回授权，未归属客户的授权分组ID为 0
+func (s *ServiceLicenseListDTO) groupByCustomer(page, size int, filter *model.LicenseFilter) serializer.Response {
+	groups, total := model.GetLicenseCustomerGroups(page, size, filter)
+	ids := make([]uint64, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.CustomerID)
+	}
+	customers := model.GetCustomersByIDs(ids)
+
+	res := make([]CustomerLicensesDTO, 0, len(groups))
+	for _, group := range groups {
+		customerID := group.CustomerID
+		groupFilter := *filter
+		groupFilter.CustomerID = &customerID
+		licenses, _ := model.GetLicenses(1, int(group.Total), s.Order, &groupFilter)
+		res = append(res, CustomerLicensesDTO{
+			CustomerID:   group.CustomerID,
+			CustomerName: customers[group.CustomerID].Name,
+			Total:        group.Total,
+			Licenses:     newLicenseDTOs(licenses),
+		})
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+// filter 转换为模型筛选条件
+func (s *ServiceLicenseListDTO) filter() (*model.LicenseFilter, error) {
+	filter := &model.LicenseFilter{
+		Name:           strings.TrimSpace(s.Name),
+		ExpiringWithin: s.ExpiringWithin,
+		Addr:           strings.TrimSpace(s.Addr),
+	}
+	for _, value := range strings.Split(s.Status, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		status, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		filter.Status = append(filter.Status, model.Status(status))
+	}
+
+	if s.CustomerID != "" {
+		// 0 表示未归属客户的授权
+		customerID, err := strconv.ParseUint(s.CustomerID, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		filter.CustomerID = &customerID
+	}
+
+	var err error
+	if filter.ExpireFrom, err = parseDate(s.ExpireFrom); err != nil {
+		return nil, err
+	}
+	if filter.ExpireTo, err = parseDate(s.ExpireTo); err != nil {
+		return nil, err
+	}
+	if from, err := parseTime(s.OnlineFrom, false); err != nil {
+		return nil, err
+	} else if from != nil {
+		filter.OnlineFrom = from.Format(util.FORMAT_DATETIME_Y4MDHMS)
+	}
+	if to, err := parseTime(s.OnlineTo, true); err != nil {
+		return nil, err
+	} else if to != nil {
+		filter.OnlineTo = to.Format(util.FORMAT_DATETIME_Y4MDHMS)
+	}
+	if filter.CreatedFrom, err = parseTime(s.CreatedFrom, false); err != nil {
+		return nil, err
+	}
+	if filter.CreatedTo, err = parseTime(s.CreatedTo, true); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseDate 将日期规范化为 License.Expire 格式
+func parseDate(value string) (string, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), "-", "")
+	if value == "" {
+		return "", nil
+	}
+	if _, err := time.Parse(util.FORMAT_DATE_y4Md, value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// parseTime 解析日期或日期时间，仅有日期且作为区间结束时取当天结束时间
+func parseTime(value string, end bool) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation(util.FORMAT_DATETIME_Y4MDHMS, value, time.Local)
+	if err == nil {
+		return &t, nil
+	}
+	t, err = time.ParseInLocation(util.FORMAT_DATETIME_y4Md, value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return &t, nil
+}
@@ -0,0 +1,33 @@
+package license
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/cache"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/id"
+	"github.com/zhouqiaokeji/server/pkg/rsa"
+)
+
+// testPublicPem 测试密钥环的签名公钥
+var testPublicPem string
+
+// 测试使用内存数据库、内存缓存及临时生成的密钥环
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	id.Init()
+	conf.SystemConfig.Debug = true
+	cache.Store = cache.NewMemoStore()
+	model.Init()
+
+	rsa.Ring = rsa.NewKeyRing()
+	if err := rsa.Ring.Generate(rsa.DefaultKeyID, 1024); err != nil {
+		panic(err)
+	}
+	_ = rsa.Ring.SetSigning(rsa.DefaultKeyID)
+	testPublicPem = rsa.Ring.PublicKeys()[0].Pem
+	os.Exit(m.Run())
+}
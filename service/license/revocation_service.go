@@ -0,0 +1,64 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"time"
+)
+
+// revocationPageSize 单次返回的吊销列表条目上限
+const revocationPageSize = 500
+
+// ServiceRevocationDTO 吊销列表拉取请求
+type ServiceRevocationDTO struct {
+	Since uint64 `form:"since" json:"since"`
+}
+
+// RevocationEntryDTO 吊销列表条目
+type RevocationEntryDTO struct {
+	Seq         uint64    `json:"seq"`
+	ContainerID string    `json:"containerId"`
+	Action      string    `json:"action"`
+	State       string    `json:"state"`
+	Reason      string    `json:"reason"`
+	RevokedAt   time.Time `json:"revoked_at"`
+}
+
+// RevocationListDTO 吊销列表，Seq 为本次返回的最大序号，客户端下次以此作为 since 拉取；
+// More 为 true 时表示仍有未返回的条目，Latest 小于 since 时客户端应从 0 重新拉取
+type RevocationListDTO struct {
+	Since    uint64               `json:"since"`
+	Seq      uint64               `json:"seq"`
+	Latest   uint64               `json:"latest"`
+	More     bool                 `json:"more"`
+	Entries  []RevocationEntryDTO `json:"entries"`
+	IssuedAt int64                `json:"issued_at"`
+}
+
+// GetRevocations 返回序号大于 since 的吊销列表并签名
+func (s *ServiceRevocationDTO) GetRevocations() serializer.Response {
+	revocations := model.GetRevocationsSince(s.Since, revocationPageSize+1)
+	res := &RevocationListDTO{
+		Since:    s.Since,
+		Seq:      s.Since,
+		Latest:   model.GetRevocationSeq(),
+		Entries:  make([]RevocationEntryDTO, 0, len(revocations)),
+		IssuedAt: time.Now().Unix(),
+	}
+	if len(revocations) > revocationPageSize {
+		revocations = revocations[:revocationPageSize]
+		res.More = true
+	}
+	for _, t := range revocations {
+		res.Entries = append(res.Entries, RevocationEntryDTO{
+			Seq:         t.Seq,
+			ContainerID: t.ContainerID,
+			Action:      t.Action,
+			State:       t.Status.String(),
+			Reason:      t.Reason,
+			RevokedAt:   t.RevokedAt,
+		})
+		res.Seq = t.Seq
+	}
+	return signResponse(res)
+}
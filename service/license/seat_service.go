@@ -0,0 +1,185 @@
+package license
+
+import (
+	"errors"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"time"
+)
+
+// ServiceSeatDTO 浮动授权席位续期/签入请求
+type ServiceSeatDTO struct {
+	ContainerID string     `json:"containerId" binding:"required"`
+	SeatID      string     `json:"seatId" binding:"required"`
+	InstanceID  string     `json:"instanceId" binding:"required"`
+	Slot        int        `json:"slot"`
+	Seats       int        `json:"seats,omitempty"`
+	Expire      *time.Time `json:"expire,omitempty"`
+	TTL         int        `json:"ttl,omitempty"`
+	Nonce       string     `json:"nonce,omitempty"`
+}
+
+// ServiceSeatsDTO 浮动授权席位设置
+type ServiceSeatsDTO struct {
+	ContainerID string `json:"containerId" binding:"required"`
+	Seats       int    `json:"seats" binding:"gte=0"`
+}
+
+// SeatHolderDTO 席位持有实例
+type SeatHolderDTO struct {
+	Slot       int        `json:"slot"`
+	InstanceID string     `json:"instanceId"`
+	CheckoutAt *time.Time `json:"checkout_at"`
+	Expire     *time.Time `json:"expire"`
+}
+
+// SeatUsageDTO 浮动授权席位占用情况
+type SeatUsageDTO struct {
+	ContainerID string          `json:"containerId"`
+	Seats       int             `json:"seats"`
+	InUse       int             `json:"in_use"`
+	Holders     []SeatHolderDTO `json:"holders"`
+}
+
+// Checkout 客户端签出浮动授权席位，并返回加签的席位信息
+func (s *SignLicense) Checkout() serializer.Response {
+	req, err := s.decode()
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	if req.InstanceID == "" {
+		return serializer.ParamErr("签出席位需提供实例ID", nil)
+	}
+	license, err := model.GetLicense(req.ContainerID)
+	if err != nil || license.Name != req.Name {
+		return serializer.Err(serializer.CodeCheckLogin, "非法授权认证", err)
+	}
+	if !license.Status.Usable() || license.Expired() {
+		return serializer.Err(serializer.CodeCheckLogin, "授权已失效", nil)
+	}
+	seat, err := license.CheckoutSeat(req.InstanceID)
+	if err != nil {
+		return seatErr(&license, err)
+	}
+	res := newSeatDTO(&license, seat)
+	res.Nonce = req.Nonce
+	return signResponse(res)
+}
+
+// Renew 续期浮动授权席位，并返回加签的席位信息
+func (s *ServiceSeatDTO) Renew() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if !license.Status.Usable() || license.Expired() {
+		return serializer.Err(serializer.CodeCheckLogin, "授权已失效", nil)
+	}
+	seat, err := license.RenewSeat(s.SeatID, s.InstanceID)
+	if err != nil {
+		return seatErr(&license, err)
+	}
+	return signResponse(newSeatDTO(&license, seat))
+}
+
+// Checkin 客户端停止使用时签入席位
+func (s *ServiceSeatDTO) Checkin() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = license.CheckinSeat(s.SeatID, s.InstanceID); err != nil {
+		return seatErr(&license, err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+	}
+}
+
+// SetSeats 设置浮动授权席位数，0 表示恢复为按容器绑定的授权
+func (s *ServiceSeatsDTO) SetSeats() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = license.SetSeats(s.Seats); err != nil {
+		return serializer.DBErr("授权席位设置失败", err)
+	}
+	return s.GetSeats()
+}
+
+// GetSeats 查询浮动授权席位占用情况
+func (s *ServiceSeatsDTO) GetSeats() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: newSeatUsageDTO(&license, license.GetSeatHolders()),
+	}
+}
+
+// ReleaseSeats 强制释放浮动授权的全部席位
+func (s *ServiceSeatsDTO) ReleaseSeats() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = license.ReleaseSeats(); err != nil {
+		return serializer.DBErr("授权席位释放失败", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+	}
+}
+
+func newSeatDTO(license *model.License, seat *model.LicenseSeat) *ServiceSeatDTO {
+	return &ServiceSeatDTO{
+		ContainerID: license.ContainerID,
+		SeatID:      seat.SeatID,
+		InstanceID:  seat.InstanceID,
+		Slot:        seat.Slot,
+		Seats:       license.Seats,
+		Expire:      seat.Expire,
+		TTL:         conf.LicenseConfig.LeaseTTL,
+	}
+}
+
+func newSeatUsageDTO(license *model.License, seats []model.LicenseSeat) *SeatUsageDTO {
+	holders := make([]SeatHolderDTO, 0, len(seats))
+	for _, t := range seats {
+		holders = append(holders, SeatHolderDTO{
+			Slot:       t.Slot,
+			InstanceID: t.InstanceID,
+			CheckoutAt: t.CheckoutAt,
+			Expire:     t.Expire,
+		})
+	}
+	return &SeatUsageDTO{
+		ContainerID: license.ContainerID,
+		Seats:       license.Seats,
+		InUse:       len(holders),
+		Holders:     holders,
+	}
+}
+
+// seatErr 将席位错误转换为返回信息，席位占满时返回当前持有实例
+func seatErr(license *model.License, err error) serializer.Response {
+	var inUse *model.SeatsInUseError
+	if errors.As(err, &inUse) {
+		return serializer.Response{
+			Code: serializer.CodeLicenseSeatsInUse,
+			Msg:  err.Error(),
+			Data: newSeatUsageDTO(license, inUse.Holders),
+		}
+	}
+	if err == model.ErrSeatInvalid {
+		return serializer.Err(serializer.CodeLicenseLeaseInvalid, err.Error(), nil)
+	}
+	if err == model.ErrNotFloating {
+		return serializer.ParamErr(err.Error(), nil)
+	}
+	return serializer.DBErr("", err)
+}
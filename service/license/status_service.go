@@ -0,0 +1,94 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"time"
+)
+
+// ServiceLicenseStatusDTO 授权状态变更请求
+type ServiceLicenseStatusDTO struct {
+	ContainerID string       `json:"containerId" binding:"required"`
+	Status      model.Status `json:"status"`
+	Reason      string       `json:"reason" binding:"required"`
+}
+
+// LicenseStateDTO 授权当前状态及允许的后续操作
+type LicenseStateDTO struct {
+	ContainerID string                  `json:"containerId"`
+	Status      model.Status            `json:"status"`
+	State       string                  `json:"state"`
+	Actions     map[string]model.Status `json:"actions"`
+}
+
+// LicenseHistoryDTO 授权状态变更历史
+type LicenseHistoryDTO struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason"`
+	ActorName string    `json:"actor_name"`
+	Time      time.Time `json:"time"`
+}
+
+// UpdateLicenseStatus 按生命周期变更授权状态
+func (s *ServiceLicenseStatusDTO) UpdateLicenseStatus(actor *model.User) serializer.Response {
+	updateLicense, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = updateLicense.Transition(s.Status, s.Reason, actor); err != nil {
+		if err == model.ErrTransitionNotAllowed || err == model.ErrReasonRequired {
+			return serializer.Err(serializer.CodeNotFullySuccess, err.Error(), nil)
+		}
+		return serializer.DBErr("授权状态变更失败", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: newLicenseStateDTO(&updateLicense),
+	}
+}
+
+// GetState 查询授权当前状态及允许的后续操作
+func (s *ServiceLicenseStatusDTO) GetState() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: newLicenseStateDTO(&license),
+	}
+}
+
+// GetHistories 分页查询授权状态变更历史
+func (s *ServiceLicenseStatusDTO) GetHistories(page, size int) serializer.Response {
+	histories, total := model.GetLicenseHistories(s.ContainerID, page, size)
+	res := make([]LicenseHistoryDTO, 0, len(histories))
+	for _, t := range histories {
+		res = append(res, LicenseHistoryDTO{
+			From:      t.From.String(),
+			To:        t.To.String(),
+			Reason:    t.Reason,
+			ActorName: t.ActorName,
+			Time:      t.CreatedAt,
+		})
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+func newLicenseStateDTO(license *model.License) *LicenseStateDTO {
+	return &LicenseStateDTO{
+		ContainerID: license.ContainerID,
+		Status:      license.Status,
+		State:       license.Status.String(),
+		Actions:     license.Status.Actions(),
+	}
+}
@@ -0,0 +1,107 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"time"
+)
+
+// ServiceRenewDTO 授权续期请求；未指定开始日期时从当前有效期结束处续接，
+// 已过期时从当天开始；未指定结束日期时按 Days 天数顺延
+type ServiceRenewDTO struct {
+	ContainerID string `json:"containerId" binding:"required"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	Days        int    `json:"days" binding:"gte=0"`
+	Plan        string `json:"plan" binding:"required"`
+	OrderRef    string `json:"order_ref"`
+}
+
+// LicenseTermDTO 授权期限
+type LicenseTermDTO struct {
+	Start    string    `json:"start"`
+	End      string    `json:"end"`
+	Plan     string    `json:"plan"`
+	OrderRef string    `json:"order_ref"`
+	Adjust   bool      `json:"adjust"`
+	Time     time.Time `json:"time"`
+}
+
+// LicenseTermsDTO 授权期限历史及当前有效期
+type LicenseTermsDTO struct {
+	ContainerID string           `json:"containerId"`
+	Expire      string           `json:"expire"`
+	State       string           `json:"state"`
+	Terms       []LicenseTermDTO `json:"terms"`
+}
+
+// Renew 为授权追加期限
+func (s *ServiceRenewDTO) Renew(actor *model.User) serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+
+	term := &model.LicenseTerm{
+		Start:    s.Start,
+		End:      s.End,
+		Plan:     s.Plan,
+		OrderRef: s.OrderRef,
+	}
+	if term.Start == "" {
+		term.Start = time.Now().Format(util.FORMAT_DATE_y4Md)
+		if !license.Expired() && license.Expire > term.Start {
+			term.Start = license.Expire
+		}
+	}
+	if term.End == "" && s.Days > 0 {
+		if start, err := time.Parse(util.FORMAT_DATE_y4Md, term.Start); err == nil {
+			term.End = start.AddDate(0, 0, s.Days).Format(util.FORMAT_DATE_y4Md)
+		}
+	}
+
+	if err = license.Renew(term, actor); err != nil {
+		if err == model.ErrInvalidTerm {
+			return serializer.ParamErr(err.Error(), nil)
+		}
+		return serializer.DBErr("授权续期失败", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: newLicenseTermsDTO(&license),
+	}
+}
+
+// GetTerms 查询授权期限历史
+func (s *ServiceRenewDTO) GetTerms() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: newLicenseTermsDTO(&license),
+	}
+}
+
+func newLicenseTermsDTO(license *model.License) *LicenseTermsDTO {
+	terms := model.GetLicenseTerms(license.ContainerID)
+	res := &LicenseTermsDTO{
+		ContainerID: license.ContainerID,
+		Expire:      license.Expire,
+		State:       license.Status.String(),
+		Terms:       make([]LicenseTermDTO, 0, len(terms)),
+	}
+	for _, t := range terms {
+		res.Terms = append(res.Terms, LicenseTermDTO{
+			Start:    t.Start,
+			End:      t.End,
+			Plan:     t.Plan,
+			OrderRef: t.OrderRef,
+			Adjust:   t.Adjust,
+			Time:     t.CreatedAt,
+		})
+	}
+	return res
+}
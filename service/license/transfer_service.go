@@ -0,0 +1,119 @@
+package license
+
+import (
+	"errors"
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/conf"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"time"
+)
+
+// ServiceTransferDTO 管理员迁移授权请求
+type ServiceTransferDTO struct {
+	ContainerID string `json:"containerId" binding:"required"`
+	Target      string `json:"target" binding:"required,nefield=ContainerID"`
+	Reason      string `json:"reason" binding:"required"`
+}
+
+// LicenseTransferDTO 授权迁移记录
+type LicenseTransferDTO struct {
+	FromContainer string    `json:"from_container"`
+	ToContainer   string    `json:"to_container"`
+	ActorName     string    `json:"actor_name"`
+	Reason        string    `json:"reason"`
+	SelfService   bool      `json:"self_service"`
+	Time          time.Time `json:"time"`
+}
+
+// Transfer 将授权迁移到新的容器ID，不受自助迁移次数限制
+func (s *ServiceTransferDTO) Transfer(actor *model.User) serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = license.Transfer(s.Target, s.Reason, actor, false); err != nil {
+		return transferErr(err)
+	}
+	res := newLicenseDTO(&license)
+	res.Bindings = license.BindingRules()
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: res,
+	}
+}
+
+// GetTransfers 分页查询授权迁移记录
+func (s *ServiceTransferDTO) GetTransfers(page, size int) serializer.Response {
+	transfers, total := model.GetLicenseTransfers(s.ContainerID, page, size)
+	res := make([]LicenseTransferDTO, 0, len(transfers))
+	for _, t := range transfers {
+		res = append(res, LicenseTransferDTO{
+			FromContainer: t.FromContainer,
+			ToContainer:   t.ToContainer,
+			ActorName:     t.ActorName,
+			Reason:        t.Reason,
+			SelfService:   t.SelfService,
+			Time:          t.CreatedAt,
+		})
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &serializer.Page{
+			Total:   total,
+			Content: res,
+			Page:    page,
+			Size:    size,
+		},
+	}
+}
+
+// Transfer 客户端自助迁移：将原容器的授权迁移到当前容器，并为当前实例分配租约
+func (s *SignLicense) Transfer() serializer.Response {
+	req, err := s.decode()
+	if err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+	if req.FromContainerID == "" || req.FromContainerID == req.ContainerID {
+		return serializer.ParamErr("原容器ID不正确", nil)
+	}
+	license, err := model.GetLicense(req.FromContainerID)
+	if err != nil || license.Name != req.Name || !license.Status.Usable() {
+		return verifyErr(errors.New("授权信息异常"))
+	}
+	fingerprint := req.GetFingerprint()
+	if err = license.CheckSelfTransfer(&fingerprint, req.instance()); err != nil {
+		return transferErr(err)
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = "客户端自助迁移"
+	}
+	if err = license.Transfer(req.ContainerID, reason, nil, true); err != nil {
+		return transferErr(err)
+	}
+	res, err := license.Verify(&req.License, req.instance(), req.SeatID)
+	if err != nil {
+		return verifyErr(err)
+	}
+	return signResponse(newLicenseAuthDTO(res).withNonce(req.Nonce))
+}
+
+// transferErr 将授权迁移错误转换为返回信息
+func transferErr(err error) serializer.Response {
+	switch err {
+	case model.ErrFingerprintMismatch:
+		return serializer.Err(serializer.CodeLicenseFingerprintMismatch, err.Error(), nil)
+	case model.ErrTransferQuotaExceeded:
+		return serializer.Response{
+			Code: serializer.CodeLicenseTransferDenied,
+			Msg:  err.Error(),
+			Data: map[string]int{
+				"limit":  conf.LicenseConfig.TransferLimit,
+				"period": conf.LicenseConfig.TransferPeriod,
+			},
+		}
+	case model.ErrTransferTargetExists, model.ErrTransferStale, model.ErrTransferDisabled, model.ErrTransferInUse, model.ErrTransferFloating, model.ErrReasonRequired:
+		return serializer.Err(serializer.CodeLicenseTransferDenied, err.Error(), nil)
+	}
+	return serializer.DBErr("授权迁移失败", err)
+}
@@ -0,0 +1,151 @@
+package license
+
+import (
+	model "github.com/zhouqiaokeji/server/models"
+	"github.com/zhouqiaokeji/server/pkg/serializer"
+	"github.com/zhouqiaokeji/server/pkg/util"
+	"time"
+)
+
+// ServiceUsageDTO 授权用量查询，日期格式为 20060102 或 2006-01-02，默认查询最近 30 天
+type ServiceUsageDTO struct {
+	ContainerID string `form:"id" binding:"required"`
+	From        string `form:"from"`
+	To          string `form:"to"`
+}
+
+// ServiceUsageCapDTO 授权每月用量上限设置，Cap 为 0 时不限制，Policy 为空时使用全局配置
+type ServiceUsageCapDTO struct {
+	ContainerID string `json:"containerId" binding:"required"`
+	Cap         int64  `json:"cap" binding:"gte=0"`
+	Policy      string `json:"policy" binding:"omitempty,oneof=flag refuse"`
+}
+
+// ServiceRetentionDTO 授权服务使用记录保留天数设置，Days 为 0 时使用全局配置
+type ServiceRetentionDTO struct {
+	ContainerID string `json:"containerId" binding:"required"`
+	Days        int    `json:"days" binding:"gte=0"`
+}
+
+// RetentionDTO 授权服务使用记录保留期，Effective 为实际生效的保留天数，0 为永久保留
+type RetentionDTO struct {
+	ContainerID string `json:"containerId"`
+	Retention   int    `json:"retention"`
+	Effective   int    `json:"effective"`
+}
+
+// UsageDTO 授权日期区间内的用量
+type UsageDTO struct {
+	ContainerID  string        `json:"containerId"`
+	From         string        `json:"from"`
+	To           string        `json:"to"`
+	Verifies     int64         `json:"verifies"`
+	CheckIns     int64         `json:"check_ins"`
+	Devices      int64         `json:"devices"`
+	Users        int64         `json:"users"`
+	MonthlyUsage int64         `json:"monthly_usage"`
+	Cap          int64         `json:"cap"`
+	Policy       string        `json:"policy"`
+	Days         []UsageDayDTO `json:"days"`
+}
+
+// UsageDayDTO 授权每日用量
+type UsageDayDTO struct {
+	Day      string `json:"day"`
+	Verifies int64  `json:"verifies"`
+	CheckIns int64  `json:"check_ins"`
+	Devices  int64  `json:"devices"`
+	Users    int64  `json:"users"`
+}
+
+// GetUsage 查询授权在日期区间内的每日用量及区间汇总，区间内设备及终端用户按去重计数
+func (s *ServiceUsageDTO) GetUsage() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	now := time.Now()
+	from, to := now.AddDate(0, 0, -29).Format(util.FORMAT_DATE_y4Md), now.Format(util.FORMAT_DATE_y4Md)
+	if s.From != "" {
+		if from, err = parseDate(s.From); err != nil {
+			return serializer.ParamErr("开始日期格式错误", err)
+		}
+	}
+	if s.To != "" {
+		if to, err = parseDate(s.To); err != nil {
+			return serializer.ParamErr("结束日期格式错误", err)
+		}
+	}
+	if from > to {
+		return serializer.ParamErr("开始日期不能晚于结束日期", nil)
+	}
+
+	res := &UsageDTO{
+		ContainerID:  license.ContainerID,
+		From:         from,
+		To:           to,
+		MonthlyUsage: license.MonthlyUsage(now),
+		Cap:          license.UsageCap,
+		Policy:       license.UsagePolicyOf(),
+	}
+	usages := model.GetLicenseUsages(license.ID, from, to)
+	res.Days = make([]UsageDayDTO, 0, len(usages))
+	for _, t := range usages {
+		res.Days = append(res.Days, UsageDayDTO{
+			Day:      t.Day,
+			Verifies: t.Verifies,
+			CheckIns: t.CheckIns,
+			Devices:  t.Devices,
+			Users:    t.Users,
+		})
+		res.Verifies += t.Verifies
+		res.CheckIns += t.CheckIns
+	}
+	res.Devices, res.Users = model.CountUsageMembers(license.ID, from, to)
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: res,
+	}
+}
+
+// SetCap 设置授权每月用量上限及超限策略
+func (s *ServiceUsageCapDTO) SetCap() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = license.SetUsageCap(s.Cap, s.Policy); err != nil {
+		return serializer.DBErr("授权用量上限设置失败", err)
+	}
+	return (&ServiceUsageDTO{ContainerID: s.ContainerID}).GetUsage()
+}
+
+// checkUsage 检查授权当月用量，已达上限时按策略返回超限标记或拒绝
+func checkUsage(license *model.License) (bool, error) {
+	if !license.UsageExceeded(time.Now()) {
+		return false, nil
+	}
+	if license.UsagePolicyOf() == model.UsagePolicyRefuse {
+		return true, model.ErrUsageCapExceeded
+	}
+	return true, nil
+}
+
+// SetRetention 设置授权服务使用记录的保留天数，超出后由汇总任务按日汇总并删除原始记录
+func (s *ServiceRetentionDTO) SetRetention() serializer.Response {
+	license, err := model.GetLicense(s.ContainerID)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotFound, "授权信息不存在", err)
+	}
+	if err = license.SetRetention(s.Days); err != nil {
+		return serializer.DBErr("授权记录保留期设置失败", err)
+	}
+	return serializer.Response{
+		Code: serializer.OK,
+		Data: &RetentionDTO{
+			ContainerID: license.ContainerID,
+			Retention:   license.Retention,
+			Effective:   license.RetentionOf(),
+		},
+	}
+}